@@ -1,31 +1,168 @@
 package main
 
 import (
-	"github.com/google/uuid"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
 	"github.com/sirupsen/logrus"
 	"github.com/stewyb314/remote-control/internal/agent"
 	"github.com/stewyb314/remote-control/internal/config"
 	"github.com/stewyb314/remote-control/internal/db"
+	"github.com/stewyb314/remote-control/internal/logging"
+	"github.com/stewyb314/remote-control/internal/metrics"
+	"github.com/stewyb314/remote-control/internal/output"
+	"github.com/stewyb314/remote-control/internal/redact"
+	"github.com/stewyb314/remote-control/internal/retention"
 	"github.com/stewyb314/remote-control/internal/services"
+	"github.com/stewyb314/remote-control/internal/tracing"
+	"github.com/stewyb314/remote-control/internal/version"
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	// backendTimeout bounds the checks that the database and the output
+	// store work before the agent starts
+	backendTimeout = 10 * time.Second
+	// flushTimeout bounds exporting the last spans on exit
+	flushTimeout = 5 * time.Second
 )
 
 func main() {
-	log := logrus.New().WithField("request_id", uuid.New().String()) 
+	// requests log with entries of their own, see the logging package
+	log := logrus.NewEntry(logrus.New())
 	log.Logger.Formatter = &logrus.JSONFormatter{}
-	conf := config.NewAgentConfig()
-	mysql, err  := db.NewMySQL(conf.DbConfig)
+	conf, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	logging.Configure(log, conf.Log)
+	shutdownTracing, err := tracing.Setup(context.Background(), "trc-agent", conf.Tracing)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+	pol, err := loadPolicy(conf.PolicyFile)
 	if err != nil {
-		log.Infof("Failed to connect to MySQL: %v", err)
+		log.Fatalf("Failed to load policy: %v", err)
+	}
+	redactor, err := redact.New(conf.Redact)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	creds, err := serverCredentials(conf.Server)
+	if err != nil {
+		log.Fatalf("Failed to load TLS credentials: %v", err)
+	}
+	database, err := db.New(conf.DbConfig)
+	if err != nil {
+		log.Fatalf("Failed to connect to %s database: %v", conf.Driver, err)
+	}
+	database = db.Instrument(database)
+	ctx, cancel := context.WithTimeout(context.Background(), backendTimeout)
+	defer cancel()
+	if err := database.Ping(ctx); err != nil {
+		log.Fatalf("Failed to reach %s database: %v", conf.Driver, err)
+	}
+
+	if len(args) > 0 && args[0] == "migrate" {
+		os.Exit(runMigrate(database, args[1:]))
 	}
 
-	if err := mysql.Migrate(); err != nil {
-		log.Infof("Failed to migrate database: %v", err)
+	if err := database.Migrate(); err != nil {
+		if errors.Is(err, db.ErrSchemaTooNew) {
+			log.Fatalf("Refusing to start: %v", err)
+		}
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+	store, err := output.New(conf.OutputConfig, database)
+	if err != nil {
+		log.Fatalf("Failed to open %s output store: %v", conf.OutputConfig.Store, err)
+	}
+	if err := store.Check(ctx); err != nil {
+		log.Fatalf("Failed to check %s output store: %v", conf.OutputConfig.Store, err)
+	}
+	if n, err := output.ImportLegacy(database, store); err != nil {
+		log.Errorf("Failed to import output of earlier jobs: %v", err)
+	} else if n > 0 {
+		log.Infof("Imported the output of %d earlier jobs into the %s output store", n, conf.OutputConfig.Store)
+	}
+	cancel()
+	retention.NewSweeper(conf.RetentionConfig, database, store, log).Start(context.Background())
+	jobs := services.NewJobs(conf.JobsConfig, database, store, log)
+	jobs.SetPolicy(pol)
+	jobs.SetRedactor(redactor)
+	metrics.RegisterJobs(func() int { running, _ := jobs.Counts(); return running }, jobs.QueueLength)
+	if conf.Metrics.Listen != "" {
+		if err := metrics.Serve(conf.Metrics.Listen, log); err != nil {
+			log.Fatalf("Failed to serve metrics: %v", err)
+		}
+	}
+	go reloadOnHangup(log, conf, jobs)
+	// jobs of the previous run are not running any more, whatever their
+	// rows say, so nothing would ever finish them
+	if n, err := jobs.Recover(); err != nil {
+		log.Fatalf("Failed to recover jobs: %v", err)
+	} else if n > 0 {
+		log.Warnf("Marked %d jobs interrupted by the restart failed", n)
+	}
+	scheduler := services.NewScheduler(jobs, database, log)
+	if err := scheduler.Start(); err != nil {
+		log.Fatalf("Failed to start scheduler: %v", err)
 	}
-	jobs := services.NewJobs(mysql, log)
-	a := agent.New(log, "0.0.0.0", 50051, nil, mysql, jobs)
-	log.Infof("Starting agent")
+	workflows := services.NewWorkflows(jobs, database, log)
+	if err := workflows.Recover(); err != nil {
+		log.Fatalf("Failed to recover workflows: %v", err)
+	}
+	a := agent.New(log, conf.Server.Listen, conf.Server.Port, creds, conf.KeepaliveConfig, database, store, jobs, scheduler, workflows)
+	shutdown := shutdownOnTerm(log, a, conf.Server.ShutdownGracePeriod)
+	log.Infof("Starting agent %s", version.String())
 	err = a.StartAgent()
 	if err != nil {
 		log.Fatalf("Failed to start agent: %v", err)
 	}
-}
\ No newline at end of file
+	// serving stops as soon as the shutdown begins, wait for the jobs
+	<-shutdown
+	ctx, cancel = context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		log.Errorf("Failed to flush traces: %v", err)
+	}
+}
+
+// serverCredentials returns the TLS credentials of the agent, nil when TLS
+// is not configured. With a CA certificate clients must present a
+// certificate signed by it.
+func serverCredentials(conf config.ServerConfig) (credentials.TransportCredentials, error) {
+	if conf.Cert == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(conf.Cert, conf.Key)
+	if err != nil {
+		return nil, err
+	}
+	tlsConf := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if conf.CACert != "" {
+		ca, err := os.ReadFile(conf.CACert)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in %s", conf.CACert)
+		}
+		tlsConf.ClientCAs = pool
+		tlsConf.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return credentials.NewTLS(tlsConf), nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/stewyb314/remote-control/internal/db"
+)
+
+func printMigrateHelp() {
+	fmt.Println("Usage: agent migrate status|up|down [version]")
+	fmt.Println("\tstatus\t\tprint the current and available schema versions")
+	fmt.Println("\tup [version]\tapply migrations up to version (default latest)")
+	fmt.Println("\tdown [version]\trevert migrations down to version (default one step)")
+}
+
+// runMigrate implements the `agent migrate` subcommand and returns the
+// process exit code.
+func runMigrate(database db.DB, args []string) int {
+	if len(args) == 0 {
+		printMigrateHelp()
+		return 1
+	}
+	current, err := database.SchemaVersion()
+	if err != nil {
+		fmt.Printf("Failed to read schema version: %v\n", err)
+		return 1
+	}
+
+	target := -1
+	if len(args) > 1 {
+		target, err = strconv.Atoi(args[1])
+		if err != nil {
+			fmt.Printf("Invalid version %q: %v\n", args[1], err)
+			return 1
+		}
+	}
+
+	switch args[0] {
+	case "status":
+		fmt.Printf("Current schema version: %d\nLatest schema version: %d\n\n", current, db.LatestSchemaVersion())
+		for _, m := range db.Migrations() {
+			state := "pending"
+			if m.Version <= current {
+				state = "applied"
+			}
+			fmt.Printf("%4d  %-8s %s\n", m.Version, state, m.Name)
+		}
+		return 0
+	case "up":
+		if target < 0 {
+			target = db.LatestSchemaVersion()
+		}
+		if target < current {
+			fmt.Printf("Schema is at version %d, use down to revert to %d\n", current, target)
+			return 1
+		}
+	case "down":
+		if target < 0 {
+			target = current - 1
+		}
+		if target < 0 || target > current {
+			fmt.Printf("Schema is at version %d, can not revert to %d\n", current, target)
+			return 1
+		}
+	default:
+		printMigrateHelp()
+		return 1
+	}
+
+	if err := database.MigrateTo(target); err != nil {
+		fmt.Printf("Migration failed: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Schema migrated from version %d to %d\n", current, target)
+	return 0
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stewyb314/remote-control/internal/config"
+	"github.com/stewyb314/remote-control/internal/logging"
+	"github.com/stewyb314/remote-control/internal/policy"
+	"github.com/stewyb314/remote-control/internal/redact"
+	"github.com/stewyb314/remote-control/internal/services"
+)
+
+// reloadOnHangup reloads the configuration on every SIGHUP and applies the
+// settings that can change while jobs run: the job limits, the policy, the
+// redact patterns and the log level and format. Running jobs are not
+// affected. Changes to other settings are logged and only take effect once
+// the agent restarts, and an invalid configuration is rejected as a whole.
+func reloadOnHangup(log *logrus.Entry, running *config.AgentConfig, jobs *services.Jobs) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		log.Infof("Reloading configuration")
+		conf, _, err := config.Load(os.Args[1:])
+		if err != nil {
+			log.Errorf("Failed to reload configuration, keeping the current one: %v", err)
+			continue
+		}
+		pol, err := loadPolicy(conf.PolicyFile)
+		if err != nil {
+			log.Errorf("Failed to reload policy, keeping the current configuration: %v", err)
+			continue
+		}
+		redactor, err := redact.New(conf.Redact)
+		if err != nil {
+			log.Errorf("Failed to reload configuration, keeping the current one: %v", err)
+			continue
+		}
+		jobs.SetConfig(conf.JobsConfig)
+		jobs.SetPolicy(pol)
+		jobs.SetRedactor(redactor)
+		logging.Configure(log, conf.Log)
+		for _, section := range running.RestartRequired(conf) {
+			log.Warnf("Changed %s settings take effect once the agent restarts", section)
+		}
+		log.Infof("Reloaded configuration")
+	}
+}
+
+// loadPolicy loads the policy file, no file allows every command.
+func loadPolicy(path string) (*policy.Policy, error) {
+	if path == "" {
+		return nil, nil
+	}
+	return policy.Load(path)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stewyb314/remote-control/internal/agent"
+)
+
+// shutdownOnTerm shuts the agent down gracefully on SIGTERM or an
+// interrupt, giving running jobs gracePeriod to finish. A second signal
+// exits at once. The returned channel is closed once the shutdown is done.
+func shutdownOnTerm(log *logrus.Entry, a *agent.Agent, gracePeriod time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	term := make(chan os.Signal, 2)
+	signal.Notify(term, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		sig := <-term
+		log.Infof("Received %v, shutting down, running jobs have %v to finish", sig, gracePeriod)
+		go func() {
+			sig := <-term
+			log.Fatalf("Received %v during shutdown, exiting", sig)
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), gracePeriod)
+		defer cancel()
+		a.Shutdown(ctx)
+		log.Infof("Shutdown complete")
+		close(done)
+	}()
+	return done
+}
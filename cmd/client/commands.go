@@ -0,0 +1,463 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// command is a subcommand of the client. Every subcommand accepts the
+// global flags, before or after its name, and its own flags after it.
+type command struct {
+	name string
+	// args is the synopsis of the positional arguments
+	args    string
+	summary string
+	// flags registers the subcommand's own flags
+	flags func(fs *flag.FlagSet, params *Parameters)
+	// minArgs and maxArgs bound the number of positional arguments,
+	// maxArgs < 0 means no bound
+	minArgs, maxArgs int
+	// complete is what the first positional argument completes to
+	complete completion
+	// validate checks the flags and arguments before connecting
+	validate func(params Parameters) error
+	// run runs the subcommand against the agent, local runs it without
+	// connecting to one
+	run   func(conn Connection, params Parameters, p *Printer)
+	local func(params Parameters, p *Printer) error
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{
+			name:     "start",
+			args:     "<command> [args...]",
+			summary:  "start a command on the agent and print its ID",
+			flags:    func(fs *flag.FlagSet, params *Parameters) { startFlags(fs, params); secretArgsFlag(fs, params) },
+			minArgs:  1,
+			maxArgs:  -1,
+			validate: func(params Parameters) error { _, err := startRequest(params); return err },
+			run:      doStart,
+		},
+		{
+			name:     "status",
+			args:     "<id>",
+			summary:  "print the status of a command",
+			minArgs:  1,
+			maxArgs:  1,
+			complete: completeJobs,
+			validate: validateID("command"),
+			run:      doStatus,
+		},
+		{
+			name:     "stop",
+			args:     "<id>",
+			summary:  "stop a running or queued command",
+			minArgs:  1,
+			maxArgs:  1,
+			complete: completeJobs,
+			validate: validateID("command"),
+			run:      doStop,
+		},
+		{
+			name:     "output",
+			args:     "<id>",
+			summary:  "stream the output of a command, following it until the command finishes",
+			flags:    outputFlags,
+			minArgs:  1,
+			maxArgs:  1,
+			complete: completeJobs,
+			validate: validateID("command"),
+			run:      doOutput,
+		},
+		{
+			name:     "jobs",
+			summary:  "list the most recent commands of -owner, newest first",
+			flags:    jobsFlags,
+			validate: func(params Parameters) error { _, err := listJobsRequest(params); return err },
+			run:      doJobs,
+		},
+		{
+			name:     "schedule",
+			args:     "<command> [args...]",
+			summary:  "run a command on a cron schedule or once at a later time",
+			flags:    scheduleFlags,
+			minArgs:  1,
+			maxArgs:  -1,
+			validate: func(params Parameters) error { _, err := scheduleRequest(params); return err },
+			run:      doSchedule,
+		},
+		{
+			name:    "schedules",
+			summary: "list the schedules",
+			run:     doSchedules,
+		},
+		{
+			name:     "unschedule",
+			args:     "<schedule-id>",
+			summary:  "delete a schedule, commands it already started are not affected",
+			minArgs:  1,
+			maxArgs:  1,
+			complete: completeSchedules,
+			validate: validateID("schedule"),
+			run:      doUnschedule,
+		},
+		{
+			name:     "workflow",
+			args:     "<file>",
+			summary:  "start the workflow in a JSON file",
+			flags:    ownerFlag,
+			minArgs:  1,
+			maxArgs:  1,
+			complete: completeFiles,
+			validate: func(params Parameters) error { _, err := workflowRequest(params); return err },
+			run:      doWorkflow,
+		},
+		{
+			name:     "workflow-status",
+			args:     "<workflow-id>",
+			summary:  "print the status of a workflow and its steps",
+			minArgs:  1,
+			maxArgs:  1,
+			validate: validateID("workflow"),
+			run:      doWorkflowStatus,
+		},
+		{
+			name:     "workflow-stop",
+			args:     "<workflow-id>",
+			summary:  "stop a workflow's running steps and skip the others",
+			minArgs:  1,
+			maxArgs:  1,
+			validate: validateID("workflow"),
+			run:      doWorkflowStop,
+		},
+		{
+			name:    "ping",
+			summary: "check that the agent answers and print its version, uptime and the round trip time",
+			run:     doPing,
+		},
+		{
+			name:    "health",
+			summary: "print the agent's version, uptime, load and backend status, exits with status 1 when it is not ready",
+			run:     doHealth,
+		},
+		{
+			name:    "drain",
+			summary: "make the agent refuse new jobs while the running ones finish, e.g. before a restart",
+			run:     doDrain,
+		},
+		{
+			name:     "help",
+			args:     "[subcommand]",
+			summary:  "print the usage of the client or of a subcommand",
+			maxArgs:  1,
+			complete: completeCommands,
+			local:    doHelp,
+		},
+		{
+			name:     "completion",
+			args:     "bash|zsh|fish",
+			summary:  "print a shell completion script, e.g. source <(trc-client completion bash)",
+			minArgs:  1,
+			maxArgs:  1,
+			complete: completeShells,
+			validate: func(params Parameters) error { _, err := completionScript(params.Cmd[0], program()); return err },
+			local:    doCompletion,
+		},
+	}
+}
+
+func lookupCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// program is the name the client was run as.
+func program() string {
+	return filepath.Base(os.Args[0])
+}
+
+func defaultParameters() Parameters {
+	return Parameters{
+		Port:          50051,
+		Host:          "127.0.0.1",
+		Owner:         os.Getenv("USER"),
+		MaxAttempts:   1,
+		Backoff:       time.Second,
+		BackoffPolicy: "exponential",
+		MaxBackoff:    time.Minute,
+		Timeout:       10 * time.Second,
+		Keepalive:     30 * time.Second,
+		RPCRetries:    5,
+		Output:        FormatJSON,
+		Limit:         20,
+	}
+}
+
+// globalFlags registers the flags every subcommand accepts.
+func globalFlags(fs *flag.FlagSet, params *Parameters) {
+	fs.IntVar(&params.Port, "port", params.Port, "remote port to connect to")
+	fs.StringVar(&params.Host, "host", params.Host, "remote host to connect to")
+	fs.StringVar(&params.Ident, "ident", params.Ident, "config file with paths to ssl certs and keys, connects with TLS")
+	fs.BoolVar(&params.Compress, "compress", params.Compress, "gzip compress messages to and from the agent, useful for large output over slow links")
+	fs.DurationVar(&params.Timeout, "timeout", params.Timeout, "deadline of every request except output, 0 for none")
+	fs.DurationVar(&params.Keepalive, "keepalive", params.Keepalive, "ping the agent after this long without activity to detect dead connections, 0 disables the pings")
+	fs.IntVar(&params.RPCRetries, "rpc-retries", params.RPCRetries, "attempts of requests that are safe to repeat while the agent is unavailable, at most 5")
+	fs.StringVar(&params.Output, "output", params.Output, "format of the results: json, yaml, table or text")
+	fs.StringVar(&params.Profile, "profile", params.Profile, "profile of the configuration file to use, default $TRC_PROFILE or the file's default_profile")
+	fs.StringVar(&params.OTLPEndpoint, "otlp-endpoint", params.OTLPEndpoint, "host:port of an OTLP/gRPC collector to export traces to")
+	fs.BoolVar(&params.OTLPInsecure, "otlp-insecure", params.OTLPInsecure, "connect to the OTLP collector without TLS")
+	fs.StringVar(&params.TraceFile, "trace-file", params.TraceFile, "file to append traces to as JSON, one span per line")
+}
+
+func ownerFlag(fs *flag.FlagSet, params *Parameters) {
+	fs.StringVar(&params.Owner, "owner", params.Owner, "user the command runs on behalf of, for the agent's per-user limits")
+}
+
+func startFlags(fs *flag.FlagSet, params *Parameters) {
+	ownerFlag(fs, params)
+	fs.IntVar(&params.Priority, "priority", params.Priority, "queued commands with a higher priority start first")
+	fs.Int64Var(&params.OutputLimit, "output-limit", params.OutputLimit, "maximum number of output bytes to keep, 0 uses the agent's limit")
+	fs.StringVar(&params.OutputLimitMode, "output-limit-mode", params.OutputLimitMode, "kill the command (kill) or keep the last output-limit bytes (ring) when the output exceeds the limit")
+	fs.IntVar(&params.MaxAttempts, "max-attempts", params.MaxAttempts, "run the command up to this many times until it succeeds")
+	fs.DurationVar(&params.Backoff, "backoff", params.Backoff, "time to wait before the first retry")
+	fs.StringVar(&params.BackoffPolicy, "backoff-policy", params.BackoffPolicy, "wait the same time before every retry (fixed) or double it each time (exponential)")
+	fs.DurationVar(&params.MaxBackoff, "max-backoff", params.MaxBackoff, "longest time to wait before a retry")
+	fs.StringVar(&params.RetryExitCodes, "retry-exit-codes", params.RetryExitCodes, "comma separated exit codes to retry, any non-zero exit code when empty")
+	fs.StringVar(&params.IdempotencyKey, "idempotency-key", params.IdempotencyKey, "key that makes repeating the same start request return the command it started, a random key by default")
+}
+
+// secretArgsFlag is only accepted by start, the agent refuses schedules
+// with secrets as it keeps their commands in its database.
+func secretArgsFlag(fs *flag.FlagSet, params *Parameters) {
+	fs.StringVar(&params.SecretArgs, "secret-args", params.SecretArgs, "comma separated positions of arguments that are secrets, 1 is the first argument after the command. The agent masks them wherever it logs, stores or shows them")
+}
+
+func scheduleFlags(fs *flag.FlagSet, params *Parameters) {
+	startFlags(fs, params)
+	fs.StringVar(&params.Cron, "cron", params.Cron, "cron expression to run the command on, e.g. \"*/5 * * * *\" or \"@hourly\"")
+	fs.StringVar(&params.At, "at", params.At, "RFC3339 time to run the command once, e.g. 2006-01-02T15:04:05Z")
+}
+
+func outputFlags(fs *flag.FlagSet, params *Parameters) {
+	fs.DurationVar(&params.StreamTimeout, "stream-timeout", params.StreamTimeout, "deadline of the output stream, 0 follows the output until the command finishes")
+}
+
+func jobsFlags(fs *flag.FlagSet, params *Parameters) {
+	fs.StringVar(&params.Owner, "owner", params.Owner, "list the commands of this user")
+	fs.BoolVar(&params.All, "all", params.All, "list the commands of all users")
+	fs.StringVar(&params.States, "state", params.States, "comma separated states to list: pending, running, completed, stopped or error, all when empty")
+	fs.IntVar(&params.Limit, "limit", params.Limit, "maximum number of commands to list")
+}
+
+// flagSet returns the flags of the subcommand bound to params.
+func (c *command) flagSet(params *Parameters) *flag.FlagSet {
+	fs := flag.NewFlagSet(program()+" "+c.name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Usage = func() {}
+	if c.flags != nil {
+		c.flags(fs, params)
+	}
+	globalFlags(fs, params)
+	return fs
+}
+
+// allFlags returns the flags of every subcommand bound to params.
+func allFlags(params *Parameters) *flag.FlagSet {
+	fs := flag.NewFlagSet(program(), flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Usage = func() {}
+	globalFlags(fs, params)
+	for _, cmd := range commands {
+		if cmd.flags == nil {
+			continue
+		}
+		own := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+		cmd.flags(own, params)
+		own.VisitAll(func(f *flag.Flag) {
+			if fs.Lookup(f.Name) == nil {
+				fs.Var(f.Value, f.Name, f.Usage)
+			}
+		})
+	}
+	return fs
+}
+
+// parseArgs finds the subcommand in args and parses its flags, those
+// before the subcommand's name included, and arguments. The subcommand is
+// nil when args has none.
+func parseArgs(args []string) (*command, Parameters, error) {
+	params := defaultParameters()
+	// flags of any subcommand may precede its name
+	scratch := defaultParameters()
+	all := allFlags(&scratch)
+	if err := all.Parse(args); err != nil {
+		return nil, params, err
+	}
+	rest := all.Args()
+	if len(rest) == 0 {
+		return nil, params, fmt.Errorf("no subcommand given")
+	}
+	cmd := lookupCommand(rest[0])
+	if cmd == nil {
+		return nil, params, fmt.Errorf("unknown subcommand %q", rest[0])
+	}
+	fs := cmd.flagSet(&params)
+	before := args[:len(args)-len(rest)]
+	if err := fs.Parse(append(slices.Clone(before), rest[1:]...)); err != nil {
+		return cmd, params, err
+	}
+	params.SubCmd = cmd.name
+	params.Cmd = fs.Args()
+	// flags may also follow the arguments, except for subcommands whose
+	// arguments are a command line of their own
+	if cmd.maxArgs >= 0 {
+		params.Cmd = nil
+		for args := fs.Args(); len(args) > 0; args = fs.Args() {
+			params.Cmd = append(params.Cmd, args[0])
+			if err := fs.Parse(args[1:]); err != nil {
+				return cmd, params, err
+			}
+		}
+	}
+	// only now that all flags are parsed, wherever they were, is it known
+	// which profile to use and which settings the flags override
+	if err := applyConfig(fs, params.Profile); err != nil {
+		return cmd, params, err
+	}
+	if n := len(params.Cmd); n < cmd.minArgs || (cmd.maxArgs >= 0 && n > cmd.maxArgs) {
+		return cmd, params, fmt.Errorf("usage: %s", cmd.synopsis())
+	}
+	if err := validateParameters(params); err != nil {
+		return cmd, params, err
+	}
+	if cmd.validate != nil {
+		if err := cmd.validate(params); err != nil {
+			return cmd, params, err
+		}
+	}
+	// a key of our own still makes retrying the request safe
+	if params.IdempotencyKey == "" {
+		params.IdempotencyKey = uuid.New().String()
+	}
+	return cmd, params, nil
+}
+
+// validateParameters checks the global flags.
+func validateParameters(params Parameters) error {
+	if params.Port < 1 || params.Port > 65535 {
+		return fmt.Errorf("invalid port %d", params.Port)
+	}
+	if params.Timeout < 0 || params.StreamTimeout < 0 {
+		return fmt.Errorf("invalid timeout, must not be negative")
+	}
+	if params.Keepalive < 0 {
+		return fmt.Errorf("invalid keepalive %v, must not be negative", params.Keepalive)
+	}
+	if params.RPCRetries < 1 || params.RPCRetries > 5 {
+		return fmt.Errorf("invalid rpc-retries %d, must be between 1 and 5", params.RPCRetries)
+	}
+	_, err := NewPrinter(params.Output, io.Discard)
+	return err
+}
+
+// validateID checks that the argument is the ID of a kind of object.
+func validateID(kind string) func(params Parameters) error {
+	return func(params Parameters) error {
+		if _, err := uuid.Parse(params.Cmd[0]); err != nil {
+			return fmt.Errorf("invalid %s ID %q", kind, params.Cmd[0])
+		}
+		return nil
+	}
+}
+
+// usageError reports invalid flags or arguments and exits.
+func usageError(cmd *command, err error) {
+	fmt.Fprintln(os.Stderr, err)
+	if cmd != nil {
+		fmt.Fprintf(os.Stderr, "Run '%s help %s' for usage.\n", program(), cmd.name)
+	} else {
+		fmt.Fprintf(os.Stderr, "Run '%s help' for usage.\n", program())
+	}
+	os.Exit(2)
+}
+
+func (c *command) synopsis() string {
+	s := fmt.Sprintf("%s %s [options]", program(), c.name)
+	if c.args != "" {
+		s += " " + c.args
+	}
+	return s
+}
+
+// usage prints the help of the subcommand.
+func (c *command) usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s\n\n%s.\n", c.synopsis(), c.summary)
+	if c.flags != nil {
+		params := defaultParameters()
+		fs := flag.NewFlagSet(c.name, flag.ContinueOnError)
+		c.flags(fs, &params)
+		fs.SetOutput(w)
+		fmt.Fprint(w, "\nOptions:\n\n")
+		fs.PrintDefaults()
+	}
+	printOptions(w)
+}
+
+// printUsage prints the help of the client.
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s [options] <subcommand> [options] [arguments]\n\nSubcommands:\n\n", program())
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.summary)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\nRun '%s help <subcommand>' for the options of a subcommand.\n", program())
+	printOptions(w)
+}
+
+// printOptions prints the global options.
+func printOptions(w io.Writer) {
+	params := defaultParameters()
+	fs := flag.NewFlagSet(program(), flag.ContinueOnError)
+	globalFlags(fs, &params)
+	fs.SetOutput(w)
+	fmt.Fprint(w, "\nGlobal options, accepted before or after the subcommand:\n\n")
+	fs.PrintDefaults()
+	configHelp := `
+Where -ident is the path to a JSON file with information about SSL certs and keys:
+{
+	"ca-cert": "<path to the CA certificate of the agent, the system's CAs when omitted>",
+	"host-cert": "<path to host cert signed by the agent's CA, for agents requiring one>",
+	"key": "<path to the key of host-cert>"
+}
+`
+	fmt.Fprint(w, configHelp)
+}
+
+func doHelp(params Parameters, p *Printer) error {
+	if len(params.Cmd) == 0 {
+		printUsage(os.Stdout)
+		return nil
+	}
+	cmd := lookupCommand(params.Cmd[0])
+	if cmd == nil {
+		usageError(nil, fmt.Errorf("unknown subcommand %q", params.Cmd[0]))
+	}
+	cmd.usage(os.Stdout)
+	return nil
+}
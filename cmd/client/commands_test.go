@@ -0,0 +1,114 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testID = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+
+func TestParseArgs(t *testing.T) {
+	writeConfig(t, testConfig)
+	for _, tc := range []struct {
+		name     string
+		args     []string
+		wantCmd  string
+		wantArgs []string
+		check    func(p Parameters) bool
+	}{
+		{
+			name:    "flags before the subcommand",
+			args:    []string{"-host", "agent.example.com", "-output", "yaml", "status", testID},
+			wantCmd: "status", wantArgs: []string{testID},
+			check: func(p Parameters) bool { return p.Host == "agent.example.com" && p.Output == FormatYAML },
+		},
+		{
+			name:    "flags after the arguments",
+			args:    []string{"status", testID, "-host", "agent.example.com", "-output", "yaml"},
+			wantCmd: "status", wantArgs: []string{testID},
+			check: func(p Parameters) bool { return p.Host == "agent.example.com" && p.Output == FormatYAML },
+		},
+		{
+			name:    "profile after the arguments",
+			args:    []string{"status", testID, "-profile", "customer-acme"},
+			wantCmd: "status", wantArgs: []string{testID},
+			check: func(p Parameters) bool { return p.Host == "acme.example.com" && p.Port == 7100 },
+		},
+		{
+			name:    "flag over a profile after the arguments",
+			args:    []string{"-port", "7200", "status", testID, "-profile", "customer-acme"},
+			wantCmd: "status", wantArgs: []string{testID},
+			check: func(p Parameters) bool { return p.Host == "acme.example.com" && p.Port == 7200 },
+		},
+		{
+			name:    "subcommand flags",
+			args:    []string{"jobs", "-state", "running", "-limit", "5"},
+			wantCmd: "jobs",
+			check:   func(p Parameters) bool { return p.States == "running" && p.Limit == 5 },
+		},
+		{
+			name:    "options after the command belong to it",
+			args:    []string{"start", "-owner", "bob", "ls", "-l", "-host", "x"},
+			wantCmd: "start", wantArgs: []string{"ls", "-l", "-host", "x"},
+			check: func(p Parameters) bool { return p.Owner == "bob" && p.Host == "staging.example.com" },
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd, params, err := parseArgs(tc.args)
+			if err != nil {
+				t.Fatalf("parseArgs(%q) = %v", tc.args, err)
+			}
+			if cmd.name != tc.wantCmd || params.SubCmd != tc.wantCmd {
+				t.Errorf("subcommand = %s, want %s", cmd.name, tc.wantCmd)
+			}
+			if !slices.Equal(params.Cmd, tc.wantArgs) {
+				t.Errorf("arguments = %q, want %q", params.Cmd, tc.wantArgs)
+			}
+			if !tc.check(params) {
+				t.Errorf("parameters = %+v", params)
+			}
+			if params.IdempotencyKey == "" {
+				t.Errorf("no idempotency key")
+			}
+		})
+	}
+}
+
+func TestParseArgsErrors(t *testing.T) {
+	writeConfig(t, testConfig)
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{nil, "no subcommand"},
+		{[]string{"-host", "x"}, "no subcommand"},
+		{[]string{"frobnicate"}, "unknown subcommand"},
+		{[]string{"-bogus", "status", testID}, "not defined"},
+		{[]string{"status", testID, "-bogus"}, "not defined"},
+		{[]string{"status", testID, "1b4e28ba-2fa1-11d2-883f-0016d3cca427"}, "usage:"},
+		{[]string{"status", testID, "-profile", "prod"}, "no profile"},
+		{[]string{"status", testID, "-output", "xml"}, "invalid output format"},
+	} {
+		if _, _, err := parseArgs(tc.args); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("parseArgs(%q) = %v, want an error containing %q", tc.args, err, tc.want)
+		}
+	}
+}
+
+// TestParseArgsMissingArguments checks that every subcommand that takes
+// arguments reports its usage without them instead of panicking.
+func TestParseArgsMissingArguments(t *testing.T) {
+	writeConfig(t, testConfig)
+	for _, cmd := range commands {
+		if cmd.minArgs == 0 {
+			continue
+		}
+		t.Run(cmd.name, func(t *testing.T) {
+			_, _, err := parseArgs([]string{cmd.name})
+			if err == nil || !strings.HasPrefix(err.Error(), "usage: ") {
+				t.Errorf("parseArgs(%s) = %v, want a usage error", cmd.name, err)
+			}
+		})
+	}
+}
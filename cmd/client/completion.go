@@ -0,0 +1,247 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	pb "github.com/stewyb314/remote-control/protos"
+)
+
+// completeCommand is the hidden subcommand the completion scripts run to
+// get the candidates for the word under the cursor. Its arguments are the
+// words of the command line after the program name, the last one being
+// the word to complete.
+const completeCommand = "__complete"
+
+// completion is what a positional argument completes to.
+type completion int
+
+const (
+	completeNone completion = iota
+	completeJobs
+	completeSchedules
+	completeFiles
+	completeCommands
+	completeShells
+)
+
+// completeTimeout bounds the requests made for completion so a missing
+// agent does not hang the shell.
+const completeTimeout = 2 * time.Second
+
+var shells = []string{"bash", "zsh", "fish"}
+
+// flagValues are the candidates of the flags with a fixed set of values.
+var flagValues = map[string][]string{
+	"output":            {FormatJSON, FormatYAML, FormatTable, FormatText},
+	"output-limit-mode": {"kill", "ring"},
+	"backoff-policy":    {"fixed", "exponential"},
+	"state":             {"pending", "running", "completed", "stopped", "error"},
+}
+
+// complete returns the candidates for the last of words. It returns none
+// where the shell should fall back to completing file names.
+func complete(words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	current, before := words[len(words)-1], words[:len(words)-1]
+	params := defaultParameters()
+	all := allFlags(&params)
+
+	var cmd *command
+	var args []string
+	flagsDone := false
+	pending := ""
+	for _, w := range before {
+		switch {
+		case pending != "":
+			pending = ""
+		case !flagsDone && w == "--":
+			flagsDone = cmd != nil
+		case !flagsDone && strings.HasPrefix(w, "-"):
+			name, _, hasValue := strings.Cut(strings.TrimLeft(w, "-"), "=")
+			if f := all.Lookup(name); f != nil && !hasValue && !isBoolFlag(f) {
+				pending = name
+			}
+		case cmd == nil:
+			if cmd = lookupCommand(w); cmd == nil {
+				return nil
+			}
+		default:
+			args = append(args, w)
+			flagsDone = true
+		}
+	}
+
+	var candidates []string
+	switch {
+	case pending == "profile":
+		candidates = profileNames()
+	case pending != "":
+		candidates = flagValues[pending]
+	case !flagsDone && strings.HasPrefix(current, "-"):
+		// before the subcommand only the global flags are offered
+		fs := flag.NewFlagSet(program(), flag.ContinueOnError)
+		globalFlags(fs, &params)
+		if cmd != nil {
+			fs = cmd.flagSet(&params)
+		}
+		fs.VisitAll(func(f *flag.Flag) { candidates = append(candidates, "-"+f.Name) })
+	case cmd == nil:
+		for _, c := range commands {
+			candidates = append(candidates, c.name)
+		}
+	case len(args) > 0:
+	case cmd.complete == completeJobs:
+		candidates = jobIDs(before)
+	case cmd.complete == completeSchedules:
+		candidates = scheduleIDs(before)
+	case cmd.complete == completeCommands:
+		for _, c := range commands {
+			candidates = append(candidates, c.name)
+		}
+	case cmd.complete == completeShells:
+		candidates = shells
+	}
+
+	var matches []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, current) {
+			matches = append(matches, candidate)
+		}
+	}
+	return matches
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+func profileNames() []string {
+	conf, err := loadConfig(configPath())
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for name := range conf.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// completeConnection connects to the agent selected by the flags in words
+// and the configuration, failing fast when it is not reachable.
+func completeConnection(words []string) (Connection, error) {
+	params := defaultParameters()
+	all := allFlags(&params)
+	// invalid or incomplete flags are left at their defaults
+	_ = all.Parse(words)
+	if rest := all.Args(); len(rest) > 0 {
+		_ = all.Parse(rest[1:])
+	}
+	if err := applyConfig(all, params.Profile); err != nil {
+		return Connection{}, err
+	}
+	params.Timeout = completeTimeout
+	params.RPCRetries = 1
+	return NewConnection(params)
+}
+
+// jobIDs returns the IDs of the most recent commands of all owners.
+func jobIDs(words []string) []string {
+	conn, err := completeConnection(words)
+	if err != nil {
+		return nil
+	}
+	defer conn.Done()
+	resp, err := conn.Client.ListJobs(conn.Ctx, &pb.ListJobsRequest{Limit: 100})
+	if err != nil {
+		return nil
+	}
+	var ids []string
+	for _, job := range resp.Jobs {
+		ids = append(ids, job.Id)
+	}
+	return ids
+}
+
+func scheduleIDs(words []string) []string {
+	conn, err := completeConnection(words)
+	if err != nil {
+		return nil
+	}
+	defer conn.Done()
+	resp, err := conn.Client.ListSchedules(conn.Ctx, &pb.ListSchedulesRequest{})
+	if err != nil {
+		return nil
+	}
+	var ids []string
+	for _, schedule := range resp.Schedules {
+		ids = append(ids, schedule.Id)
+	}
+	return ids
+}
+
+func doCompletion(params Parameters, p *Printer) error {
+	script, err := completionScript(params.Cmd[0], program())
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprint(os.Stdout, script)
+	return err
+}
+
+// completionScript returns the completion script of a shell for the client
+// installed as prog. The scripts ask the client for the candidates and
+// fall back to file names when there are none.
+func completionScript(shell, prog string) (string, error) {
+	var script string
+	switch shell {
+	case "bash":
+		script = `# bash completion for PROG, e.g. source <(PROG completion bash)
+_trc_client() {
+    local IFS=$'\n'
+    COMPREPLY=($(PROG __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+}
+complete -o default -F _trc_client PROG
+`
+	case "zsh":
+		script = `#compdef PROG
+# zsh completion for PROG, e.g. source <(PROG completion zsh) after compinit
+_trc_client() {
+    local -a candidates
+    candidates=(${(f)"$(PROG __complete "${(@)words[2,CURRENT]}" 2>/dev/null)"})
+    if (( ${#candidates} )); then
+        compadd -a candidates
+    else
+        _files
+    fi
+}
+compdef _trc_client PROG
+`
+	case "fish":
+		script = `# fish completion for PROG, e.g. PROG completion fish | source
+function __trc_client_complete
+    set -l tokens (commandline -opc)
+    set -l current (commandline -ct)
+    set -l candidates (PROG __complete $tokens[2..-1] $current 2>/dev/null)
+    if test (count $candidates) -eq 0
+        __fish_complete_path $current
+    else
+        printf '%s\n' $candidates
+    end
+end
+complete -c PROG -f -a '(__trc_client_complete)'
+`
+	default:
+		return "", fmt.Errorf("unsupported shell %q, must be one of %s", shell, strings.Join(shells, ", "))
+	}
+	return strings.ReplaceAll(script, "PROG", prog), nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCompletionScript(t *testing.T) {
+	for _, shell := range shells {
+		script, err := completionScript(shell, "trc")
+		if err != nil {
+			t.Fatalf("completionScript(%s) = %v", shell, err)
+		}
+		if strings.Contains(script, "PROG") {
+			t.Errorf("%s script still has the PROG placeholder", shell)
+		}
+		if !strings.Contains(script, "trc "+completeCommand+" ") {
+			t.Errorf("%s script does not ask trc for the candidates:\n%s", shell, script)
+		}
+	}
+	if _, err := completionScript("powershell", "trc"); err == nil {
+		t.Errorf("completionScript(powershell) succeeded")
+	}
+}
+
+func TestComplete(t *testing.T) {
+	writeConfig(t, testConfig)
+	for _, tc := range []struct {
+		words []string
+		want  []string
+	}{
+		{[]string{"sta"}, []string{"start", "status"}},
+		{[]string{"-host", "h", "work"}, []string{"workflow", "workflow-status", "workflow-stop"}},
+		{[]string{"-outp"}, []string{"-output"}},
+		{[]string{"jobs", "-al"}, []string{"-all"}},
+		{[]string{"-output", "t"}, []string{"table", "text"}},
+		{[]string{"jobs", "-state", "r"}, []string{"running"}},
+		{[]string{"-profile", ""}, []string{"customer-acme", "staging"}},
+		{[]string{"completion", ""}, []string{"bash", "fish", "zsh"}},
+		{[]string{"help", "unsch"}, []string{"unschedule"}},
+		// file names are left to the shell
+		{[]string{"workflow", ""}, nil},
+		{[]string{"start", "ls", ""}, nil},
+		{[]string{"frobnicate", ""}, nil},
+	} {
+		got := complete(tc.words)
+		slices.Sort(got)
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("complete(%q) = %q, want %q", tc.words, got, tc.want)
+		}
+	}
+}
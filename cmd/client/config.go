@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// profileSettings are the options a profile or the environment can set,
+// named after their flags. The environment variable of a setting is its
+// name in upper case prefixed with TRC_, e.g. TRC_STREAM_TIMEOUT.
+var profileSettings = []string{"host", "port", "ident", "owner", "output", "timeout", "stream-timeout", "keepalive", "compress", "otlp-endpoint", "otlp-insecure", "trace-file"}
+
+// clientConfig is the client's configuration file, a set of named profiles
+// with the settings of one agent each.
+type clientConfig struct {
+	// DefaultProfile is used when no profile is selected
+	DefaultProfile string                       `yaml:"default_profile"`
+	Profiles       map[string]map[string]string `yaml:"profiles"`
+}
+
+// configPath returns the path of the configuration file, $TRC_CONFIG or
+// trc/config.yaml in the user's configuration directory.
+func configPath() string {
+	if path := os.Getenv("TRC_CONFIG"); path != "" {
+		return path
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "trc", "config.yaml")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "trc", "config.yaml")
+}
+
+func loadConfig(path string) (*clientConfig, error) {
+	var conf clientConfig
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &conf, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, &conf); err != nil {
+		return nil, fmt.Errorf("invalid configuration file %s: %v", path, err)
+	}
+	for name, settings := range conf.Profiles {
+		for key := range settings {
+			if !slices.Contains(profileSettings, key) {
+				return nil, fmt.Errorf("unknown setting %q in profile %s of %s, valid settings are %s", key, name, path, strings.Join(profileSettings, ", "))
+			}
+		}
+	}
+	return &conf, nil
+}
+
+// applyConfig sets the flags of fs that were not given on the command line
+// from the environment or else from the selected profile, so flags override
+// the environment and both override the configuration file. Settings the
+// subcommand has no flag for are ignored.
+func applyConfig(fs *flag.FlagSet, profile string) error {
+	if profile == "" {
+		profile = os.Getenv("TRC_PROFILE")
+	}
+	path := configPath()
+	conf, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
+	if profile == "" {
+		profile = conf.DefaultProfile
+	}
+	var settings map[string]string
+	if profile != "" {
+		var ok bool
+		if settings, ok = conf.Profiles[profile]; !ok {
+			return fmt.Errorf("no profile %q in %s", profile, path)
+		}
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for _, name := range profileSettings {
+		if set[name] || fs.Lookup(name) == nil {
+			continue
+		}
+		env := "TRC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		value, ok := os.LookupEnv(env)
+		source := env
+		if !ok {
+			value, ok = settings[name]
+			source = fmt.Sprintf("profile %s", profile)
+		}
+		if !ok {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("invalid %s from %s: %v", name, source, err)
+		}
+	}
+	return nil
+}
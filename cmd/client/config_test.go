@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfig makes content the client's configuration file for the test and
+// clears the TRC_ environment of the user running it.
+func writeConfig(t *testing.T, content string) {
+	t.Helper()
+	for _, kv := range os.Environ() {
+		if name, _, _ := strings.Cut(kv, "="); strings.HasPrefix(name, "TRC_") {
+			t.Setenv(name, "")
+			os.Unsetenv(name)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TRC_CONFIG", path)
+}
+
+const testConfig = `
+default_profile: staging
+profiles:
+  staging:
+    host: staging.example.com
+    port: "7000"
+    owner: deploy
+  customer-acme:
+    host: acme.example.com
+    port: "7100"
+`
+
+func TestApplyConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		args      []string
+		env       map[string]string
+		profile   string
+		wantHost  string
+		wantPort  int
+		wantOwner string
+	}{
+		{
+			name:     "default profile",
+			wantHost: "staging.example.com", wantPort: 7000, wantOwner: "deploy",
+		},
+		{
+			name:     "selected profile",
+			profile:  "customer-acme",
+			wantHost: "acme.example.com", wantPort: 7100, wantOwner: "alice",
+		},
+		{
+			name:     "profile from the environment",
+			env:      map[string]string{"TRC_PROFILE": "customer-acme"},
+			wantHost: "acme.example.com", wantPort: 7100, wantOwner: "alice",
+		},
+		{
+			name:     "environment over profile",
+			env:      map[string]string{"TRC_HOST": "env.example.com", "TRC_OWNER": "ops"},
+			wantHost: "env.example.com", wantPort: 7000, wantOwner: "ops",
+		},
+		{
+			name:     "flag over environment and profile",
+			args:     []string{"-host", "flag.example.com", "-port", "7200"},
+			env:      map[string]string{"TRC_HOST": "env.example.com", "TRC_PORT": "7300"},
+			wantHost: "flag.example.com", wantPort: 7200, wantOwner: "deploy",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			writeConfig(t, testConfig)
+			for name, value := range tc.env {
+				t.Setenv(name, value)
+			}
+			params := Parameters{Host: "127.0.0.1", Port: 50051, Owner: "alice"}
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			globalFlags(fs, &params)
+			ownerFlag(fs, &params)
+			if err := fs.Parse(tc.args); err != nil {
+				t.Fatalf("Parse() = %v", err)
+			}
+			if err := applyConfig(fs, tc.profile); err != nil {
+				t.Fatalf("applyConfig() = %v", err)
+			}
+			if params.Host != tc.wantHost || params.Port != tc.wantPort || params.Owner != tc.wantOwner {
+				t.Errorf("host, port, owner = %s, %d, %s, want %s, %d, %s", params.Host, params.Port, params.Owner, tc.wantHost, tc.wantPort, tc.wantOwner)
+			}
+		})
+	}
+}
+
+func TestApplyConfigErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		config  string
+		profile string
+		env     map[string]string
+	}{
+		{name: "unknown profile", config: testConfig, profile: "prod"},
+		{name: "unknown setting", config: "profiles:\n  staging:\n    hots: example.com\n", profile: "staging"},
+		{name: "invalid value", config: "profiles:\n  staging:\n    port: many\n", profile: "staging"},
+		{name: "invalid environment", config: testConfig, env: map[string]string{"TRC_TIMEOUT": "soon"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			writeConfig(t, tc.config)
+			for name, value := range tc.env {
+				t.Setenv(name, value)
+			}
+			var params Parameters
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			globalFlags(fs, &params)
+			if err := applyConfig(fs, tc.profile); err == nil {
+				t.Errorf("applyConfig() succeeded")
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// identity is the -ident file, the certificates the client connects to an
+// agent with TLS with.
+type identity struct {
+	// CACert verifies the agent's certificate, the system's CAs are used
+	// when it is empty
+	CACert string `json:"ca-cert"`
+	// HostCert and Key are the client certificate for agents that require
+	// one, signed by the agent's CA
+	HostCert string `json:"host-cert"`
+	Key      string `json:"key"`
+}
+
+// transportCredentials returns the credentials to connect with, TLS with
+// the certificates of the ident file or no TLS at all without one.
+func transportCredentials(ident string) (credentials.TransportCredentials, error) {
+	if ident == "" {
+		return insecure.NewCredentials(), nil
+	}
+	path := expandHome(ident)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ident file: %v", err)
+	}
+	var id identity
+	if err := json.Unmarshal(data, &id); err != nil {
+		return nil, fmt.Errorf("invalid ident file %s: %v", path, err)
+	}
+
+	tlsConf := &tls.Config{MinVersion: tls.VersionTLS12}
+	if id.CACert != "" {
+		ca, err := os.ReadFile(expandHome(id.CACert))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in %s", id.CACert)
+		}
+		tlsConf.RootCAs = pool
+	}
+	if (id.HostCert == "") != (id.Key == "") {
+		return nil, fmt.Errorf("invalid ident file %s: host-cert and key must be set together", path)
+	}
+	if id.HostCert != "" {
+		cert, err := tls.LoadX509KeyPair(expandHome(id.HostCert), expandHome(id.Key))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		tlsConf.Certificates = []tls.Certificate{cert}
+	}
+	return credentials.NewTLS(tlsConf), nil
+}
+
+// expandHome replaces a leading ~/ with the user's home directory, as paths
+// in the configuration file are not expanded by a shell.
+func expandHome(path string) string {
+	rest, ok := strings.CutPrefix(path, "~/")
+	if !ok {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, rest)
+}
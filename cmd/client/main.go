@@ -2,21 +2,55 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/robfig/cron/v3"
 	pb "github.com/stewyb314/remote-control/protos"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/protobuf/encoding/protojson"
 )
 type Parameters struct {
 	Port   int
 	Host   string
 	Ident  string
-	Help   bool
+	Profile string
+	Compress bool
+	Owner string
+	Priority int
+	OutputLimit int64
+	OutputLimitMode string
+	Cron string
+	At string
+	MaxAttempts int
+	Backoff time.Duration
+	BackoffPolicy string
+	MaxBackoff time.Duration
+	RetryExitCodes string
+	IdempotencyKey string
+	SecretArgs string
+	Timeout time.Duration
+	StreamTimeout time.Duration
+	Keepalive time.Duration
+	RPCRetries int
+	OTLPEndpoint string
+	OTLPInsecure bool
+	TraceFile string
+	Output string
+	States string
+	Limit int
+	All bool
 	SubCmd string
 	Cmd    []string
 }
@@ -30,31 +64,49 @@ type Connection struct {
 
 
 func main() {
-    // Define flags
-	params := argParse()
-	conn, err := NewConnection(params)
+	if len(os.Args) > 1 && os.Args[1] == completeCommand {
+		for _, candidate := range complete(os.Args[2:]) {
+			fmt.Println(candidate)
+		}
+		return
+	}
+	cmd, params, err := parseArgs(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		if cmd != nil {
+			cmd.usage(os.Stdout)
+		} else {
+			printUsage(os.Stdout)
+		}
+		os.Exit(0)
+	}
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		usageError(cmd, err)
 	}
-	switch params.SubCmd {
-	case "start":
-		doStart(conn, params)
-	case "status":
-		doStatus(conn, params)
-	case "stop":
-		doStop(conn, params)
-	case "output":
-		doOutput(conn, params)
-
-	default:
-		printSubCommandsHelp()
-		fmt.Printf("Valid parameters for all subcommands")	
-		os.Exit(1)
+	p, err := NewPrinter(params.Output, os.Stdout)
+	if err != nil {
+		usageError(cmd, err)
+	}
+	if cmd.local != nil {
+		if err := cmd.local(params, p); err != nil {
+			fail(p, "", err)
+		}
+		return
+	}
+	ctx, err := startTracing(params, cmd.name)
+	if err != nil {
+		fail(p, "", err)
 	}
+	conn, err := NewConnection(params)
+	if err != nil {
+		fail(p, "", err)
+	}
+	conn.Ctx = trace.ContextWithSpan(conn.Ctx, trace.SpanFromContext(ctx))
+	cmd.run(conn, params, p)
+	conn.Done()
+	exit(0)
 }
 
-func doOutput(conn Connection, params Parameters) {
+func doOutput(conn Connection, params Parameters, p *Printer) {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt)
 
@@ -63,14 +115,13 @@ func doOutput(conn Connection, params Parameters) {
 	}
 	resp, err := conn.Client.Output(conn.Ctx, &cmd)
 	if err != nil {
-		fmt.Printf("Executing start command failed: %s\n", err)
-		os.Exit(1)
+		fail(p, cmd.Id, err)
 	}
 
 	for {
 		select {
 		case <-sigChan:
-			fmt.Println("Received interrupt signal, exiting...")
+			fmt.Fprintln(os.Stderr, "Received interrupt signal, exiting...")
 			return
 		default:
 			line, err := resp.Recv()
@@ -78,117 +129,340 @@ func doOutput(conn Connection, params Parameters) {
 				if err.Error() == "EOF" {
 					return
 				} else {
-					fmt.Printf("Error receiving output: %s\n", err)
-					return
+					fail(p, cmd.Id, fmt.Errorf("error receiving output: %v", err))
 				}	
 			}
-			fmt.Printf("%s\n", line.Output)
+			if err := p.PrintOutput(cmd.Id, line.Output); err != nil {
+				fail(p, cmd.Id, err)
+			}
 
 		}
 	}
 }
 
-func doStatus(conn Connection, params Parameters) {
+func doStatus(conn Connection, params Parameters, p *Printer) {
 	cmd := pb.StatusRequest{
 		Id: params.Cmd[0],
 	}
 	resp, err := conn.Client.Status(conn.Ctx, &cmd)
 	if err != nil {
-		fmt.Printf("Executing start command failed: %s\n", err)
-		os.Exit(1)
+		fail(p, cmd.Id, err)
 	}
-
-	fmt.Printf("Job ID: %s\nCommand: %s\n Args: %v\n Status: %s\n Exit code: %d\n", resp.Id, resp.Cmd, resp.State, resp.Args, resp.Exit)
+	printResult(p, newStatusResult(resp))
 }
-func doStop(conn Connection, params Parameters) {
+
+func doStop(conn Connection, params Parameters, p *Printer) {
 	cmd := pb.StopRequest{
 		Id: params.Cmd[0],
 	}
 	resp, err := conn.Client.Stop(conn.Ctx, &cmd)
 	if err != nil {
-		fmt.Printf("Executing start command failed: %s\n", err)
-		os.Exit(1)
+		fail(p, cmd.Id, err)
 	}
+	printResult(p, idResult{ID: resp.Id})
+}
 
-	fmt.Printf("Job ID: %s stopped\n", resp.Id)
+func doStart(conn Connection, params Parameters, p *Printer) {
+	cmd, err := startRequest(params)
+	if err != nil {
+		fail(p, "", err)
+	}
+	resp, err := conn.Client.Start(conn.Ctx, cmd)
+	if err != nil {
+		fail(p, "", err)
+	}
+	printResult(p, idResult{ID: resp.Id})
 }
 
-func doStart(conn Connection, params Parameters) {
-	cmd := pb.StartRequest{
-		Command: params.Cmd[0],
-		Args: params.Cmd[1:],
+func doSchedule(conn Connection, params Parameters, p *Printer) {
+	cmd, err := scheduleRequest(params)
+	if err != nil {
+		fail(p, "", err)
+	}
+	resp, err := conn.Client.Schedule(conn.Ctx, cmd)
+	if err != nil {
+		fail(p, "", err)
+	}
+	printResult(p, scheduleResult{ID: resp.Id, NextRun: formatTime(resp.NextRun)})
+}
+
+func doSchedules(conn Connection, params Parameters, p *Printer) {
+	resp, err := conn.Client.ListSchedules(conn.Ctx, &pb.ListSchedulesRequest{})
+	if err != nil {
+		fail(p, "", err)
+	}
+	var schedules []record
+	for _, s := range resp.Schedules {
+		schedules = append(schedules, newScheduleInfoResult(s))
 	}
+	if err := p.PrintList(schedules); err != nil {
+		fail(p, "", err)
+	}
+}
 
-	resp, err := conn.Client.Start(conn.Ctx, &cmd)
+func doUnschedule(conn Connection, params Parameters, p *Printer) {
+	resp, err := conn.Client.DeleteSchedule(conn.Ctx, &pb.DeleteScheduleRequest{Id: params.Cmd[0]})
 	if err != nil {
-		fmt.Printf("Executing start command failed: %s\n", err)
-		os.Exit(1)
+		fail(p, params.Cmd[0], err)
 	}
+	printResult(p, idResult{ID: resp.Id})
+}
 
-	fmt.Printf("ID: %s\n", resp)
+// doWorkflow starts the workflow in the JSON file params.Cmd[0].
+func doWorkflow(conn Connection, params Parameters, p *Printer) {
+	cmd, err := workflowRequest(params)
+	if err != nil {
+		fail(p, "", err)
+	}
+	resp, err := conn.Client.StartWorkflow(conn.Ctx, cmd)
+	if err != nil {
+		fail(p, "", err)
+	}
+	printResult(p, idResult{ID: resp.Id})
 }
 
-func (c *Connection) Done() {
-	c.conn.Close()
-	c.Cancel()
+func doWorkflowStatus(conn Connection, params Parameters, p *Printer) {
+	resp, err := conn.Client.WorkflowStatus(conn.Ctx, &pb.WorkflowStatusRequest{Id: params.Cmd[0]})
+	if err != nil {
+		fail(p, params.Cmd[0], err)
+	}
+	printResult(p, newWorkflowResult(resp))
 }
 
-func argParse() Parameters {
+func doWorkflowStop(conn Connection, params Parameters, p *Printer) {
+	resp, err := conn.Client.StopWorkflow(conn.Ctx, &pb.StopWorkflowRequest{Id: params.Cmd[0]})
+	if err != nil {
+		fail(p, params.Cmd[0], err)
+	}
+	printResult(p, idResult{ID: resp.Id})
+}
 
-	port := flag.Int("port", 50051, "remote port to connect to")
-	host := flag.String("host", "127.0.0.1", "remote host to connect to")
-	ident := flag.String("ident", "", "config file with paths to ssl certs and keys (required)")
-	help := flag.Bool("help", false, "print help")
-	flag.Parse()
-	args := flag.Args()
+func doJobs(conn Connection, params Parameters, p *Printer) {
+	cmd, err := listJobsRequest(params)
+	if err != nil {
+		fail(p, "", err)
+	}
+	resp, err := conn.Client.ListJobs(conn.Ctx, cmd)
+	if err != nil {
+		fail(p, "", err)
+	}
+	var jobs []record
+	for _, job := range resp.Jobs {
+		jobs = append(jobs, newJobResult(job))
+	}
+	if err := p.PrintList(jobs); err != nil {
+		fail(p, "", err)
+	}
+}
 
+func doDrain(conn Connection, params Parameters, p *Printer) {
+	resp, err := conn.Client.Drain(conn.Ctx, &pb.DrainRequest{})
+	if err != nil {
+		fail(p, "", err)
+	}
+	printResult(p, drainResult{Running: resp.Running, Pending: resp.Pending})
+}
 
-	params := Parameters{
-		Port:  *port,
-		Host:  *host,
-		Ident: *ident,
-		Help:  *help,
+func doPing(conn Connection, params Parameters, p *Printer) {
+	start := time.Now()
+	resp, err := conn.Client.Health(conn.Ctx, &pb.HealthRequest{})
+	if err != nil {
+		fail(p, "", err)
 	}
+	printResult(p, pingResult{
+		Version:   resp.Version,
+		Uptime:    formatUptime(resp.UptimeSeconds),
+		Ready:     resp.Ready,
+		LatencyMs: time.Since(start).Milliseconds(),
+	})
+}
 
-	if len(args) == 0 {
-		printSubCommandsHelp()
-		fmt.Println("Valid parameters for all subcommands")
-		flag.PrintDefaults()
-		os.Exit(1)
+// doHealth prints the health of the agent and exits with status 1 when it
+// is not ready.
+func doHealth(conn Connection, params Parameters, p *Printer) {
+	resp, err := conn.Client.Health(conn.Ctx, &pb.HealthRequest{})
+	if err != nil {
+		fail(p, "", err)
 	}
-	params.SubCmd = args[0]
-	if args[1] == "--" {
-		params.Cmd = args[2:]
-	} else {
-		params.Cmd = args[1:]
+	printResult(p, newHealthResult(resp))
+	if !resp.Ready {
+		exit(1)
+	}
+}
+
+// printResult prints the result of a subcommand.
+func printResult(p *Printer, r record) {
+	if err := p.Print(r); err != nil {
+		fmt.Fprintf(os.Stderr, "Printing result failed: %s\n", err)
+		exit(1)
+	}
+}
+
+// fail prints the error of a request about the command id and exits.
+func fail(p *Printer, id string, err error) {
+	msg := err.Error()
+	if perr := p.Print(idResult{ID: id, Error: &msg}); perr != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", msg)
 	}
-	return params
+	commandSpan.RecordError(err)
+	exit(1)
 }
 
-func printOptions() {
-	fmt.Print("\nOptions:\n\n")
-	flag.PrintDefaults()
-	configHelp := `
-Where -ident is the path to a JSON file with information about SSL certs and keys:
-{
-	"ca-cert": "<path to self-signed CA certificate>",
-	"public-key": "<path to host's public key>",
-	"host-cert": "<path to host cert signed by 'ca-cert'">
+// formatTime formats a unix time, 0 meaning never.
+func formatTime(t int64) string {
+	if t == 0 {
+		return "never"
+	}
+	return time.Unix(t, 0).Format(time.RFC3339)
+}
+
+// startRequest builds the request to start params.Cmd.
+func startRequest(params Parameters) (*pb.StartRequest, error) {
+	cmd := pb.StartRequest{
+		Command: params.Cmd[0],
+		Args: params.Cmd[1:],
+		OutputLimit: params.OutputLimit,
+		Owner: params.Owner,
+		Priority: int32(params.Priority),
+		IdempotencyKey: params.IdempotencyKey,
+	}
+	if params.OutputLimit < 0 {
+		return nil, fmt.Errorf("invalid output limit %d, must not be negative", params.OutputLimit)
+	}
+	switch params.OutputLimitMode {
+	case "":
+	case "kill":
+		cmd.OutputLimitMode = pb.OutputLimitMode_LIMIT_KILL
+	case "ring":
+		cmd.OutputLimitMode = pb.OutputLimitMode_LIMIT_RING
+	default:
+		return nil, fmt.Errorf("invalid output limit mode %q, must be kill or ring", params.OutputLimitMode)
+	}
+	if params.SecretArgs != "" {
+		for _, pos := range strings.Split(params.SecretArgs, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(pos))
+			if err != nil {
+				return nil, fmt.Errorf("invalid secret argument %q: %v", pos, err)
+			}
+			if n < 1 || n > len(cmd.Args) {
+				return nil, fmt.Errorf("invalid secret argument %d, the command has %d arguments", n, len(cmd.Args))
+			}
+			cmd.SecretArgs = append(cmd.SecretArgs, int32(n-1))
+		}
+	}
+	if params.MaxAttempts < 1 {
+		return nil, fmt.Errorf("invalid max attempts %d, must be at least 1", params.MaxAttempts)
+	}
+	if params.MaxAttempts > 1 {
+		retry, err := retryPolicy(params)
+		if err != nil {
+			return nil, err
+		}
+		cmd.Retry = retry
+	}
+	return &cmd, nil
+}
+
+// retryPolicy builds the retry settings of a start request.
+func retryPolicy(params Parameters) (*pb.RetryPolicy, error) {
+	retry := pb.RetryPolicy{
+		MaxAttempts: int32(params.MaxAttempts),
+		BackoffMs: params.Backoff.Milliseconds(),
+		MaxBackoffMs: params.MaxBackoff.Milliseconds(),
+	}
+	if params.Backoff < 0 || params.MaxBackoff < 0 {
+		return nil, fmt.Errorf("invalid backoff, must not be negative")
+	}
+	switch params.BackoffPolicy {
+	case "fixed":
+	case "exponential":
+		retry.BackoffPolicy = pb.BackoffPolicy_BACKOFF_EXPONENTIAL
+	default:
+		return nil, fmt.Errorf("invalid backoff policy %q, must be fixed or exponential", params.BackoffPolicy)
+	}
+	if params.RetryExitCodes != "" {
+		for _, code := range strings.Split(params.RetryExitCodes, ",") {
+			c, err := strconv.Atoi(strings.TrimSpace(code))
+			if err != nil {
+				return nil, fmt.Errorf("invalid retry exit code %q: %v", code, err)
+			}
+			retry.RetryableExitCodes = append(retry.RetryableExitCodes, int32(c))
+		}
+	}
+	return &retry, nil
+}
+
+// scheduleRequest builds the request to schedule params.Cmd.
+func scheduleRequest(params Parameters) (*pb.ScheduleRequest, error) {
+	start, err := startRequest(params)
+	if err != nil {
+		return nil, err
+	}
+	cmd := pb.ScheduleRequest{
+		Start: start,
+		Cron: params.Cron,
+	}
+	if (params.Cron == "") == (params.At == "") {
+		return nil, fmt.Errorf("schedule needs either -cron or -at")
+	}
+	if params.Cron != "" {
+		if _, err := cron.ParseStandard(params.Cron); err != nil {
+			return nil, fmt.Errorf("invalid -cron expression %q: %v", params.Cron, err)
+		}
+	}
+	if params.At != "" {
+		at, err := time.Parse(time.RFC3339, params.At)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -at time %q, must be RFC3339, e.g. 2006-01-02T15:04:05Z: %v", params.At, err)
+		}
+		cmd.RunAt = at.Unix()
+	}
+	return &cmd, nil
+}
+
+// workflowRequest reads the workflow in the JSON file params.Cmd[0].
+func workflowRequest(params Parameters) (*pb.WorkflowRequest, error) {
+	data, err := os.ReadFile(params.Cmd[0])
+	if err != nil {
+		return nil, fmt.Errorf("reading workflow failed: %v", err)
+	}
+	var cmd pb.WorkflowRequest
+	if err := protojson.Unmarshal(data, &cmd); err != nil {
+		return nil, fmt.Errorf("invalid workflow %s: %v", params.Cmd[0], err)
+	}
+	for _, step := range cmd.Steps {
+		if step.Start != nil && step.Start.Owner == "" {
+			step.Start.Owner = params.Owner
+		}
+	}
+	return &cmd, nil
 }
 
-`
-	fmt.Print(configHelp)
-	fmt.Println("")
+// listJobsRequest builds the request to list the jobs of params.Owner, or
+// of all owners with -all.
+func listJobsRequest(params Parameters) (*pb.ListJobsRequest, error) {
+	if params.Limit < 0 {
+		return nil, fmt.Errorf("invalid limit %d, must not be negative", params.Limit)
+	}
+	cmd := pb.ListJobsRequest{Limit: int32(params.Limit)}
+	if !params.All {
+		cmd.Owner = params.Owner
+	}
+	if params.States != "" {
+		for _, name := range strings.Split(params.States, ",") {
+			state, ok := stateByName(strings.TrimSpace(name))
+			if !ok {
+				return nil, fmt.Errorf("invalid state %q, must be pending, running, completed, stopped or error", name)
+			}
+			cmd.States = append(cmd.States, state)
+		}
+	}
+	return &cmd, nil
 }
 
-func printSubCommandsHelp() {
-	fmt.Println("Valid subcommands:")
-	fmt.Println("\tstart")
-	fmt.Println("\tstop")
-	fmt.Println("\toutput")
-	fmt.Println("\tstatus\n")
-	fmt.Println("Get help for a subcommand:")
-	fmt.Println("\ttrc-client -help <subcommand>")
+func (c *Connection) Done() {
+	c.conn.Close()
+	c.Cancel()
 }
 
 func NewConnection(params Parameters) (Connection, error) {
@@ -197,10 +471,29 @@ func NewConnection(params Parameters) (Connection, error) {
 
 	url := fmt.Sprintf("%s:%d", params.Host, params.Port)
 
-	connect.conn, err = grpc.Dial(
-		url,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-	)
+	creds, err := transportCredentials(params.Ident)
+	if err != nil {
+		return connect, err
+	}
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		// passes the trace context of requests on to the agent
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+	}
+	if params.RPCRetries > 1 {
+		opts = append(opts, grpc.WithDefaultServiceConfig(retryConfig(params.RPCRetries)))
+	}
+	if params.Keepalive > 0 {
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                params.Keepalive,
+			Timeout:             20 * time.Second,
+			PermitWithoutStream: true,
+		}))
+	}
+	if params.Compress {
+		opts = append(opts, grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name)))
+	}
+	connect.conn, err = grpc.Dial(url, opts...)
 
 	if err != nil {
 		return connect, err
@@ -208,7 +501,50 @@ func NewConnection(params Parameters) (Connection, error) {
 
 	connect.Client = pb.NewAgentClient(connect.conn)
 
-	connect.Ctx, connect.Cancel = context.WithTimeout(context.Background(), time.Second)
+	timeout := params.Timeout
+	if params.SubCmd == "output" {
+		timeout = params.StreamTimeout
+	}
+	if timeout > 0 {
+		connect.Ctx, connect.Cancel = context.WithTimeout(context.Background(), timeout)
+	} else {
+		connect.Ctx, connect.Cancel = context.WithCancel(context.Background())
+	}
 
 	return connect, nil
 }
+
+// idempotentMethods are the requests that are safe to send again when the
+// agent was unavailable. Start is not, an agent with an IDEMPOTENCY_WINDOW
+// of 0 ignores the idempotency key and would run the command twice.
+var idempotentMethods = []string{"Status", "Stop", "Output", "ListSchedules", "DeleteSchedule", "WorkflowStatus", "StopWorkflow", "ListJobs", "Drain", "Health"}
+
+// retryConfig returns a gRPC service config that retries the idempotent
+// requests with exponential backoff while the agent is unavailable.
+func retryConfig(attempts int) string {
+	type method struct {
+		Service string `json:"service"`
+		Method  string `json:"method"`
+	}
+	names := make([]method, 0, len(idempotentMethods))
+	for _, m := range idempotentMethods {
+		names = append(names, method{Service: "cmd.Agent", Method: m})
+	}
+	conf := map[string]any{
+		"methodConfig": []map[string]any{{
+			"name": names,
+			"retryPolicy": map[string]any{
+				"maxAttempts":          attempts,
+				"initialBackoff":       "0.5s",
+				"maxBackoff":           "10s",
+				"backoffMultiplier":    2,
+				"retryableStatusCodes": []string{"UNAVAILABLE"},
+			},
+		}},
+	}
+	data, err := json.Marshal(conf)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestRetryConfig(t *testing.T) {
+	var conf struct {
+		MethodConfig []struct {
+			Name []struct {
+				Service string `json:"service"`
+				Method  string `json:"method"`
+			} `json:"name"`
+			RetryPolicy struct {
+				MaxAttempts          int      `json:"maxAttempts"`
+				InitialBackoff       string   `json:"initialBackoff"`
+				MaxBackoff           string   `json:"maxBackoff"`
+				BackoffMultiplier    float64  `json:"backoffMultiplier"`
+				RetryableStatusCodes []string `json:"retryableStatusCodes"`
+			} `json:"retryPolicy"`
+		} `json:"methodConfig"`
+	}
+	if err := json.Unmarshal([]byte(retryConfig(3)), &conf); err != nil {
+		t.Fatalf("retryConfig() is not valid JSON: %v", err)
+	}
+	if len(conf.MethodConfig) != 1 {
+		t.Fatalf("retryConfig() has %d method configs, want 1", len(conf.MethodConfig))
+	}
+	mc := conf.MethodConfig[0]
+	var methods []string
+	for _, name := range mc.Name {
+		if name.Service != "cmd.Agent" {
+			t.Errorf("method %s of service %q, want cmd.Agent", name.Method, name.Service)
+		}
+		methods = append(methods, name.Method)
+	}
+	if !slices.Equal(methods, idempotentMethods) {
+		t.Errorf("retried methods = %v, want %v", methods, idempotentMethods)
+	}
+	// a start request is not safe to repeat when the agent ignores keys
+	for _, m := range []string{"Start", "Schedule", "StartWorkflow"} {
+		if slices.Contains(methods, m) {
+			t.Errorf("%s is retried", m)
+		}
+	}
+	p := mc.RetryPolicy
+	if p.MaxAttempts != 3 || p.InitialBackoff != "0.5s" || p.MaxBackoff != "10s" || p.BackoffMultiplier != 2 {
+		t.Errorf("retry policy = %+v, want 3 attempts backing off from 0.5s to 10s", p)
+	}
+	if !slices.Equal(p.RetryableStatusCodes, []string{"UNAVAILABLE"}) {
+		t.Errorf("retryable codes = %v, want only UNAVAILABLE", p.RetryableStatusCodes)
+	}
+}
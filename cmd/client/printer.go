@@ -0,0 +1,539 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	pb "github.com/stewyb314/remote-control/protos"
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats of the -output option.
+const (
+	FormatJSON  = "json"
+	FormatYAML  = "yaml"
+	FormatTable = "table"
+	FormatText  = "text"
+)
+
+// record is a result printed by a subcommand. json and yaml print the record
+// itself, so its field tags are the stable names automation relies on.
+// table and text print its fields in order.
+type record interface {
+	fields() []field
+}
+
+type field struct {
+	name  string
+	value any
+}
+
+// Printer prints the results of all subcommands in one output format.
+type Printer struct {
+	format string
+	out    io.Writer
+}
+
+func NewPrinter(format string, out io.Writer) (*Printer, error) {
+	switch format {
+	case FormatJSON, FormatYAML, FormatTable, FormatText:
+	default:
+		return nil, fmt.Errorf("invalid output format %q, must be json, yaml, table or text", format)
+	}
+	return &Printer{format: format, out: out}, nil
+}
+
+// Print prints a single record.
+func (p *Printer) Print(r record) error {
+	switch p.format {
+	case FormatJSON:
+		return p.json(r)
+	case FormatYAML:
+		return yaml.NewEncoder(p.out).Encode(r)
+	case FormatTable:
+		return p.table([]record{r})
+	default:
+		return p.text(r, "")
+	}
+}
+
+// PrintList prints a list of records, as an array for json and yaml and
+// one row per record for table.
+func (p *Printer) PrintList(rs []record) error {
+	switch p.format {
+	case FormatJSON:
+		if rs == nil {
+			rs = []record{}
+		}
+		return p.json(rs)
+	case FormatYAML:
+		if rs == nil {
+			rs = []record{}
+		}
+		return yaml.NewEncoder(p.out).Encode(rs)
+	case FormatTable:
+		return p.table(rs)
+	default:
+		for i, r := range rs {
+			if i > 0 {
+				fmt.Fprintln(p.out)
+			}
+			if err := p.text(r, ""); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// PrintOutput prints a line of a command's output, as a JSON object per
+// line for json and as it is otherwise.
+func (p *Printer) PrintOutput(id string, line []byte) error {
+	if p.format == FormatJSON {
+		data, err := json.Marshal(outputLine{ID: id, Output: string(line)})
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(p.out, "%s\n", data)
+		return err
+	}
+	_, err := fmt.Fprintf(p.out, "%s\n", line)
+	return err
+}
+
+func (p *Printer) json(v any) error {
+	enc := json.NewEncoder(p.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// table prints the records as rows under a header of their field names.
+// Nested lists of records follow as tables of their own.
+func (p *Printer) table(rs []record) error {
+	if len(rs) == 0 {
+		return nil
+	}
+	w := tabwriter.NewWriter(p.out, 0, 4, 2, ' ', 0)
+	var nested [][]record
+	var names []string
+	for _, f := range rs[0].fields() {
+		if _, ok := f.value.([]record); !ok {
+			names = append(names, strings.ToUpper(f.name))
+		}
+	}
+	fmt.Fprintln(w, strings.Join(names, "\t"))
+	for _, r := range rs {
+		var values []string
+		for _, f := range r.fields() {
+			if sub, ok := f.value.([]record); ok {
+				nested = append(nested, sub)
+				continue
+			}
+			values = append(values, formatValue(f.value))
+		}
+		fmt.Fprintln(w, strings.Join(values, "\t"))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	for _, sub := range nested {
+		fmt.Fprintln(p.out)
+		if err := p.table(sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// text prints one "name: value" line per field, nested records indented
+// and each started with a dash.
+func (p *Printer) text(r record, indent string) error {
+	lead := indent
+	if strings.HasSuffix(indent, "  ") {
+		lead = indent[:len(indent)-2] + "- "
+	}
+	for i, f := range r.fields() {
+		prefix := indent
+		if i == 0 {
+			prefix = lead
+		}
+		sub, ok := f.value.([]record)
+		if !ok {
+			fmt.Fprintf(p.out, "%s%s: %s\n", prefix, f.name, formatValue(f.value))
+			continue
+		}
+		fmt.Fprintf(p.out, "%s%s:\n", prefix, f.name)
+		for _, s := range sub {
+			if err := p.text(s, indent+"    "); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case *string:
+		if v == nil {
+			return "-"
+		}
+		return *v
+	case []string:
+		if len(v) == 0 {
+			return "-"
+		}
+		return strings.Join(v, " ")
+	case string:
+		if v == "" {
+			return "-"
+		}
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// stateName returns the status name of a command's state.
+func stateName(state pb.State) string {
+	switch state {
+	case pb.State_COMPLETE:
+		return "completed"
+	case pb.State_STOPPED:
+		return "stopped"
+	case pb.State_ERROR:
+		return "error"
+	case pb.State_RUNNING:
+		return "running"
+	case pb.State_PENDING:
+		return "pending"
+	default:
+		return "unknown"
+	}
+}
+
+// stateByName returns the state of a status name.
+func stateByName(name string) (pb.State, bool) {
+	for _, state := range []pb.State{pb.State_COMPLETE, pb.State_STOPPED, pb.State_ERROR, pb.State_RUNNING, pb.State_PENDING} {
+		if stateName(state) == name {
+			return state, true
+		}
+	}
+	return pb.State_UNKNOWN, false
+}
+
+// idResult is the result of requests that only return an ID, such as start
+// and stop, and of failed requests.
+type idResult struct {
+	ID    string  `json:"id" yaml:"id"`
+	Error *string `json:"error" yaml:"error"`
+}
+
+func (r idResult) fields() []field {
+	return []field{{"id", r.ID}, {"error", r.Error}}
+}
+
+type statusResult struct {
+	ID            string   `json:"id" yaml:"id"`
+	Status        string   `json:"status" yaml:"status"`
+	ExitStatus    int32    `json:"exit_status" yaml:"exit_status"`
+	Error         *string  `json:"error" yaml:"error"`
+	Command       string   `json:"command" yaml:"command"`
+	Args          []string `json:"args" yaml:"args"`
+	Truncated     bool     `json:"truncated" yaml:"truncated"`
+	QueuePosition int32    `json:"queue_position" yaml:"queue_position"`
+	ScheduleID    string   `json:"schedule_id" yaml:"schedule_id"`
+	WorkflowID    string   `json:"workflow_id" yaml:"workflow_id"`
+	Attempt       int32    `json:"attempt" yaml:"attempt"`
+	AttemptIDs    []string `json:"attempt_ids" yaml:"attempt_ids"`
+}
+
+func newStatusResult(resp *pb.StatusResponse) statusResult {
+	r := statusResult{
+		ID:            resp.Id,
+		Status:        stateName(resp.State),
+		ExitStatus:    resp.Exit,
+		Command:       resp.Cmd,
+		Args:          resp.Args,
+		Truncated:     resp.Truncated,
+		QueuePosition: resp.QueuePosition,
+		ScheduleID:    resp.ScheduleId,
+		WorkflowID:    resp.WorkflowId,
+		Attempt:       resp.Attempt,
+		AttemptIDs:    resp.AttemptIds,
+	}
+	if resp.State == pb.State_ERROR {
+		msg := "the command failed to start"
+		if resp.Error != "" {
+			msg = resp.Error
+		}
+		r.Error = &msg
+	}
+	if r.Args == nil {
+		r.Args = []string{}
+	}
+	if r.AttemptIDs == nil {
+		r.AttemptIDs = []string{}
+	}
+	return r
+}
+
+func (r statusResult) fields() []field {
+	return []field{
+		{"id", r.ID},
+		{"status", r.Status},
+		{"exit_status", r.ExitStatus},
+		{"error", r.Error},
+		{"command", r.Command},
+		{"args", r.Args},
+		{"truncated", r.Truncated},
+		{"queue_position", r.QueuePosition},
+		{"schedule_id", r.ScheduleID},
+		{"workflow_id", r.WorkflowID},
+		{"attempt", r.Attempt},
+		{"attempt_ids", r.AttemptIDs},
+	}
+}
+
+type outputLine struct {
+	ID     string `json:"id"`
+	Output string `json:"output"`
+}
+
+type scheduleResult struct {
+	ID      string  `json:"id" yaml:"id"`
+	NextRun string  `json:"next_run" yaml:"next_run"`
+	Error   *string `json:"error" yaml:"error"`
+}
+
+func (r scheduleResult) fields() []field {
+	return []field{{"id", r.ID}, {"next_run", r.NextRun}, {"error", r.Error}}
+}
+
+// drainResult is the result of drain, the jobs the agent still has.
+type drainResult struct {
+	Running int32 `json:"running" yaml:"running"`
+	Pending int32 `json:"pending" yaml:"pending"`
+}
+
+func (r drainResult) fields() []field {
+	return []field{{"running", r.Running}, {"pending", r.Pending}}
+}
+
+// pingResult is the result of ping, whether the agent answers and how fast.
+type pingResult struct {
+	Version   string `json:"version" yaml:"version"`
+	Uptime    string `json:"uptime" yaml:"uptime"`
+	Ready     bool   `json:"ready" yaml:"ready"`
+	LatencyMs int64  `json:"latency_ms" yaml:"latency_ms"`
+}
+
+func (r pingResult) fields() []field {
+	return []field{{"version", r.Version}, {"uptime", r.Uptime}, {"ready", r.Ready}, {"latency_ms", r.LatencyMs}}
+}
+
+// healthResult is the result of health. Error lists why the agent is not
+// ready.
+type healthResult struct {
+	Version  string          `json:"version" yaml:"version"`
+	Uptime   string          `json:"uptime" yaml:"uptime"`
+	Ready    bool            `json:"ready" yaml:"ready"`
+	Draining bool            `json:"draining" yaml:"draining"`
+	Running  int32           `json:"running" yaml:"running"`
+	Pending  int32           `json:"pending" yaml:"pending"`
+	Error    *string         `json:"error" yaml:"error"`
+	Backends []backendResult `json:"backends" yaml:"backends"`
+}
+
+type backendResult struct {
+	Name      string `json:"name" yaml:"name"`
+	OK        bool   `json:"ok" yaml:"ok"`
+	Error     string `json:"error" yaml:"error"`
+	LatencyMs int64  `json:"latency_ms" yaml:"latency_ms"`
+}
+
+func newHealthResult(resp *pb.HealthResponse) healthResult {
+	r := healthResult{
+		Version:  resp.Version,
+		Uptime:   formatUptime(resp.UptimeSeconds),
+		Ready:    resp.Ready,
+		Draining: resp.Draining,
+		Running:  resp.Running,
+		Pending:  resp.Pending,
+		Backends: []backendResult{},
+	}
+	var problems []string
+	if resp.Draining {
+		problems = append(problems, "draining")
+	}
+	for _, b := range resp.Backends {
+		r.Backends = append(r.Backends, backendResult{Name: b.Name, OK: b.Ok, Error: b.Error, LatencyMs: b.LatencyMs})
+		if !b.Ok {
+			problems = append(problems, b.Name+": "+b.Error)
+		}
+	}
+	if !resp.Ready {
+		msg := "not ready: " + strings.Join(problems, ", ")
+		r.Error = &msg
+	}
+	return r
+}
+
+func (r healthResult) fields() []field {
+	backends := make([]record, 0, len(r.Backends))
+	for _, b := range r.Backends {
+		backends = append(backends, b)
+	}
+	return []field{
+		{"version", r.Version},
+		{"uptime", r.Uptime},
+		{"ready", r.Ready},
+		{"draining", r.Draining},
+		{"running", r.Running},
+		{"pending", r.Pending},
+		{"error", r.Error},
+		{"backends", backends},
+	}
+}
+
+func (r backendResult) fields() []field {
+	return []field{{"name", r.Name}, {"ok", r.OK}, {"error", r.Error}, {"latency_ms", r.LatencyMs}}
+}
+
+// formatUptime formats seconds as a duration, e.g. 26h3m5s.
+func formatUptime(seconds int64) string {
+	return (time.Duration(seconds) * time.Second).String()
+}
+
+type scheduleInfoResult struct {
+	ID      string   `json:"id" yaml:"id"`
+	Command string   `json:"command" yaml:"command"`
+	Args    []string `json:"args" yaml:"args"`
+	Cron    string   `json:"cron" yaml:"cron"`
+	RunAt   string   `json:"run_at" yaml:"run_at"`
+	NextRun string   `json:"next_run" yaml:"next_run"`
+	LastRun string   `json:"last_run" yaml:"last_run"`
+	LastID  string   `json:"last_id" yaml:"last_id"`
+}
+
+func newScheduleInfoResult(s *pb.ScheduleInfo) scheduleInfoResult {
+	r := scheduleInfoResult{
+		ID:      s.Id,
+		Command: s.Cmd,
+		Args:    s.Args,
+		Cron:    s.Cron,
+		NextRun: formatTime(s.NextRun),
+		LastRun: formatTime(s.LastRun),
+		LastID:  s.LastId,
+	}
+	if s.RunAt != 0 {
+		r.RunAt = formatTime(s.RunAt)
+	}
+	if r.Args == nil {
+		r.Args = []string{}
+	}
+	return r
+}
+
+func (r scheduleInfoResult) fields() []field {
+	return []field{
+		{"id", r.ID},
+		{"command", r.Command},
+		{"args", r.Args},
+		{"cron", r.Cron},
+		{"run_at", r.RunAt},
+		{"next_run", r.NextRun},
+		{"last_run", r.LastRun},
+		{"last_id", r.LastID},
+	}
+}
+
+type workflowResult struct {
+	ID     string       `json:"id" yaml:"id"`
+	Name   string       `json:"name" yaml:"name"`
+	Status string       `json:"status" yaml:"status"`
+	Error  *string      `json:"error" yaml:"error"`
+	Steps  []stepResult `json:"steps" yaml:"steps"`
+}
+
+type stepResult struct {
+	Name       string `json:"name" yaml:"name"`
+	ID         string `json:"id" yaml:"id"`
+	Status     string `json:"status" yaml:"status"`
+	ExitStatus int32  `json:"exit_status" yaml:"exit_status"`
+}
+
+func newWorkflowResult(resp *pb.WorkflowStatusResponse) workflowResult {
+	r := workflowResult{
+		ID:     resp.Id,
+		Name:   resp.Name,
+		Status: stateName(resp.State),
+		Steps:  []stepResult{},
+	}
+	if resp.State == pb.State_ERROR {
+		msg := "a step failed"
+		r.Error = &msg
+	}
+	for _, step := range resp.Steps {
+		status := stateName(step.State)
+		if step.Skipped {
+			status = "skipped"
+		}
+		r.Steps = append(r.Steps, stepResult{Name: step.Name, ID: step.Id, Status: status, ExitStatus: step.Exit})
+	}
+	return r
+}
+
+func (r workflowResult) fields() []field {
+	steps := make([]record, 0, len(r.Steps))
+	for _, step := range r.Steps {
+		steps = append(steps, step)
+	}
+	return []field{{"id", r.ID}, {"name", r.Name}, {"status", r.Status}, {"error", r.Error}, {"steps", steps}}
+}
+
+func (r stepResult) fields() []field {
+	return []field{{"name", r.Name}, {"id", r.ID}, {"status", r.Status}, {"exit_status", r.ExitStatus}}
+}
+
+type jobResult struct {
+	ID         string   `json:"id" yaml:"id"`
+	Status     string   `json:"status" yaml:"status"`
+	ExitStatus int32    `json:"exit_status" yaml:"exit_status"`
+	Command    string   `json:"command" yaml:"command"`
+	Args       []string `json:"args" yaml:"args"`
+	Owner      string   `json:"owner" yaml:"owner"`
+	Started    string   `json:"started" yaml:"started"`
+}
+
+func newJobResult(job *pb.JobInfo) jobResult {
+	r := jobResult{
+		ID:         job.Id,
+		Status:     stateName(job.State),
+		ExitStatus: job.Exit,
+		Command:    job.Cmd,
+		Args:       job.Args,
+		Owner:      job.Owner,
+		Started:    formatTime(job.CreatedAt),
+	}
+	if r.Args == nil {
+		r.Args = []string{}
+	}
+	return r
+}
+
+func (r jobResult) fields() []field {
+	return []field{
+		{"id", r.ID},
+		{"status", r.Status},
+		{"exit_status", r.ExitStatus},
+		{"command", r.Command},
+		{"args", r.Args},
+		{"owner", r.Owner},
+		{"started", r.Started},
+	}
+}
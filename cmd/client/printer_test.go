@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	pb "github.com/stewyb314/remote-control/protos"
+	"gopkg.in/yaml.v3"
+)
+
+// stableNames are the names of status results automation relies on.
+var stableNames = []string{"id", "status", "exit_status", "error"}
+
+func printStatus(t *testing.T, format string) string {
+	t.Helper()
+	var out bytes.Buffer
+	p, err := NewPrinter(format, &out)
+	if err != nil {
+		t.Fatalf("NewPrinter(%s) = %v", format, err)
+	}
+	resp := &pb.StatusResponse{Id: "job-1", State: pb.State_ERROR, Exit: 127, Cmd: "missing"}
+	if err := p.Print(newStatusResult(resp)); err != nil {
+		t.Fatalf("Print() = %v", err)
+	}
+	return out.String()
+}
+
+func TestPrinterStableNames(t *testing.T) {
+	want := map[string]any{
+		"id":          "job-1",
+		"status":      "error",
+		"exit_status": float64(127),
+		"error":       "the command failed to start",
+	}
+	for format, unmarshal := range map[string]func([]byte, any) error{
+		FormatJSON: json.Unmarshal,
+		FormatYAML: yaml.Unmarshal,
+	} {
+		var got map[string]any
+		if err := unmarshal([]byte(printStatus(t, format)), &got); err != nil {
+			t.Fatalf("%s output does not parse: %v", format, err)
+		}
+		for _, name := range stableNames {
+			value := got[name]
+			if n, ok := value.(int); ok {
+				value = float64(n)
+			}
+			if value != want[name] {
+				t.Errorf("%s %s = %#v, want %#v", format, name, got[name], want[name])
+			}
+		}
+	}
+
+	header := strings.Fields(strings.SplitN(printStatus(t, FormatTable), "\n", 2)[0])
+	for i, name := range stableNames {
+		if i >= len(header) || header[i] != strings.ToUpper(name) {
+			t.Errorf("table header = %v, want it to start with %v", header, stableNames)
+			break
+		}
+	}
+
+	text := printStatus(t, FormatText)
+	for _, line := range []string{"id: job-1", "status: error", "exit_status: 127", "error: the command failed to start"} {
+		if !strings.Contains(text, line+"\n") {
+			t.Errorf("text output %q has no line %q", text, line)
+		}
+	}
+}
+
+func TestPrinterEmptyList(t *testing.T) {
+	for format, want := range map[string]string{FormatJSON: "[]\n", FormatYAML: "[]\n", FormatTable: "", FormatText: ""} {
+		var out bytes.Buffer
+		p, err := NewPrinter(format, &out)
+		if err != nil {
+			t.Fatalf("NewPrinter(%s) = %v", format, err)
+		}
+		if err := p.PrintList(nil); err != nil {
+			t.Fatalf("PrintList() = %v", err)
+		}
+		if out.String() != want {
+			t.Errorf("%s of an empty list = %q, want %q", format, out.String(), want)
+		}
+	}
+}
+
+func TestPrinterInvalidFormat(t *testing.T) {
+	if _, err := NewPrinter("xml", &bytes.Buffer{}); err == nil {
+		t.Errorf("NewPrinter(xml) succeeded")
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/stewyb314/remote-control/internal/config"
+	"github.com/stewyb314/remote-control/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// flushTimeout bounds exporting the client's spans before it exits.
+const flushTimeout = 5 * time.Second
+
+// commandSpan is the span of the subcommand that runs, ended by exit
+// together with flushing the spans by shutdownTracing.
+var (
+	commandSpan     = trace.SpanFromContext(context.Background())
+	shutdownTracing = func(context.Context) error { return nil }
+)
+
+// startTracing exports the client's spans as the parameters select and
+// starts the span of the subcommand name. The agent continues the trace
+// of the requests made in the returned context.
+func startTracing(params Parameters, name string) (context.Context, error) {
+	shutdown, err := tracing.Setup(context.Background(), "trc-client", config.TracingConfig{
+		OTLPEndpoint: params.OTLPEndpoint,
+		OTLPInsecure: params.OTLPInsecure,
+		File:         params.TraceFile,
+		SampleRatio:  1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	shutdownTracing = shutdown
+	ctx, span := tracing.Tracer().Start(context.Background(), "trc-client "+name,
+		trace.WithAttributes(attribute.String("server.address", params.Host), attribute.Int("server.port", params.Port)))
+	commandSpan = span
+	return ctx, nil
+}
+
+// exit ends the subcommand's span, flushes the spans and exits with code.
+func exit(code int) {
+	if code != 0 {
+		commandSpan.SetStatus(codes.Error, fmt.Sprintf("exit status %d", code))
+	}
+	commandSpan.End()
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Exporting traces failed: %s\n", err)
+	}
+	os.Exit(code)
+}
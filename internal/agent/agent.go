@@ -1,19 +1,34 @@
 package agent
 
 import (
-	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net"
-	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/stewyb314/remote-control/internal/config"
 	"github.com/stewyb314/remote-control/internal/db"
+	"github.com/stewyb314/remote-control/internal/logging"
+	"github.com/stewyb314/remote-control/internal/metrics"
+	"github.com/stewyb314/remote-control/internal/output"
 	"github.com/stewyb314/remote-control/internal/services"
 	pb "github.com/stewyb314/remote-control/protos"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	// registers the gzip compressor so clients can request compressed
+	// responses, e.g. for large output streams
+	_ "google.golang.org/grpc/encoding/gzip"
 )
 
 type Agent struct {
@@ -22,60 +37,173 @@ type Agent struct {
 	addr string
 	port int
 	tlsCredentials credentials.TransportCredentials
+	keepalive config.KeepaliveConfig
 	jobs *services.Jobs
+	scheduler *services.Scheduler
+	workflows *services.Workflows
 	db db.DB
+	store output.Store
+	server *grpc.Server
+	health *health.Server
+	started time.Time
+	// done is closed when the agent shuts down
+	done chan struct{}
+	// healthMu guards ready, the readiness last reported
+	healthMu sync.Mutex
+	ready bool
 }
 
-func New(log *logrus.Entry, addr string, port int, tlsCredentials credentials.TransportCredentials, db db.DB, jobs *services.Jobs) *Agent {
-	return &Agent{
+const (
+	// outputPollInterval is how often Output checks a running job for new output
+	outputPollInterval = 500 * time.Millisecond
+	// maxOutputMessage caps the size of a single OutputResponse when a job
+	// writes very long lines
+	maxOutputMessage = 1024 * 1024
+	// defaultListJobs and maxListJobs bound the number of jobs ListJobs
+	// returns
+	defaultListJobs = 100
+	maxListJobs = 1000
+	// serverStopTimeout bounds the wait for RPCs still in flight, e.g.
+	// clients following output, once the jobs are done on shutdown
+	serverStopTimeout = 5 * time.Second
+)
+
+func New(log *logrus.Entry, addr string, port int, tlsCredentials credentials.TransportCredentials, keepaliveConf config.KeepaliveConfig, db db.DB, store output.Store, jobs *services.Jobs, scheduler *services.Scheduler, workflows *services.Workflows) *Agent {
+	a := &Agent{
 		log: log,
 		addr: addr,
 		port: port,
 		tlsCredentials: tlsCredentials,	
+		keepalive: keepaliveConf,
 		db: db,
+		store: store,
 		jobs: jobs,
+		scheduler: scheduler,
+		workflows: workflows,
+		health: health.NewServer(),
+		started: time.Now(),
+		done: make(chan struct{}),
 	}
+	a.server = grpc.NewServer(
+		grpc.Creds(a.tlsCredentials),
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:    a.keepalive.Time,
+			Timeout: a.keepalive.Timeout,
+		}),
+		// clients ping idle connections too, e.g. while following the
+		// output of a quiet job
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             a.keepalive.MinTime,
+			PermitWithoutStream: true,
+		}),
+		// continues the traces of clients, spans of requests without
+		// one are sampled by the agent's ratio
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		// every request logs with its own entry, see the logging package
+		grpc.ChainUnaryInterceptor(logging.UnaryServerInterceptor(log), metrics.GRPC.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(logging.StreamServerInterceptor(log), metrics.GRPC.StreamServerInterceptor()),
+	)
+	pb.RegisterAgentServer(a.server, a)
+	// not ready until the backends were checked
+	a.health.SetServingStatus(readinessService, healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(a.server, a.health)
+	// export every method, including those not called yet
+	metrics.GRPC.InitializeMetrics(a.server)
+	return a
 }
 func (a *Agent) StartAgent()  error {
-	s := grpc.NewServer(grpc.Creds(a.tlsCredentials))
-	lis, err := net.Listen("tcp", fmt.Sprintf("%s:%d", a.addr, 50051))
+	lis, err := net.Listen("tcp", net.JoinHostPort(a.addr, strconv.Itoa(a.port)))
 	if err != nil {
 		return fmt.Errorf("failed to listen: %v", err)
 	}
-	pb.RegisterAgentServer(s, a)
 	a.log.Printf("server listening at %v", lis.Addr())
-	if err := s.Serve(lis); err != nil {
+	a.checkHealth(context.Background())
+	go a.watchHealth()
+	if err := a.server.Serve(lis); err != nil {
 		return fmt.Errorf("failed to serve: %v", err)
 	}
 	return nil
 }
 
+// Shutdown stops the agent gracefully. New jobs, connections and requests
+// are refused right away while running jobs get until ctx is done to
+// finish, the ones left are stopped. Requests in flight, such as clients
+// following output, are served until they end, for at most
+// serverStopTimeout once all jobs are recorded. Then StartAgent returns.
+func (a *Agent) Shutdown(ctx context.Context) {
+	close(a.done)
+	a.health.Shutdown()
+	a.jobs.Drain()
+	a.scheduler.Stop()
+	stopped := make(chan struct{})
+	go func() {
+		a.server.GracefulStop()
+		close(stopped)
+	}()
+	a.jobs.Shutdown(ctx)
+	select {
+	case <-stopped:
+	case <-time.After(serverStopTimeout):
+		a.log.Warnf("Closing connections with RPCs still in flight")
+		a.server.Stop()
+	}
+}
+
+// logger returns the entry of the request ctx belongs to.
+func (a *Agent) logger(ctx context.Context) *logrus.Entry {
+	return logging.FromContext(ctx, a.log)
+}
+
+// owner returns the owner of jobs started by the caller of ctx: the name it
+// authenticated with, or the owner it asked for when it did not.
+func owner(ctx context.Context, requested string) string {
+	if caller := logging.Caller(ctx); caller != "" {
+		return caller
+	}
+	return requested
+}
+
 func (a *Agent) Start(ctx context.Context, in *pb.StartRequest) (*pb.StartResponse, error) {
-	a.log.Infof("Received Start request: %+v", in)
-	id, err := a.jobs.NewJob(in.Command, in.Args)
+	in.Owner = owner(ctx, in.Owner)
+	a.logger(ctx).WithFields(logrus.Fields{
+		"command": in.Command,
+		"args": a.jobs.RedactArgs(in),
+		"owner": in.Owner,
+	}).Infof("Received Start request")
+	id, err := a.jobs.NewJob(ctx, in)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new job: %v", err)
 	}
 	return &pb.StartResponse{Id: id}, nil
 }
+// Drain makes the agent refuse new jobs while the accepted ones finish.
+// Status and output are still served.
+func (a *Agent) Drain(ctx context.Context, in *pb.DrainRequest) (*pb.DrainResponse, error) {
+	a.logger(ctx).Infof("Received Drain request")
+	a.jobs.Drain()
+	a.setReady(false, "draining")
+	running, pending := a.jobs.Counts()
+	return &pb.DrainResponse{Running: int32(running), Pending: int32(pending)}, nil
+}
+
 func (a *Agent) Status(ctx context.Context, in *pb.StatusRequest) (*pb.StatusResponse, error) {
-	a.log.Infof("Received Status request for job ID: %s", in.Id)
-	exec, err := a.db.GetExecution(in.Id)
+	a.logger(ctx).Infof("Received Status request for job ID: %s", in.Id)
+	exec, err := a.db.WithContext(ctx).GetExecution(in.Id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get execution for job ID %s: %v", in.Id, err)
 	}
 	if exec == nil {
 		return nil, fmt.Errorf("no execution found for job ID %s", in.Id)
 	}
-	var argsB []byte
-	err  = exec.Args.UnmarshalJSON(argsB)
+	// a retried job reports the state of its last attempt
+	attemptIDs, exec, err := a.lastAttempt(ctx, exec)
 	if err != nil {
-		a.log.Error("failed to unmarshal args for job ID %s: %v", in.Id, err.Error())
+		return nil, err
 	}
 	var args []string
-	err = json.Unmarshal(argsB, &args)
+	err = json.Unmarshal(exec.Args, &args)
 	if err != nil {
-		a.log.Errorf("failed to unmarshal args for job ID %s: %v", in.Id, err)
+		a.logger(ctx).Errorf("failed to unmarshal args for job ID %s: %v", in.Id, err)
 	}
 
 
@@ -85,40 +213,227 @@ func (a *Agent) Status(ctx context.Context, in *pb.StatusRequest) (*pb.StatusRes
 		Exit: exec.ExitCode,
 		State: pb.State(exec.Status),
 		Args: args,
+		Truncated: exec.Truncated,
+		QueuePosition: int32(a.jobs.QueuePosition(exec.ID)),
+		ScheduleId: exec.ScheduleID,
+		WorkflowId: exec.WorkflowID,
+		Attempt: max(exec.Attempt, 1),
+		AttemptIds: attemptIDs,
+		Error: exec.Error,
 	}, nil
 }
 
+// lastAttempt returns the IDs of all attempts of a retried job and its last
+// attempt. Other jobs are returned as they are.
+func (a *Agent) lastAttempt(ctx context.Context, exec *db.Execution) ([]string, *db.Execution, error) {
+	if exec.RetryOf != "" {
+		return nil, exec, nil
+	}
+	retries, err := a.db.WithContext(ctx).ListExecutions(db.ExecutionFilter{RetryOf: exec.ID})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list attempts of job ID %s: %v", exec.ID, err)
+	}
+	if len(retries) == 0 {
+		return nil, exec, nil
+	}
+	sort.Slice(retries, func(i, j int) bool { return retries[i].Attempt < retries[j].Attempt })
+	ids := []string{exec.ID}
+	for _, retry := range retries {
+		ids = append(ids, retry.ID)
+	}
+	return ids, &retries[len(retries)-1], nil
+}
+
 func (a *Agent) Stop(ctx context.Context, in *pb.StopRequest) (*pb.StopResponse, error) {
-	a.log.Infof("Received Stop request for job ID: %s", in.Id)
-	err := a.jobs.StopJob(in.Id)
+	a.logger(ctx).Infof("Received Stop request for job ID: %s", in.Id)
+	err := a.jobs.StopJob(ctx, in.Id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to stop job with ID %s: %v", in.Id, err)
 	}
 	return &pb.StopResponse{Id: in.Id}, nil
 }
 
+func (a *Agent) Schedule(ctx context.Context, in *pb.ScheduleRequest) (*pb.ScheduleResponse, error) {
+	if in.Start != nil {
+		in.Start.Owner = owner(ctx, in.Start.Owner)
+	}
+	a.logger(ctx).WithFields(logrus.Fields{
+		"command": in.GetStart().GetCommand(),
+		"args": a.jobs.RedactArgs(in.GetStart()),
+		"owner": in.GetStart().GetOwner(),
+		"cron": in.Cron,
+	}).Infof("Received Schedule request")
+	schedule, err := a.scheduler.Add(in)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create schedule: %v", err)
+	}
+	return &pb.ScheduleResponse{Id: schedule.ID, NextRun: a.scheduler.NextRun(*schedule)}, nil
+}
+
+func (a *Agent) ListSchedules(ctx context.Context, in *pb.ListSchedulesRequest) (*pb.ListSchedulesResponse, error) {
+	a.logger(ctx).Infof("Received ListSchedules request")
+	schedules, err := a.scheduler.List()
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ListSchedulesResponse{Schedules: schedules}, nil
+}
+
+func (a *Agent) DeleteSchedule(ctx context.Context, in *pb.DeleteScheduleRequest) (*pb.DeleteScheduleResponse, error) {
+	a.logger(ctx).Infof("Received DeleteSchedule request for schedule ID: %s", in.Id)
+	if err := a.scheduler.Delete(in.Id); err != nil {
+		return nil, err
+	}
+	return &pb.DeleteScheduleResponse{Id: in.Id}, nil
+}
+
+func (a *Agent) StartWorkflow(ctx context.Context, in *pb.WorkflowRequest) (*pb.WorkflowResponse, error) {
+	a.logger(ctx).Infof("Received StartWorkflow request for workflow %q with %d steps", in.Name, len(in.Steps))
+	for _, step := range in.Steps {
+		if step.Start != nil {
+			step.Start.Owner = owner(ctx, step.Start.Owner)
+		}
+	}
+	id, err := a.workflows.Start(in)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start workflow: %v", err)
+	}
+	return &pb.WorkflowResponse{Id: id}, nil
+}
+
+func (a *Agent) WorkflowStatus(ctx context.Context, in *pb.WorkflowStatusRequest) (*pb.WorkflowStatusResponse, error) {
+	a.logger(ctx).Infof("Received WorkflowStatus request for workflow ID: %s", in.Id)
+	return a.workflows.Status(in.Id)
+}
+
+func (a *Agent) StopWorkflow(ctx context.Context, in *pb.StopWorkflowRequest) (*pb.StopWorkflowResponse, error) {
+	a.logger(ctx).Infof("Received StopWorkflow request for workflow ID: %s", in.Id)
+	if err := a.workflows.Stop(in.Id); err != nil {
+		return nil, fmt.Errorf("failed to stop workflow with ID %s: %v", in.Id, err)
+	}
+	return &pb.StopWorkflowResponse{Id: in.Id}, nil
+}
+
+func (a *Agent) ListJobs(ctx context.Context, in *pb.ListJobsRequest) (*pb.ListJobsResponse, error) {
+	a.logger(ctx).WithFields(logrus.Fields{
+		"owner": in.Owner,
+		"states": in.States,
+		"limit": in.Limit,
+	}).Infof("Received ListJobs request")
+	filter := db.ExecutionFilter{
+		Owner: in.Owner,
+		NewestFirst: true,
+		Limit: defaultListJobs,
+	}
+	if in.Limit > 0 {
+		filter.Limit = min(int(in.Limit), maxListJobs)
+	}
+	for _, state := range in.States {
+		filter.States = append(filter.States, int32(state))
+	}
+	execs, err := a.db.WithContext(ctx).ListExecutions(filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %v", err)
+	}
+	resp := &pb.ListJobsResponse{}
+	for _, exec := range execs {
+		var args []string
+		if err := json.Unmarshal(exec.Args, &args); err != nil {
+			a.logger(ctx).Errorf("failed to unmarshal args for job ID %s: %v", exec.ID, err)
+		}
+		resp.Jobs = append(resp.Jobs, &pb.JobInfo{
+			Id: exec.ID,
+			Cmd: exec.Command,
+			Args: args,
+			State: pb.State(exec.Status),
+			Exit: exec.ExitCode,
+			Owner: exec.Owner,
+			CreatedAt: exec.CreatedAt,
+		})
+	}
+	return resp, nil
+}
+
+// Output streams the output of a job line by line. While the job is queued
+// or running it keeps following the output until the job finishes or the
+// client goes away.
 func (a *Agent) Output(in *pb.OutputRequest, serv pb.Agent_OutputServer) error {
-	a.log.Infof("Received Output request for job ID: %s", in.Id)
-	exec, err := a.db.GetExecution(in.Id)
+	log := a.logger(serv.Context())
+	log.Infof("Received Output request for job ID: %s", in.Id)
+	database := a.db.WithContext(serv.Context())
+	exec, err := database.GetExecution(in.Id)
 	if err != nil {
 		return  fmt.Errorf("failed to get execution for job ID %s: %v", in.Id, err)
 	}
 	if exec == nil {
 		return  fmt.Errorf("no execution found for job ID %s", in.Id)
 	}
-	file, err := os.Open(exec.Output)
-	if err != nil {
-		return  fmt.Errorf("failed to open output file for job ID %s: %v", in.Id, err)
-	}
 
-	defer file.Close()
+	var offset int64
+	var pending []byte
+	for {
+		// check the state before reading, output is complete once the job
+		// is no longer running
+		exec, err = database.GetExecution(in.Id)
+		if err != nil {
+			return fmt.Errorf("failed to get execution for job ID %s: %v", in.Id, err)
+		}
+		running := exec.Status == int32(pb.State_RUNNING) || exec.Status == int32(pb.State_PENDING)
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Bytes()
-		serv.Send(&pb.OutputResponse{
-			Output: line,
-		})
+		read, err := a.readOutput(in.Id, exec.Compression, offset)
+		if err != nil {
+			if !running || exec.Compression != "" {
+				return err
+			}
+			// the job may have finished and its uncompressed output been
+			// replaced while reading, retry with the compressed copy
+			log.Warnf("Retrying output of job %s: %v", in.Id, err)
+			read = nil
+		}
+		offset += int64(len(read))
+		pending = append(pending, read...)
+		for {
+			i := bytes.IndexByte(pending, '\n')
+			if i < 0 && len(pending) < maxOutputMessage {
+				break
+			}
+			line := pending
+			if i >= 0 {
+				line, pending = pending[:i], pending[i+1:]
+			} else {
+				line, pending = pending[:maxOutputMessage], pending[maxOutputMessage:]
+			}
+			if err := serv.Send(&pb.OutputResponse{Output: line}); err != nil {
+				return err
+			}
+		}
+
+		if !running {
+			if len(pending) > 0 {
+				return serv.Send(&pb.OutputResponse{Output: pending})
+			}
+			return nil
+		}
+		if len(read) == 0 {
+			select {
+			case <-serv.Context().Done():
+				return serv.Context().Err()
+			case <-time.After(outputPollInterval):
+			}
+		}
 	}
-	return nil
+}
+
+// readOutput returns the output of a job that was written after offset.
+func (a *Agent) readOutput(id, compression string, offset int64) ([]byte, error) {
+	r, err := output.OpenOutput(a.store, id, compression, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open output for job ID %s: %v", id, err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read output for job ID %s: %v", id, err)
+	}
+	return data, nil
 }
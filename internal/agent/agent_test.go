@@ -0,0 +1,543 @@
+package agent
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stewyb314/remote-control/internal/config"
+	"github.com/stewyb314/remote-control/internal/db"
+	"github.com/stewyb314/remote-control/internal/metrics"
+	"github.com/stewyb314/remote-control/internal/output"
+	"github.com/stewyb314/remote-control/internal/redact"
+	"github.com/stewyb314/remote-control/internal/services"
+	pb "github.com/stewyb314/remote-control/protos"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestAgent serves an agent on database and store over an in-memory
+// connection and returns it with a client connected to it.
+func newTestAgent(t *testing.T, database db.DB, store output.Store) (*Agent, pb.AgentClient) {
+	t.Helper()
+	logger := logrus.New()
+	logger.Out = io.Discard
+	return newTestAgentLog(t, database, store, logrus.NewEntry(logger))
+}
+
+// newTestAgentLog is newTestAgent logging to log.
+func newTestAgentLog(t *testing.T, database db.DB, store output.Store, log *logrus.Entry) (*Agent, pb.AgentClient) {
+	t.Helper()
+	jobs := services.NewJobs(config.JobsConfig{OutputCompression: config.CompressionNone}, database, store, log)
+	scheduler := services.NewScheduler(jobs, database, log)
+	workflows := services.NewWorkflows(jobs, database, log)
+	a := New(log, "", 0, nil, config.KeepaliveConfig{}, database, store, jobs, scheduler, workflows)
+
+	lis := bufconn.Listen(1 << 20)
+	go a.server.Serve(lis)
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient() = %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		a.server.Stop()
+		jobs.Shutdown(context.Background())
+	})
+	return a, pb.NewAgentClient(conn)
+}
+
+func newTestStore(t *testing.T) output.Store {
+	t.Helper()
+	store, err := output.NewDir(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDir() = %v", err)
+	}
+	return store
+}
+
+// waitForStatus polls the status of a job until it is in state or fails
+// the test.
+func waitForStatus(t *testing.T, client pb.AgentClient, id string, state pb.State) *pb.StatusResponse {
+	t.Helper()
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		status, err := client.Status(context.Background(), &pb.StatusRequest{Id: id})
+		if err != nil {
+			t.Fatalf("Status(%s) = %v", id, err)
+		}
+		if status.State == state {
+			return status
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not reach state %s", id, state)
+	return nil
+}
+
+// readOutput returns the output of a job as the Output stream sends it.
+func readOutput(t *testing.T, client pb.AgentClient, id string) ([]string, error) {
+	t.Helper()
+	stream, err := client.Output(context.Background(), &pb.OutputRequest{Id: id})
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return lines, nil
+		}
+		if err != nil {
+			return lines, err
+		}
+		lines = append(lines, string(resp.Output))
+	}
+}
+
+func TestStartStatusOutput(t *testing.T) {
+	_, client := newTestAgent(t, db.NewMemory(), newTestStore(t))
+	ctx := context.Background()
+	resp, err := client.Start(ctx, &pb.StartRequest{Command: "echo", Args: []string{"hello"}, Owner: "alice"})
+	if err != nil {
+		t.Fatalf("Start() = %v", err)
+	}
+	status := waitForStatus(t, client, resp.Id, pb.State_COMPLETE)
+	if status.Cmd != "echo" || len(status.Args) != 1 || status.Args[0] != "hello" || status.Exit != 0 {
+		t.Errorf("Status() = %v, want echo hello with exit code 0", status)
+	}
+	lines, err := readOutput(t, client, resp.Id)
+	if err != nil {
+		t.Fatalf("Output() = %v", err)
+	}
+	if len(lines) != 1 || lines[0] != "hello" {
+		t.Errorf("Output() = %q, want hello", lines)
+	}
+
+	jobs, err := client.ListJobs(ctx, &pb.ListJobsRequest{Owner: "alice"})
+	if err != nil {
+		t.Fatalf("ListJobs() = %v", err)
+	}
+	if len(jobs.Jobs) != 1 || jobs.Jobs[0].Id != resp.Id {
+		t.Errorf("ListJobs() of the owner = %v, want the started job", jobs.Jobs)
+	}
+}
+
+// TestSecretArgs checks that the command gets its secrets while the agent
+// only ever logs, stores and returns them masked.
+func TestSecretArgs(t *testing.T) {
+	logger, hook := logtest.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	database := db.NewMemory()
+	a, client := newTestAgentLog(t, database, newTestStore(t), logrus.NewEntry(logger))
+	redactor, err := redact.New(config.RedactConfig{Patterns: []string{`^-p(.+)`}})
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	a.jobs.SetRedactor(redactor)
+
+	args := []string{"--password", "hunter2", "-pswordfish", "visible", "tiger-lily"}
+	resp, err := client.Start(context.Background(), &pb.StartRequest{Command: "echo", Args: args, SecretArgs: []int32{4}})
+	if err != nil {
+		t.Fatalf("Start() = %v", err)
+	}
+	status := waitForStatus(t, client, resp.Id, pb.State_COMPLETE)
+	masked := []string{"--password", redact.Mask, "-p" + redact.Mask, "visible", redact.Mask}
+	if !slices.Equal(status.Args, masked) {
+		t.Errorf("Status() args = %q, want %q", status.Args, masked)
+	}
+	exec, err := database.GetExecution(resp.Id)
+	if err != nil {
+		t.Fatalf("GetExecution() = %v", err)
+	}
+	jobs, err := client.ListJobs(context.Background(), &pb.ListJobsRequest{})
+	if err != nil {
+		t.Fatalf("ListJobs() = %v", err)
+	}
+	lines, err := readOutput(t, client, resp.Id)
+	if err != nil {
+		t.Fatalf("Output() = %v", err)
+	}
+	if want := strings.Join(args, " "); len(lines) != 1 || lines[0] != want {
+		t.Errorf("output = %q, want the command to get %q", lines, want)
+	}
+
+	secrets := []string{"hunter2", "swordfish", "tiger-lily"}
+	leaks := map[string]string{"stored args": string(exec.Args), "job list": fmt.Sprint(jobs.Jobs)}
+	for i, e := range hook.AllEntries() {
+		line, err := e.String()
+		if err != nil {
+			t.Fatalf("String() = %v", err)
+		}
+		leaks[fmt.Sprintf("log line %d", i)] = line
+	}
+	for where, text := range leaks {
+		for _, secret := range secrets {
+			if strings.Contains(text, secret) {
+				t.Errorf("%s has the secret %q: %s", where, secret, text)
+			}
+		}
+	}
+}
+
+// TestRestartedJobs checks that jobs a previous run of the agent left
+// RUNNING or PENDING are reported as failed and their output ends.
+func TestRestartedJobs(t *testing.T) {
+	database, store := db.NewMemory(), newTestStore(t)
+	for _, exec := range []db.Execution{
+		{ID: "running", Command: "sleep", Status: int32(pb.State_RUNNING)},
+		{ID: "pending", Command: "sleep", Status: int32(pb.State_PENDING)},
+	} {
+		if err := database.CreateExecution(exec); err != nil {
+			t.Fatalf("CreateExecution() = %v", err)
+		}
+	}
+	// a job's output is created when it is queued
+	for id, output := range map[string]string{"running": "partial\n", "pending": ""} {
+		w, err := store.Create(id)
+		if err != nil {
+			t.Fatalf("Create() = %v", err)
+		}
+		io.WriteString(w, output)
+		w.Close()
+	}
+
+	a, client := newTestAgent(t, database, store)
+	if n, err := a.jobs.Recover(); err != nil || n != 2 {
+		t.Fatalf("Recover() = %d, %v, want 2", n, err)
+	}
+	for id, want := range map[string][]string{"running": {"partial"}, "pending": nil} {
+		status, err := client.Status(context.Background(), &pb.StatusRequest{Id: id})
+		if err != nil {
+			t.Fatalf("Status(%s) = %v", id, err)
+		}
+		if status.State != pb.State_ERROR || status.Error != services.ErrAgentRestarted {
+			t.Errorf("Status(%s) = %s %q, want ERROR %q", id, status.State, status.Error, services.ErrAgentRestarted)
+		}
+		// following the output of the job ends instead of waiting for it
+		done := make(chan []string)
+		go func() {
+			lines, err := readOutput(t, client, id)
+			if err != nil {
+				t.Errorf("Output(%s) = %v", id, err)
+			}
+			done <- lines
+		}()
+		select {
+		case lines := <-done:
+			if !slices.Equal(lines, want) {
+				t.Errorf("Output(%s) = %q, want %q", id, lines, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Output(%s) of a job interrupted by a restart does not end", id)
+		}
+	}
+}
+
+func TestStop(t *testing.T) {
+	_, client := newTestAgent(t, db.NewMemory(), newTestStore(t))
+	ctx := context.Background()
+	resp, err := client.Start(ctx, &pb.StartRequest{Command: "sh", Args: []string{"-c", "echo started; sleep 30"}})
+	if err != nil {
+		t.Fatalf("Start() = %v", err)
+	}
+	waitForStatus(t, client, resp.Id, pb.State_RUNNING)
+	if _, err := client.Stop(ctx, &pb.StopRequest{Id: resp.Id}); err != nil {
+		t.Fatalf("Stop() = %v", err)
+	}
+	waitForStatus(t, client, resp.Id, pb.State_STOPPED)
+	// the output written before the stop is kept
+	lines, err := readOutput(t, client, resp.Id)
+	if err != nil {
+		t.Fatalf("Output() = %v", err)
+	}
+	if len(lines) != 1 || lines[0] != "started" {
+		t.Errorf("Output() of the stopped job = %q, want started", lines)
+	}
+	// stopping it again is not an error
+	if _, err := client.Stop(ctx, &pb.StopRequest{Id: resp.Id}); err != nil {
+		t.Errorf("Stop() of a stopped job = %v", err)
+	}
+}
+
+func TestUnknownJob(t *testing.T) {
+	_, client := newTestAgent(t, db.NewMemory(), newTestStore(t))
+	ctx := context.Background()
+	const id = "00000000-0000-0000-0000-000000000000"
+	if _, err := client.Status(ctx, &pb.StatusRequest{Id: id}); err == nil {
+		t.Errorf("Status() of an unknown job succeeded")
+	}
+	if _, err := client.Stop(ctx, &pb.StopRequest{Id: id}); err == nil {
+		t.Errorf("Stop() of an unknown job succeeded")
+	}
+	if _, err := readOutput(t, client, id); err == nil {
+		t.Errorf("Output() of an unknown job succeeded")
+	}
+}
+
+func TestOtherOwner(t *testing.T) {
+	_, client := newTestAgent(t, db.NewMemory(), newTestStore(t))
+	ctx := context.Background()
+	alice, err := client.Start(ctx, &pb.StartRequest{Command: "true", Owner: "alice", IdempotencyKey: "key"})
+	if err != nil {
+		t.Fatalf("Start() = %v", err)
+	}
+	waitForStatus(t, client, alice.Id, pb.State_COMPLETE)
+
+	jobs, err := client.ListJobs(ctx, &pb.ListJobsRequest{Owner: "bob"})
+	if err != nil {
+		t.Fatalf("ListJobs() = %v", err)
+	}
+	if len(jobs.Jobs) != 0 {
+		t.Errorf("ListJobs() of another owner = %v, want none", jobs.Jobs)
+	}
+	// the idempotency key of one owner does not return the job to another
+	bob, err := client.Start(ctx, &pb.StartRequest{Command: "true", Owner: "bob", IdempotencyKey: "key"})
+	if err != nil {
+		t.Fatalf("Start() = %v", err)
+	}
+	if bob.Id == alice.Id {
+		t.Errorf("Start() of another owner with the same key returned the first owner's job")
+	}
+}
+
+// TestOwnerFromCertificate checks that a caller with a client certificate
+// owns its jobs under the certificate's name and not the one it asks for.
+func TestOwnerFromCertificate(t *testing.T) {
+	database := db.NewMemory()
+	a, _ := newTestAgent(t, database, newTestStore(t))
+	auth := credentials.TLSInfo{State: tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "alice"}}},
+	}}
+	for _, tc := range []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{"certificate", peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{}, AuthInfo: auth}), "alice"},
+		{"no identity", context.Background(), "mallory"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := a.Start(tc.ctx, &pb.StartRequest{Command: "true", Owner: "mallory"})
+			if err != nil {
+				t.Fatalf("Start() = %v", err)
+			}
+			exec, err := database.GetExecution(resp.Id)
+			if err != nil {
+				t.Fatalf("GetExecution() = %v", err)
+			}
+			if exec.Owner != tc.want {
+				t.Errorf("owner = %q, want %q", exec.Owner, tc.want)
+			}
+		})
+	}
+}
+
+func TestDrain(t *testing.T) {
+	a, client := newTestAgent(t, db.NewMemory(), newTestStore(t))
+	ctx := context.Background()
+	a.checkHealth(ctx)
+	resp, err := client.Start(ctx, &pb.StartRequest{Command: "sleep", Args: []string{"30"}})
+	if err != nil {
+		t.Fatalf("Start() = %v", err)
+	}
+	waitForStatus(t, client, resp.Id, pb.State_RUNNING)
+
+	drain, err := client.Drain(ctx, &pb.DrainRequest{})
+	if err != nil {
+		t.Fatalf("Drain() = %v", err)
+	}
+	if drain.Running != 1 || drain.Pending != 0 {
+		t.Errorf("Drain() = %v, want 1 running job", drain)
+	}
+	if _, err := client.Start(ctx, &pb.StartRequest{Command: "true"}); err == nil {
+		t.Errorf("Start() while draining succeeded")
+	}
+	// the accepted job can still be watched and stopped
+	waitForStatus(t, client, resp.Id, pb.State_RUNNING)
+	health, err := client.Health(ctx, &pb.HealthRequest{})
+	if err != nil {
+		t.Fatalf("Health() = %v", err)
+	}
+	if !health.Draining || health.Ready || health.Running != 1 {
+		t.Errorf("Health() = %v, want draining, not ready and 1 running job", health)
+	}
+	if got := readiness(t, a); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("readiness while draining = %s, want %s", got, healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+	if _, err := client.Stop(ctx, &pb.StopRequest{Id: resp.Id}); err != nil {
+		t.Fatalf("Stop() = %v", err)
+	}
+	waitForStatus(t, client, resp.Id, pb.State_STOPPED)
+}
+
+// TestShutdown checks that a client following output keeps receiving it
+// until the job is stopped at the end of the grace period, while new
+// requests are refused.
+func TestShutdown(t *testing.T) {
+	a, client := newTestAgent(t, db.NewMemory(), newTestStore(t))
+	ctx := context.Background()
+	resp, err := client.Start(ctx, &pb.StartRequest{Command: "sh", Args: []string{"-c", "echo started; sleep 30"}})
+	if err != nil {
+		t.Fatalf("Start() = %v", err)
+	}
+	waitForStatus(t, client, resp.Id, pb.State_RUNNING)
+	stream, err := client.Output(ctx, &pb.OutputRequest{Id: resp.Id})
+	if err != nil {
+		t.Fatalf("Output() = %v", err)
+	}
+	if line, err := stream.Recv(); err != nil || string(line.Output) != "started" {
+		t.Fatalf("Recv() = %v, %v, want started", line, err)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		a.Shutdown(shutdownCtx)
+		close(done)
+	}()
+	// the follower ends with the output once the job was stopped
+	if _, err := stream.Recv(); !errors.Is(err, io.EOF) {
+		t.Errorf("Recv() after shutdown = %v, want the end of the output", err)
+	}
+	<-done
+	if _, err := client.Status(ctx, &pb.StatusRequest{Id: resp.Id}); err == nil {
+		t.Errorf("Status() after shutdown succeeded")
+	}
+}
+
+// readiness returns the readiness the agent reports to health checks.
+func readiness(t *testing.T, a *Agent) healthpb.HealthCheckResponse_ServingStatus {
+	t.Helper()
+	resp, err := a.health.Check(context.Background(), &healthpb.HealthCheckRequest{Service: readinessService})
+	if err != nil {
+		t.Fatalf("Check() = %v", err)
+	}
+	return resp.Status
+}
+
+// unreachableDB is a database whose connection was lost.
+type unreachableDB struct {
+	db.DB
+}
+
+func (unreachableDB) Ping(ctx context.Context) error {
+	return errors.New("connection refused")
+}
+
+func TestReadiness(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		// setup returns the backends of the agent and, if not nil, a
+		// function that breaks one of them once the agent runs
+		setup func(t *testing.T) (db.DB, output.Store, func())
+		// failed is the backend expected to fail, empty when all work
+		failed string
+	}{
+		{"Ready", func(t *testing.T) (db.DB, output.Store, func()) {
+			return db.NewMemory(), newTestStore(t), nil
+		}, ""},
+		{"DatabaseDown", func(t *testing.T) (db.DB, output.Store, func()) {
+			return unreachableDB{db.NewMemory()}, newTestStore(t), nil
+		}, "database"},
+		{"OutputNotWritable", func(t *testing.T) (db.DB, output.Store, func()) {
+			dir := filepath.Join(t.TempDir(), "output")
+			store, err := output.NewDir(dir)
+			if err != nil {
+				t.Fatalf("NewDir() = %v", err)
+			}
+			return db.NewMemory(), store, func() {
+				if err := os.RemoveAll(dir); err != nil {
+					t.Fatalf("RemoveAll() = %v", err)
+				}
+			}
+		}, "output"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			database, store, breakBackend := tc.setup(t)
+			a, client := newTestAgent(t, database, store)
+			if got := readiness(t, a); got != healthpb.HealthCheckResponse_NOT_SERVING {
+				t.Errorf("readiness before the first check = %s, want %s", got, healthpb.HealthCheckResponse_NOT_SERVING)
+			}
+			if breakBackend != nil {
+				breakBackend()
+			}
+			health, err := client.Health(context.Background(), &pb.HealthRequest{})
+			if err != nil {
+				t.Fatalf("Health() = %v", err)
+			}
+			want := healthpb.HealthCheckResponse_SERVING
+			if tc.failed != "" {
+				want = healthpb.HealthCheckResponse_NOT_SERVING
+			}
+			if got := readiness(t, a); got != want || health.Ready != (tc.failed == "") {
+				t.Errorf("readiness = %s and Health() ready = %v, want %s", got, health.Ready, want)
+			}
+			for _, b := range health.Backends {
+				if b.Ok != (b.Name != tc.failed) || b.Ok != (b.Error == "") {
+					t.Errorf("backend %s ok = %v with error %q, want failed = %v", b.Name, b.Ok, b.Error, b.Name == tc.failed)
+				}
+			}
+		})
+	}
+}
+
+// TestMetrics checks that the metrics endpoint serves the job, RPC and
+// database metrics of the requests the agent handled.
+func TestMetrics(t *testing.T) {
+	_, client := newTestAgent(t, db.Instrument(db.NewMemory()), newTestStore(t))
+	resp, err := client.Start(context.Background(), &pb.StartRequest{Command: "echo", Args: []string{"hello"}})
+	if err != nil {
+		t.Fatalf("Start() = %v", err)
+	}
+	waitForStatus(t, client, resp.Id, pb.State_COMPLETE)
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /metrics = %d, want %d", rec.Code, http.StatusOK)
+	}
+	body := rec.Body.String()
+	for _, metric := range []string{
+		`trc_jobs_started_total`,
+		`trc_jobs_finished_total{state="completed"}`,
+		`trc_job_output_bytes_total`,
+		`grpc_server_handled_total{grpc_code="OK",grpc_method="Start",grpc_service="cmd.Agent",grpc_type="unary"}`,
+		`grpc_server_handled_total{grpc_code="OK",grpc_method="Status",grpc_service="cmd.Agent",grpc_type="unary"}`,
+		`trc_db_operation_duration_seconds_count{operation="create_execution"}`,
+	} {
+		// the metrics are global, other tests may have counted as well
+		match := regexp.MustCompile(`(?m)^` + regexp.QuoteMeta(metric) + ` (\S+)$`).FindStringSubmatch(body)
+		if match == nil {
+			t.Errorf("GET /metrics is missing %s", metric)
+			continue
+		}
+		if v, err := strconv.ParseFloat(match[1], 64); err != nil || v < 1 {
+			t.Errorf("%s = %s, want at least 1", metric, match[1])
+		}
+	}
+}
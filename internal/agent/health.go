@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/stewyb314/remote-control/internal/version"
+	pb "github.com/stewyb314/remote-control/protos"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	// healthCheckInterval is how often the backends are checked for the
+	// readiness reported by the health service
+	healthCheckInterval = 10 * time.Second
+	// healthCheckTimeout bounds a single check of all backends
+	healthCheckTimeout = 5 * time.Second
+)
+
+// readinessService is the service the health service reports readiness
+// under. The empty service reports whether the agent is alive, it is
+// serving until the agent shuts down.
+var readinessService = pb.Agent_ServiceDesc.ServiceName
+
+// Health checks the backends and reports them together with the agent's
+// version, uptime and load.
+func (a *Agent) Health(ctx context.Context, in *pb.HealthRequest) (*pb.HealthResponse, error) {
+	a.logger(ctx).Infof("Received Health request")
+	backends, ready := a.checkHealth(ctx)
+	running, pending := a.jobs.Counts()
+	return &pb.HealthResponse{
+		Version:       version.String(),
+		UptimeSeconds: int64(time.Since(a.started).Seconds()),
+		Running:       int32(running),
+		Pending:       int32(pending),
+		Draining:      a.jobs.Draining(),
+		Ready:         ready,
+		Backends:      backends,
+	}, nil
+}
+
+// watchHealth keeps the readiness up to date until the agent shuts down.
+func (a *Agent) watchHealth() {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+			a.checkHealth(context.Background())
+		}
+	}
+}
+
+// checkHealth checks the database and the output store and updates the
+// readiness. The agent is ready when both work and it is not draining.
+func (a *Agent) checkHealth(ctx context.Context) ([]*pb.BackendStatus, bool) {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	backends := []*pb.BackendStatus{
+		checkBackend(ctx, "database", a.db.Ping),
+		checkBackend(ctx, "output", a.store.Check),
+	}
+	var problems []string
+	if a.jobs.Draining() {
+		problems = append(problems, "draining")
+	}
+	for _, b := range backends {
+		if !b.Ok {
+			problems = append(problems, b.Name+": "+b.Error)
+		}
+	}
+	a.setReady(len(problems) == 0, strings.Join(problems, ", "))
+	return backends, len(problems) == 0
+}
+
+func checkBackend(ctx context.Context, name string, check func(context.Context) error) *pb.BackendStatus {
+	start := time.Now()
+	err := check(ctx)
+	status := &pb.BackendStatus{Name: name, Ok: err == nil, LatencyMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	return status
+}
+
+// setReady updates the readiness reported by the health service and logs
+// when it changes.
+func (a *Agent) setReady(ready bool, reason string) {
+	a.healthMu.Lock()
+	defer a.healthMu.Unlock()
+	if ready != a.ready {
+		if ready {
+			a.log.Infof("Agent is ready")
+		} else {
+			a.log.Warnf("Agent is not ready: %s", reason)
+		}
+	}
+	a.ready = ready
+	status := healthpb.HealthCheckResponse_SERVING
+	if !ready {
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	a.health.SetServingStatus(readinessService, status)
+}
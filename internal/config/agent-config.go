@@ -1,35 +1,387 @@
 package config
 
-import "os"
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	DriverSQLite   = "sqlite"
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverMemory   = "memory"
+)
+
+const (
+	OutputStoreDir = "dir"
+	OutputStoreDB  = "db"
+	OutputStoreS3  = "s3"
+
+	OutputLimitKill = "kill"
+	OutputLimitRing = "ring"
+
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+
+	QueueFIFO     = "fifo"
+	QueuePriority = "priority"
+
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
 
 type AgentConfig struct {
-	DbConfig
+	Server          ServerConfig `yaml:"server" toml:"server"`
+	DbConfig        `yaml:"db" toml:"db"`
+	OutputConfig    `yaml:"output" toml:"output"`
+	RetentionConfig `yaml:"retention" toml:"retention"`
+	JobsConfig      `yaml:"jobs" toml:"jobs"`
+	KeepaliveConfig `yaml:"keepalive" toml:"keepalive"`
+	Log             LogConfig `yaml:"log" toml:"log"`
+	Metrics         MetricsConfig `yaml:"metrics" toml:"metrics"`
+	Tracing         TracingConfig `yaml:"tracing" toml:"tracing"`
+	Redact          RedactConfig `yaml:"redact" toml:"redact"`
+	// PolicyFile lists the commands jobs may run, see the policy package.
+	// Empty allows every command.
+	PolicyFile string `yaml:"policy_file" toml:"policy_file"`
+}
+
+// ServerConfig is where the agent serves its gRPC API.
+type ServerConfig struct {
+	// Listen is the address to listen on, empty for all interfaces
+	Listen string `yaml:"listen" toml:"listen"`
+	Port   int    `yaml:"port" toml:"port"`
+	// CACert verifies client certificates when set, which makes them
+	// mandatory. Cert and Key enable TLS.
+	CACert string `yaml:"ca_cert" toml:"ca_cert"`
+	Cert   string `yaml:"cert" toml:"cert"`
+	Key    string `yaml:"key" toml:"key"`
+	// ShutdownGracePeriod is how long running jobs may take to finish on
+	// their own once the agent is asked to shut down
+	ShutdownGracePeriod time.Duration `yaml:"shutdown_grace_period" toml:"shutdown_grace_period"`
+}
+
+// MetricsConfig is where the agent serves its Prometheus metrics, apart
+// from the gRPC API so it can be firewalled separately.
+type MetricsConfig struct {
+	// Listen is the host:port /metrics is served on, empty disables it
+	Listen string `yaml:"listen" toml:"listen"`
+}
+
+// TracingConfig selects where OpenTelemetry spans are exported. Spans are
+// only recorded when at least one exporter is set.
+type TracingConfig struct {
+	// OTLPEndpoint is the host:port of an OTLP/gRPC collector
+	OTLPEndpoint string `yaml:"otlp_endpoint" toml:"otlp_endpoint"`
+	// OTLPInsecure connects to the collector without TLS
+	OTLPInsecure bool `yaml:"otlp_insecure" toml:"otlp_insecure"`
+	// File receives the spans as JSON, one per line, for offline debugging
+	File string `yaml:"file" toml:"file"`
+	// SampleRatio is the share of traces started by the agent that are
+	// recorded, traces started by clients follow their decision
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio"`
+}
+
+// Enabled reports whether spans are exported anywhere.
+func (c TracingConfig) Enabled() bool {
+	return c.OTLPEndpoint != "" || c.File != ""
+}
+
+// RedactConfig adds to the secrets the agent masks in command arguments,
+// see the redact package.
+type RedactConfig struct {
+	// Patterns are regular expressions whose captured parts, or whole
+	// match, are masked in every argument, e.g. `^-p(.+)` for mysql
+	Patterns []string `yaml:"patterns" toml:"patterns"`
+}
+
+type LogConfig struct {
+	// Level is the lowest logrus level logged, e.g. info or debug
+	Level string `yaml:"level" toml:"level"`
+	// Format is how entries are written, one of the LogFormat* constants
+	Format string `yaml:"format" toml:"format"`
 }
 
 type DbConfig struct {
-	Host     string
-	Port     int
-	User     string
-	Password string
-	Database string
+	// Driver selects the storage backend, one of the Driver* constants
+	Driver   string `yaml:"driver" toml:"driver"`
+	// Path is the database file used by the sqlite driver
+	Path     string `yaml:"path" toml:"path"`
+	Host     string `yaml:"host" toml:"host"`
+	// Port defaults to the driver's standard port when 0
+	Port     int `yaml:"port" toml:"port"`
+	User     string `yaml:"user" toml:"user"`
+	Password string `yaml:"password" toml:"password"`
+	Database string `yaml:"database" toml:"database"`
+	// SSLMode is passed to postgres as sslmode (disable, require, verify-ca, verify-full)
+	SSLMode  string `yaml:"ssl_mode" toml:"ssl_mode"`
+	// SSLRootCert is the CA certificate used to verify the postgres server
+	SSLRootCert string `yaml:"ssl_ca" toml:"ssl_ca"`
 }
 
-func NewAgentConfig() *AgentConfig {
+type OutputConfig struct {
+	// Store selects where job output is kept, one of the OutputStore* constants
+	Store string `yaml:"store" toml:"store"`
+	// Dir is the directory used by the dir store
+	Dir string `yaml:"dir" toml:"dir"`
+	S3  S3Config `yaml:"s3" toml:"s3"`
+}
+
+// S3Config describes an S3 compatible bucket such as MinIO
+type S3Config struct {
+	Endpoint  string `yaml:"endpoint" toml:"endpoint"`
+	Bucket    string `yaml:"bucket" toml:"bucket"`
+	Prefix    string `yaml:"prefix" toml:"prefix"`
+	AccessKey string `yaml:"access_key" toml:"access_key"`
+	SecretKey string `yaml:"secret_key" toml:"secret_key"`
+	UseSSL    bool `yaml:"use_ssl" toml:"use_ssl"`
+}
+
+// JobsConfig holds the limits applied to every job the agent runs.
+type JobsConfig struct {
+	// OutputLimit is the default and maximum number of output bytes kept
+	// per job, 0 means unlimited
+	OutputLimit int64 `yaml:"output_limit" toml:"output_limit"`
+	// OutputLimitMode is what happens when a job exceeds its output
+	// limit, one of the OutputLimit* constants
+	OutputLimitMode string `yaml:"output_limit_mode" toml:"output_limit_mode"`
+	// OutputCompression is the codec finished output is compressed with,
+	// one of the Compression* constants
+	OutputCompression string `yaml:"output_compression" toml:"output_compression"`
+	// MaxJobs is the number of jobs that may run at once, 0 means unlimited
+	MaxJobs int `yaml:"max_jobs" toml:"max_jobs"`
+	// MaxJobsPerOwner is the number of jobs a single owner may run at once,
+	// 0 means unlimited
+	MaxJobsPerOwner int `yaml:"max_jobs_per_owner" toml:"max_jobs_per_owner"`
+	// QueueOrder is the order jobs waiting for a free slot are started in,
+	// one of the Queue* constants
+	QueueOrder string `yaml:"queue_order" toml:"queue_order"`
+	// IdempotencyWindow is how long a start request's idempotency key
+	// maps to the job it started, 0 ignores the keys
+	IdempotencyWindow time.Duration `yaml:"idempotency_window" toml:"idempotency_window"`
+}
+
+// KeepaliveConfig controls the gRPC keepalive pings between the agent and
+// its clients, which detect dead connections on idle or slow links.
+type KeepaliveConfig struct {
+	// Time is how long a connection may be idle before the agent pings it
+	Time time.Duration `yaml:"time" toml:"time"`
+	// Timeout is how long the agent waits for a ping's reply before it
+	// closes the connection
+	Timeout time.Duration `yaml:"timeout" toml:"timeout"`
+	// MinTime is the shortest ping interval clients are allowed to use
+	MinTime time.Duration `yaml:"min_time" toml:"min_time"`
+}
+
+// RetentionConfig bounds how much job history the agent keeps. A zero
+// limit disables it.
+type RetentionConfig struct {
+	// MaxAge is how long finished jobs are kept
+	MaxAge time.Duration `yaml:"max_age" toml:"max_age"`
+	// MaxOutputBytes caps the total stored output of finished jobs
+	MaxOutputBytes int64 `yaml:"max_output_bytes" toml:"max_output_bytes"`
+	// MaxJobs caps the number of finished jobs kept
+	MaxJobs int `yaml:"max_jobs" toml:"max_jobs"`
+	// ArchiveDir receives a copy of every job before it is deleted
+	ArchiveDir string `yaml:"archive_dir" toml:"archive_dir"`
+	// Interval is how often the limits are enforced
+	Interval time.Duration `yaml:"interval" toml:"interval"`
+}
+
+
+func defaultAgentConfig() *AgentConfig {
 	return &AgentConfig{
+		Server: ServerConfig{
+			Listen: "0.0.0.0",
+			Port:   50051,
+			ShutdownGracePeriod: 30*time.Second,
+		},
 		DbConfig: DbConfig{
-			Host:     getEnv("DB_HOST", "database"),
-			Port:     3306,
-			User:     getEnv("DB_USER", "rc-user"),
-			Password: getEnv("DB_PASSWORD", "rc-password"),
-			Database: getEnv("DB_DATABASE", "executions"),
+			Driver:      DriverSQLite,
+			Path:        "executions.db",
+			Host:        "database",
+			User:        "rc-user",
+			Password:    "rc-password",
+			Database:    "executions",
+			SSLMode:     "disable",
+		},
+		OutputConfig: OutputConfig{
+			Store: OutputStoreDir,
+			Dir:   "jobs",
+			S3: S3Config{
+				Endpoint:  "localhost:9000",
+				Bucket:    "rc-output",
+				Prefix:    "jobs",
+			},
+		},
+		JobsConfig: JobsConfig{
+			OutputLimit:       100<<20,
+			OutputLimitMode:   OutputLimitRing,
+			OutputCompression: CompressionZstd,
+			QueueOrder:        QueueFIFO,
+			IdempotencyWindow: 24*time.Hour,
+		},
+		KeepaliveConfig: KeepaliveConfig{
+			Time:    2*time.Minute,
+			Timeout: 20*time.Second,
+			MinTime: 10*time.Second,
+		},
+		RetentionConfig: RetentionConfig{
+			MaxAge:         30*24*time.Hour,
+			MaxOutputBytes: 1<<30,
+			MaxJobs:        10000,
+			Interval:       time.Hour,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: LogFormatJSON,
 		},
+		Tracing: TracingConfig{
+			SampleRatio: 1,
+		},
+	}
+}
+
+// applyEnv overrides the settings whose environment variable is set and
+// returns the errors of those that could not be parsed.
+func (c *AgentConfig) applyEnv() error {
+	e := &envLoader{}
+	e.string(&c.Server.Listen, "LISTEN_ADDR")
+	e.int(&c.Server.Port, "LISTEN_PORT")
+	e.string(&c.Server.CACert, "TLS_CA_CERT")
+	e.string(&c.Server.Cert, "TLS_HOST_CERT")
+	e.string(&c.Server.Key, "TLS_KEY")
+	e.duration(&c.Server.ShutdownGracePeriod, "SHUTDOWN_GRACE_PERIOD")
+
+	e.string(&c.Driver, "DB_DRIVER")
+	e.string(&c.Path, "DB_PATH")
+	e.string(&c.Host, "DB_HOST")
+	e.int(&c.DbConfig.Port, "DB_PORT")
+	e.string(&c.User, "DB_USER")
+	e.string(&c.Password, "DB_PASSWORD")
+	e.string(&c.Database, "DB_DATABASE")
+	e.string(&c.SSLMode, "DB_SSL_MODE")
+	e.string(&c.SSLRootCert, "DB_SSL_CA")
+
+	e.string(&c.Store, "OUTPUT_STORE")
+	e.string(&c.Dir, "OUTPUT_DIR")
+	e.string(&c.S3.Endpoint, "S3_ENDPOINT")
+	e.string(&c.S3.Bucket, "S3_BUCKET")
+	e.string(&c.S3.Prefix, "S3_PREFIX")
+	e.string(&c.S3.AccessKey, "S3_ACCESS_KEY")
+	e.string(&c.S3.SecretKey, "S3_SECRET_KEY")
+	e.bool(&c.S3.UseSSL, "S3_USE_SSL")
+
+	e.int64(&c.OutputLimit, "OUTPUT_LIMIT")
+	e.string(&c.OutputLimitMode, "OUTPUT_LIMIT_MODE")
+	e.string(&c.OutputCompression, "OUTPUT_COMPRESSION")
+	e.int(&c.JobsConfig.MaxJobs, "MAX_JOBS")
+	e.int(&c.MaxJobsPerOwner, "MAX_JOBS_PER_OWNER")
+	e.string(&c.QueueOrder, "QUEUE_ORDER")
+	e.duration(&c.IdempotencyWindow, "IDEMPOTENCY_WINDOW")
+
+	e.duration(&c.KeepaliveConfig.Time, "KEEPALIVE_TIME")
+	e.duration(&c.KeepaliveConfig.Timeout, "KEEPALIVE_TIMEOUT")
+	e.duration(&c.MinTime, "KEEPALIVE_MIN_TIME")
+
+	e.duration(&c.MaxAge, "RETENTION_MAX_AGE")
+	e.int64(&c.MaxOutputBytes, "RETENTION_MAX_OUTPUT_BYTES")
+	e.int(&c.RetentionConfig.MaxJobs, "RETENTION_MAX_JOBS")
+	e.string(&c.ArchiveDir, "RETENTION_ARCHIVE_DIR")
+	e.duration(&c.Interval, "RETENTION_INTERVAL")
+
+	e.string(&c.Log.Level, "LOG_LEVEL")
+	e.string(&c.Log.Format, "LOG_FORMAT")
+	e.string(&c.Metrics.Listen, "METRICS_LISTEN")
+	e.string(&c.Tracing.OTLPEndpoint, "OTLP_ENDPOINT")
+	e.bool(&c.Tracing.OTLPInsecure, "OTLP_INSECURE")
+	e.string(&c.Tracing.File, "TRACING_FILE")
+	e.float(&c.Tracing.SampleRatio, "TRACING_SAMPLE_RATIO")
+	e.string(&c.PolicyFile, "POLICY_FILE")
+	return errors.Join(e.errs...)
+}
+
+// resolve fills in the settings whose default depends on others.
+func (c *AgentConfig) resolve() {
+	if c.DbConfig.Port == 0 {
+		c.DbConfig.Port = defaultPort(c.Driver)
 	}
 }
 
-func getEnv(key string, defaultVaule string) string {
-	value:= os.Getenv(key)
-	if value==""{
-		return defaultVaule
+func defaultPort(driver string) int {
+	if driver == DriverPostgres {
+		return 5432
 	}
-	return value
-}
\ No newline at end of file
+	return 3306
+}
+
+// envLoader sets a setting from its environment variable when that is not
+// empty and collects the values that fail to parse.
+type envLoader struct {
+	errs []error
+}
+
+func (e *envLoader) lookup(key string) (string, bool) {
+	value := os.Getenv(key)
+	return value, value != ""
+}
+
+func (e *envLoader) string(p *string, key string) {
+	if value, ok := e.lookup(key); ok {
+		*p = value
+	}
+}
+
+func (e *envLoader) int(p *int, key string) {
+	if value, ok := e.lookup(key); ok {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("invalid %s %q: not an integer", key, value))
+			return
+		}
+		*p = n
+	}
+}
+
+func (e *envLoader) int64(p *int64, key string) {
+	if value, ok := e.lookup(key); ok {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("invalid %s %q: not an integer", key, value))
+			return
+		}
+		*p = n
+	}
+}
+
+func (e *envLoader) bool(p *bool, key string) {
+	if value, ok := e.lookup(key); ok {
+		*p = value == "true"
+	}
+}
+
+func (e *envLoader) float(p *float64, key string) {
+	if value, ok := e.lookup(key); ok {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("invalid %s %q: not a number", key, value))
+			return
+		}
+		*p = f
+	}
+}
+
+func (e *envLoader) duration(p *time.Duration, key string) {
+	if value, ok := e.lookup(key); ok {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("invalid %s %q: %v", key, value, err))
+			return
+		}
+		*p = d
+	}
+}
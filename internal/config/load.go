@@ -0,0 +1,213 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// Load builds the agent's configuration from the defaults, the
+// configuration file, the environment and the command line flags in args,
+// each overriding the ones before, and validates it. It returns the
+// arguments left after the flags.
+//
+// Loading the same args again, e.g. on SIGHUP, picks up changes to the
+// file and the environment while flags keep taking precedence.
+func Load(args []string) (*AgentConfig, []string, error) {
+	c := defaultAgentConfig()
+	fs := flag.NewFlagSet("agent", flag.ContinueOnError)
+	path := fs.String("config", os.Getenv("AGENT_CONFIG"), "configuration file, YAML or TOML by its extension")
+	ephemeral := fs.Bool("ephemeral", false, "keep job history and output in memory only, nothing is written to a database or the output directory")
+	c.flags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	given := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = f.Value.String() })
+
+	// parsing wrote the flags into c, start over so the file and the
+	// environment apply below them
+	*c = *defaultAgentConfig()
+	if *path != "" {
+		if err := DecodeFile(*path, c); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := c.applyEnv(); err != nil {
+		return nil, nil, err
+	}
+	for name, value := range given {
+		if err := fs.Set(name, value); err != nil {
+			return nil, nil, fmt.Errorf("invalid -%s: %v", name, err)
+		}
+	}
+	if *ephemeral {
+		// the db output store keeps the output in the memory database too
+		c.Driver = DriverMemory
+		c.Store = OutputStoreDB
+	}
+	c.resolve()
+	if err := c.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return c, fs.Args(), nil
+}
+
+// flags binds the most common settings to command line flags.
+func (c *AgentConfig) flags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Server.Listen, "listen", c.Server.Listen, "address to listen on")
+	fs.IntVar(&c.Server.Port, "port", c.Server.Port, "port to listen on")
+	fs.StringVar(&c.Server.CACert, "ca-cert", c.Server.CACert, "CA certificate client certificates must be signed by, requires -host-cert")
+	fs.StringVar(&c.Server.Cert, "host-cert", c.Server.Cert, "TLS certificate of the agent")
+	fs.StringVar(&c.Server.Key, "key", c.Server.Key, "key of the TLS certificate")
+	fs.DurationVar(&c.Server.ShutdownGracePeriod, "shutdown-grace-period", c.Server.ShutdownGracePeriod, "time running jobs get to finish on shutdown before they are stopped")
+	fs.StringVar(&c.Driver, "db-driver", c.Driver, "database driver: sqlite, mysql, postgres or memory")
+	fs.StringVar(&c.Path, "db-path", c.Path, "database file of the sqlite driver")
+	fs.StringVar(&c.Store, "output-store", c.Store, "output store: dir, db or s3")
+	fs.StringVar(&c.Dir, "output-dir", c.Dir, "directory of the dir output store")
+	fs.Int64Var(&c.OutputLimit, "output-limit", c.OutputLimit, "output bytes kept per job, 0 is unlimited")
+	fs.StringVar(&c.OutputLimitMode, "output-limit-mode", c.OutputLimitMode, "what happens to a job exceeding its output limit: ring or kill")
+	fs.IntVar(&c.JobsConfig.MaxJobs, "max-jobs", c.JobsConfig.MaxJobs, "jobs running at once, 0 is unlimited")
+	fs.IntVar(&c.MaxJobsPerOwner, "max-jobs-per-owner", c.MaxJobsPerOwner, "jobs running at once per owner, 0 is unlimited")
+	fs.StringVar(&c.QueueOrder, "queue-order", c.QueueOrder, "order queued jobs start in: fifo or priority")
+	fs.StringVar(&c.PolicyFile, "policy", c.PolicyFile, "policy file listing the commands jobs may run")
+	fs.StringVar(&c.Log.Level, "log-level", c.Log.Level, "lowest level logged: panic, fatal, error, warn, info, debug or trace")
+	fs.StringVar(&c.Log.Format, "log-format", c.Log.Format, "format of log entries: json or text")
+	fs.StringVar(&c.Tracing.OTLPEndpoint, "otlp-endpoint", c.Tracing.OTLPEndpoint, "host:port of an OTLP/gRPC collector to export traces to")
+	fs.BoolVar(&c.Tracing.OTLPInsecure, "otlp-insecure", c.Tracing.OTLPInsecure, "connect to the OTLP collector without TLS")
+	fs.StringVar(&c.Tracing.File, "trace-file", c.Tracing.File, "file to append traces to as JSON, one span per line")
+	fs.StringVar(&c.Metrics.Listen, "metrics-listen", c.Metrics.Listen, "host:port to serve Prometheus metrics on at /metrics, empty disables them")
+}
+
+// Validate checks that the settings are consistent and in range.
+func (c *AgentConfig) Validate() error {
+	var errs []error
+	oneOf := func(name, value string, valid ...string) {
+		if !slices.Contains(valid, value) {
+			errs = append(errs, fmt.Errorf("invalid %s %q, must be one of %s", name, value, strings.Join(valid, ", ")))
+		}
+	}
+	notNegative := func(name string, value int64) {
+		if value < 0 {
+			errs = append(errs, fmt.Errorf("invalid %s %d, must not be negative", name, value))
+		}
+	}
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		errs = append(errs, fmt.Errorf("invalid port %d", c.Server.Port))
+	}
+	if (c.Server.Cert == "") != (c.Server.Key == "") {
+		errs = append(errs, fmt.Errorf("TLS needs both a host certificate and its key"))
+	}
+	if c.Server.CACert != "" && c.Server.Cert == "" {
+		errs = append(errs, fmt.Errorf("verifying client certificates with a CA certificate needs TLS, set a host certificate and key"))
+	}
+	notNegative("shutdown grace period", int64(c.Server.ShutdownGracePeriod))
+	oneOf("database driver", c.Driver, DriverSQLite, DriverMySQL, DriverPostgres, DriverMemory)
+	if c.DbConfig.Port < 1 || c.DbConfig.Port > 65535 {
+		errs = append(errs, fmt.Errorf("invalid database port %d", c.DbConfig.Port))
+	}
+	oneOf("output store", c.Store, OutputStoreDir, OutputStoreDB, OutputStoreS3)
+	if c.Store == OutputStoreDir && c.Dir == "" {
+		errs = append(errs, fmt.Errorf("the dir output store needs an output directory"))
+	}
+	notNegative("output limit", c.OutputLimit)
+	oneOf("output limit mode", c.OutputLimitMode, OutputLimitRing, OutputLimitKill)
+	oneOf("output compression", c.OutputCompression, CompressionNone, CompressionGzip, CompressionZstd)
+	notNegative("max jobs", int64(c.JobsConfig.MaxJobs))
+	notNegative("max jobs per owner", int64(c.MaxJobsPerOwner))
+	oneOf("queue order", c.QueueOrder, QueueFIFO, QueuePriority)
+	notNegative("idempotency window", int64(c.IdempotencyWindow))
+	notNegative("keepalive time", int64(c.KeepaliveConfig.Time))
+	notNegative("keepalive timeout", int64(c.KeepaliveConfig.Timeout))
+	notNegative("keepalive min time", int64(c.MinTime))
+	notNegative("retention max age", int64(c.MaxAge))
+	notNegative("retention max output bytes", c.MaxOutputBytes)
+	notNegative("retention max jobs", int64(c.RetentionConfig.MaxJobs))
+	if c.Interval <= 0 {
+		errs = append(errs, fmt.Errorf("invalid retention interval %v, must be positive", c.Interval))
+	}
+	if _, err := logrus.ParseLevel(c.Log.Level); err != nil {
+		errs = append(errs, fmt.Errorf("invalid log level %q", c.Log.Level))
+	}
+	oneOf("log format", c.Log.Format, LogFormatJSON, LogFormatText)
+	for _, pattern := range c.Redact.Patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			errs = append(errs, fmt.Errorf("invalid redact pattern %q: %v", pattern, err))
+		}
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, fmt.Errorf("invalid tracing sample ratio %v, must be between 0 and 1", c.Tracing.SampleRatio))
+	}
+	if c.Metrics.Listen != "" {
+		if _, _, err := net.SplitHostPort(c.Metrics.Listen); err != nil {
+			errs = append(errs, fmt.Errorf("invalid metrics listen address %q: %v", c.Metrics.Listen, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RestartRequired returns the sections that differ in next but cannot be
+// applied to an agent running with c.
+func (c *AgentConfig) RestartRequired(next *AgentConfig) []string {
+	var sections []string
+	for _, section := range []struct {
+		name    string
+		changed bool
+	}{
+		{"server", !reflect.DeepEqual(c.Server, next.Server)},
+		{"db", !reflect.DeepEqual(c.DbConfig, next.DbConfig)},
+		{"output", !reflect.DeepEqual(c.OutputConfig, next.OutputConfig)},
+		{"retention", !reflect.DeepEqual(c.RetentionConfig, next.RetentionConfig)},
+		{"keepalive", !reflect.DeepEqual(c.KeepaliveConfig, next.KeepaliveConfig)},
+		{"metrics", !reflect.DeepEqual(c.Metrics, next.Metrics)},
+		{"tracing", !reflect.DeepEqual(c.Tracing, next.Tracing)},
+	} {
+		if section.changed {
+			sections = append(sections, section.name)
+		}
+	}
+	return sections
+}
+
+// DecodeFile decodes the YAML or TOML file at path into v, chosen by its
+// extension. Settings v has no field for are an error so typos do not go
+// unnoticed.
+func DecodeFile(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch filepath.Ext(path) {
+	case ".toml":
+		md, err := toml.Decode(string(data), v)
+		if err != nil {
+			return fmt.Errorf("invalid configuration file %s: %v", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("unknown setting %s in %s", undecoded[0], path)
+		}
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("invalid configuration file %s: %v", path, err)
+		}
+	default:
+		return fmt.Errorf("unsupported configuration file %s, must end in .yaml, .yml or .toml", path)
+	}
+	return nil
+}
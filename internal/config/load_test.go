@@ -0,0 +1,215 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearEnv keeps the environment of the user running the tests out of the
+// configuration, an empty variable counts as unset.
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, name := range []string{"AGENT_CONFIG", "LISTEN_PORT", "MAX_JOBS", "LOG_LEVEL", "DB_DRIVER", "OUTPUT_STORE", "TLS_HOST_CERT", "TLS_KEY", "TLS_CA_CERT"} {
+		t.Setenv(name, "")
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadEphemeral(t *testing.T) {
+	clearEnv(t)
+	c, _, err := Load([]string{"-ephemeral", "-output-store", "dir"})
+	if err != nil {
+		t.Fatalf("Load() = %v", err)
+	}
+	// nothing is written to disk, whatever else was asked for
+	if c.Driver != DriverMemory || c.Store != OutputStoreDB {
+		t.Errorf("Load(-ephemeral) = driver %s and output store %s, want %s and %s", c.Driver, c.Store, DriverMemory, OutputStoreDB)
+	}
+}
+
+// TestLoadPrecedence checks that the file overrides the defaults, the
+// environment the file and flags the environment.
+func TestLoadPrecedence(t *testing.T) {
+	file := writeFile(t, "agent.yaml", "server:\n  port: 1001\njobs:\n  max_jobs: 3\nlog:\n  level: debug\n")
+	for _, tc := range []struct {
+		name      string
+		args      []string
+		env       map[string]string
+		wantPort  int
+		wantJobs  int
+		wantLevel string
+	}{
+		{name: "defaults", wantPort: 50051, wantJobs: 0, wantLevel: "info"},
+		{name: "file", args: []string{"-config", file}, wantPort: 1001, wantJobs: 3, wantLevel: "debug"},
+		{name: "file from the environment", env: map[string]string{"AGENT_CONFIG": file}, wantPort: 1001, wantJobs: 3, wantLevel: "debug"},
+		{
+			name:     "environment over file",
+			args:     []string{"-config", file},
+			env:      map[string]string{"LISTEN_PORT": "1002", "LOG_LEVEL": "warn"},
+			wantPort: 1002, wantJobs: 3, wantLevel: "warn",
+		},
+		{
+			name:     "flags over environment",
+			args:     []string{"-config", file, "-port", "1003", "-max-jobs", "5"},
+			env:      map[string]string{"LISTEN_PORT": "1002", "MAX_JOBS": "4"},
+			wantPort: 1003, wantJobs: 5, wantLevel: "debug",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			clearEnv(t)
+			for name, value := range tc.env {
+				t.Setenv(name, value)
+			}
+			c, _, err := Load(tc.args)
+			if err != nil {
+				t.Fatalf("Load() = %v", err)
+			}
+			if c.Server.Port != tc.wantPort || c.JobsConfig.MaxJobs != tc.wantJobs || c.Log.Level != tc.wantLevel {
+				t.Errorf("port, max jobs, log level = %d, %d, %s, want %d, %d, %s", c.Server.Port, c.JobsConfig.MaxJobs, c.Log.Level, tc.wantPort, tc.wantJobs, tc.wantLevel)
+			}
+		})
+	}
+}
+
+func TestLoadArgs(t *testing.T) {
+	clearEnv(t)
+	_, args, err := Load([]string{"-port", "1001", "migrate", "up"})
+	if err != nil {
+		t.Fatalf("Load() = %v", err)
+	}
+	if !slices.Equal(args, []string{"migrate", "up"}) {
+		t.Errorf("Load() left %q, want the migrate arguments", args)
+	}
+	for _, args := range [][]string{{"-bogus"}, {"-port", "many"}, {"-port", "0"}} {
+		if _, _, err := Load(args); err == nil {
+			t.Errorf("Load(%q) succeeded", args)
+		}
+	}
+	t.Setenv("MAX_JOBS", "many")
+	if _, _, err := Load(nil); err == nil || !strings.Contains(err.Error(), "MAX_JOBS") {
+		t.Errorf("Load() with an invalid MAX_JOBS = %v, want an error naming it", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		change func(c *AgentConfig)
+		want   string
+	}{
+		{name: "defaults", change: func(c *AgentConfig) {}},
+		{name: "TLS", change: func(c *AgentConfig) { c.Server.Cert, c.Server.Key = "cert.pem", "key.pem" }},
+		{name: "mutual TLS", change: func(c *AgentConfig) {
+			c.Server.Cert, c.Server.Key, c.Server.CACert = "cert.pem", "key.pem", "ca.pem"
+		}},
+		{name: "port 0", change: func(c *AgentConfig) { c.Server.Port = 0 }, want: "invalid port 0"},
+		{name: "port too high", change: func(c *AgentConfig) { c.Server.Port = 65536 }, want: "invalid port 65536"},
+		{name: "database port", change: func(c *AgentConfig) { c.DbConfig.Port = -1 }, want: "invalid database port"},
+		{name: "certificate without key", change: func(c *AgentConfig) { c.Server.Cert = "cert.pem" }, want: "TLS needs both"},
+		{name: "key without certificate", change: func(c *AgentConfig) { c.Server.Key = "key.pem" }, want: "TLS needs both"},
+		{name: "CA without TLS", change: func(c *AgentConfig) { c.Server.CACert = "ca.pem" }, want: "needs TLS"},
+		{name: "negative max jobs", change: func(c *AgentConfig) { c.JobsConfig.MaxJobs = -1 }, want: "invalid max jobs -1"},
+		{name: "negative max jobs per owner", change: func(c *AgentConfig) { c.MaxJobsPerOwner = -1 }, want: "max jobs per owner"},
+		{name: "negative output limit", change: func(c *AgentConfig) { c.OutputLimit = -1 }, want: "invalid output limit"},
+		{name: "negative retention", change: func(c *AgentConfig) { c.MaxAge = -time.Hour }, want: "retention max age"},
+		{name: "retention interval", change: func(c *AgentConfig) { c.Interval = 0 }, want: "retention interval"},
+		{name: "driver", change: func(c *AgentConfig) { c.Driver = "oracle" }, want: "invalid database driver"},
+		{name: "output limit mode", change: func(c *AgentConfig) { c.OutputLimitMode = "truncate" }, want: "output limit mode"},
+		{name: "dir store without dir", change: func(c *AgentConfig) { c.Dir = "" }, want: "needs an output directory"},
+		{name: "log level", change: func(c *AgentConfig) { c.Log.Level = "loud" }, want: "invalid log level"},
+		{name: "sample ratio", change: func(c *AgentConfig) { c.Tracing.SampleRatio = 2 }, want: "sample ratio"},
+		{name: "redact pattern", change: func(c *AgentConfig) { c.Redact.Patterns = []string{"("} }, want: "invalid redact pattern"},
+		{name: "metrics address", change: func(c *AgentConfig) { c.Metrics.Listen = "9090" }, want: "metrics listen address"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := defaultAgentConfig()
+			c.resolve()
+			tc.change(c)
+			err := c.Validate()
+			if tc.want == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Validate() = %v, want an error containing %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestDecodeFile(t *testing.T) {
+	for _, tc := range []struct {
+		name, content string
+		want          string
+	}{
+		{name: "agent.yaml", content: "server:\n  port: 1001\n"},
+		{name: "agent.yml", content: ""},
+		{name: "agent.toml", content: "[server]\nport = 1001\n"},
+		{name: "agent.yaml", content: "server:\n  prot: 1001\n", want: "prot"},
+		{name: "agent.yaml", content: "servers:\n  port: 1001\n", want: "servers"},
+		{name: "agent.toml", content: "[server]\nprot = 1001\n", want: "server.prot"},
+		{name: "agent.toml", content: "[jobs]\nmax_job = 2\n", want: "jobs.max_job"},
+		{name: "agent.yaml", content: "server: [", want: "invalid configuration file"},
+		{name: "agent.json", content: "{}", want: "unsupported configuration file"},
+	} {
+		var c AgentConfig
+		err := DecodeFile(writeFile(t, tc.name, tc.content), &c)
+		if tc.want == "" {
+			if err != nil {
+				t.Errorf("DecodeFile(%s %q) = %v", tc.name, tc.content, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("DecodeFile(%s %q) = %v, want an error containing %q", tc.name, tc.content, err, tc.want)
+		}
+	}
+}
+
+func TestRestartRequired(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		change func(c *AgentConfig)
+		want   []string
+	}{
+		{name: "nothing", change: func(c *AgentConfig) {}},
+		// these apply on reload
+		{name: "job limits", change: func(c *AgentConfig) { c.JobsConfig.MaxJobs, c.MaxJobsPerOwner = 4, 2 }},
+		{name: "policy", change: func(c *AgentConfig) { c.PolicyFile = "policy.yaml" }},
+		{name: "redact", change: func(c *AgentConfig) { c.Redact.Patterns = []string{"secret"} }},
+		{name: "log", change: func(c *AgentConfig) { c.Log.Level = "debug" }},
+		// these need a restart
+		{name: "port", change: func(c *AgentConfig) { c.Server.Port = 1001 }, want: []string{"server"}},
+		{name: "database", change: func(c *AgentConfig) { c.Path = "other.db" }, want: []string{"db"}},
+		{name: "output store", change: func(c *AgentConfig) { c.Store = OutputStoreDB }, want: []string{"output"}},
+		{name: "retention", change: func(c *AgentConfig) { c.RetentionConfig.MaxJobs = 5 }, want: []string{"retention"}},
+		{name: "keepalive", change: func(c *AgentConfig) { c.KeepaliveConfig.Time = time.Minute }, want: []string{"keepalive"}},
+		{name: "metrics", change: func(c *AgentConfig) { c.Metrics.Listen = ":9090" }, want: []string{"metrics"}},
+		{name: "tracing", change: func(c *AgentConfig) { c.Tracing.SampleRatio = 0.5 }, want: []string{"tracing"}},
+		{name: "several", change: func(c *AgentConfig) {
+			c.Server.Port, c.Log.Level, c.Tracing.File = 1001, "debug", "traces.json"
+		}, want: []string{"server", "tracing"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			running, next := defaultAgentConfig(), defaultAgentConfig()
+			tc.change(next)
+			if got := running.RestartRequired(next); !slices.Equal(got, tc.want) {
+				t.Errorf("RestartRequired() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
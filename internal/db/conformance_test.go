@@ -0,0 +1,416 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stewyb314/remote-control/internal/config"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// testDbConfig returns the database settings of the agent's defaults and
+// environment, e.g. DB_USER for a server backend.
+func testDbConfig(t *testing.T) config.DbConfig {
+	t.Helper()
+	conf, _, err := config.Load(nil)
+	if err != nil {
+		t.Fatalf("invalid agent configuration: %v", err)
+	}
+	return conf.DbConfig
+}
+
+// backends returns every DB implementation the conformance suite runs
+// against. The server backed ones are only included when a server is
+// available, e.g. RC_TEST_MYSQL_HOST=127.0.0.1 with `make agent-up`.
+func backends() map[string]func(t *testing.T) DB {
+	b := map[string]func(t *testing.T) DB{
+		"memory": func(t *testing.T) DB {
+			return NewMemory()
+		},
+		"instrumented": func(t *testing.T) DB {
+			return Instrument(NewMemory())
+		},
+		"sqlite": func(t *testing.T) DB {
+			conf := testDbConfig(t)
+			conf.Path = filepath.Join(t.TempDir(), "executions.db")
+			d, err := NewSQLite(conf)
+			if err != nil {
+				t.Fatalf("failed to open sqlite: %v", err)
+			}
+			return d
+		},
+	}
+	if host := os.Getenv("RC_TEST_MYSQL_HOST"); host != "" {
+		b["mysql"] = func(t *testing.T) DB {
+			conf := testDbConfig(t)
+			conf.Host, conf.Port = host, 3306
+			d, err := NewMySQL(conf)
+			if err != nil {
+				t.Fatalf("failed to open mysql: %v", err)
+			}
+			return d
+		}
+	}
+	if host := os.Getenv("RC_TEST_POSTGRES_HOST"); host != "" {
+		b["postgres"] = func(t *testing.T) DB {
+			conf := testDbConfig(t)
+			conf.Host, conf.Port = host, 5432
+			d, err := NewPostgres(conf)
+			if err != nil {
+				t.Fatalf("failed to open postgres: %v", err)
+			}
+			return d
+		}
+	}
+	return b
+}
+
+func TestConformance(t *testing.T) {
+	for name, open := range backends() {
+		t.Run(name, func(t *testing.T) {
+			d := open(t)
+			if err := d.Migrate(); err != nil {
+				t.Fatalf("Migrate() = %v", err)
+			}
+			if err := d.Ping(context.Background()); err != nil {
+				t.Fatalf("Ping() = %v", err)
+			}
+			t.Run("CreateAndGet", func(t *testing.T) { testCreateAndGet(t, d) })
+			t.Run("GetMissing", func(t *testing.T) { testGetMissing(t, d) })
+			t.Run("CreateDuplicate", func(t *testing.T) { testCreateDuplicate(t, d) })
+			t.Run("Update", func(t *testing.T) { testUpdate(t, d) })
+			t.Run("ListAndDelete", func(t *testing.T) { testListAndDelete(t, d) })
+			t.Run("Schedules", func(t *testing.T) { testSchedules(t, d) })
+			t.Run("Workflows", func(t *testing.T) { testWorkflows(t, d) })
+			t.Run("OutputChunks", func(t *testing.T) { testOutputChunks(t, d) })
+			t.Run("MigrateDownAndUp", func(t *testing.T) { testMigrateDownAndUp(t, d) })
+		})
+	}
+}
+
+func newExecution(t *testing.T, args ...string) Execution {
+	a, err := json.Marshal(args)
+	if err != nil {
+		t.Fatalf("failed to marshal args: %v", err)
+	}
+	return Execution{
+		ID:      uuid.New().String(),
+		Command: "echo",
+		Args:    datatypes.JSON(a),
+		Status:  4,
+	}
+}
+
+func testCreateAndGet(t *testing.T, d DB) {
+	want := newExecution(t, "hello", "world")
+	if err := d.CreateExecution(want); err != nil {
+		t.Fatalf("CreateExecution() = %v", err)
+	}
+	got, err := d.GetExecution(want.ID)
+	if err != nil {
+		t.Fatalf("GetExecution() = %v", err)
+	}
+	if got.ID != want.ID || got.Command != want.Command || got.Status != want.Status {
+		t.Errorf("GetExecution() = %+v, want %+v", got, want)
+	}
+	if got.CreatedAt == 0 || got.UpdatedAt == 0 {
+		t.Errorf("timestamps not set: created %d updated %d", got.CreatedAt, got.UpdatedAt)
+	}
+	var args []string
+	if err := json.Unmarshal(got.Args, &args); err != nil {
+		t.Fatalf("failed to unmarshal args %q: %v", got.Args, err)
+	}
+	if len(args) != 2 || args[0] != "hello" || args[1] != "world" {
+		t.Errorf("args = %v, want [hello world]", args)
+	}
+}
+
+func testGetMissing(t *testing.T, d DB) {
+	_, err := d.GetExecution(uuid.New().String())
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("GetExecution() = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+}
+
+func testCreateDuplicate(t *testing.T, d DB) {
+	exec := newExecution(t)
+	if err := d.CreateExecution(exec); err != nil {
+		t.Fatalf("CreateExecution() = %v", err)
+	}
+	if err := d.CreateExecution(exec); err == nil {
+		t.Errorf("CreateExecution() with duplicate ID succeeded")
+	}
+}
+
+func testUpdate(t *testing.T, d DB) {
+	exec := newExecution(t, "a")
+	if err := d.CreateExecution(exec); err != nil {
+		t.Fatalf("CreateExecution() = %v", err)
+	}
+	got, err := d.GetExecution(exec.ID)
+	if err != nil {
+		t.Fatalf("GetExecution() = %v", err)
+	}
+	got.Status = 1
+	got.ExitCode = 3
+	got.Error = "agent restarted"
+	if err := d.UpdateExecution(*got); err != nil {
+		t.Fatalf("UpdateExecution() = %v", err)
+	}
+	updated, err := d.GetExecution(exec.ID)
+	if err != nil {
+		t.Fatalf("GetExecution() = %v", err)
+	}
+	if updated.Status != 1 || updated.ExitCode != 3 || updated.Error != got.Error {
+		t.Errorf("after update status %d exit %d error %q, want 1, 3 and %q", updated.Status, updated.ExitCode, updated.Error, got.Error)
+	}
+	if updated.Command != exec.Command || string(updated.Args) != string(got.Args) {
+		t.Errorf("update changed untouched fields: %+v", updated)
+	}
+}
+
+func testMigrateDownAndUp(t *testing.T, d DB) {
+	if err := d.MigrateTo(0); err != nil {
+		t.Fatalf("MigrateTo(0) = %v", err)
+	}
+	if v, err := d.SchemaVersion(); err != nil || v != 0 {
+		t.Fatalf("SchemaVersion() = %d, %v, want 0", v, err)
+	}
+	if err := d.Migrate(); err != nil {
+		t.Fatalf("Migrate() = %v", err)
+	}
+	if v, err := d.SchemaVersion(); err != nil || v != LatestSchemaVersion() {
+		t.Fatalf("SchemaVersion() = %d, %v, want %d", v, err, LatestSchemaVersion())
+	}
+	if err := d.MigrateTo(LatestSchemaVersion() + 1); err == nil {
+		t.Errorf("MigrateTo() an unknown version succeeded")
+	}
+	testCreateAndGet(t, d)
+}
+
+func testOutputChunks(t *testing.T, d DB) {
+	exec := newExecution(t)
+	if err := d.CreateExecution(exec); err != nil {
+		t.Fatalf("CreateExecution() = %v", err)
+	}
+	var start int64
+	for _, data := range []string{"first\n", "second\n", "third\n"} {
+		chunk := OutputChunk{ExecutionID: exec.ID, Start: start, Size: len(data), Data: []byte(data)}
+		if err := d.CreateOutputChunk(chunk); err != nil {
+			t.Fatalf("CreateOutputChunk() = %v", err)
+		}
+		start += int64(len(data))
+	}
+
+	chunks, err := d.GetOutputChunks(exec.ID, 8, 10)
+	if err != nil {
+		t.Fatalf("GetOutputChunks() = %v", err)
+	}
+	if len(chunks) != 2 || string(chunks[0].Data) != "second\n" || string(chunks[1].Data) != "third\n" {
+		t.Errorf("GetOutputChunks(8) = %+v, want second and third", chunks)
+	}
+	chunks, err = d.GetOutputChunks(exec.ID, 0, 1)
+	if err != nil || len(chunks) != 1 || chunks[0].Start != 0 {
+		t.Errorf("GetOutputChunks(0, 1) = %+v, %v, want the first chunk", chunks, err)
+	}
+
+	if err := d.DeleteOutputChunks(exec.ID); err != nil {
+		t.Fatalf("DeleteOutputChunks() = %v", err)
+	}
+	chunks, err = d.GetOutputChunks(exec.ID, 0, 10)
+	if err != nil || len(chunks) != 0 {
+		t.Errorf("GetOutputChunks() after delete = %+v, %v", chunks, err)
+	}
+}
+
+func testListAndDelete(t *testing.T, d DB) {
+	// executions created "in 1970" so rows of other tests are not listed
+	var ids []string
+	for i, status := range []int32{1, 4, 2} {
+		exec := newExecution(t)
+		exec.Status = status
+		exec.CreatedAt = int64(i + 1)
+		if i != 1 {
+			exec.Owner = "alice"
+		}
+		if err := d.CreateExecution(exec); err != nil {
+			t.Fatalf("CreateExecution() = %v", err)
+		}
+		ids = append(ids, exec.ID)
+	}
+
+	all, err := d.ListExecutions(ExecutionFilter{CreatedBefore: 4})
+	if err != nil {
+		t.Fatalf("ListExecutions() = %v", err)
+	}
+	if len(all) != 3 || all[0].ID != ids[0] || all[2].ID != ids[2] {
+		t.Errorf("ListExecutions() = %+v, want oldest first", all)
+	}
+	done, err := d.ListExecutions(ExecutionFilter{CreatedBefore: 4, States: []int32{1, 2}, Limit: 1})
+	if err != nil {
+		t.Fatalf("ListExecutions() = %v", err)
+	}
+	if len(done) != 1 || done[0].ID != ids[0] {
+		t.Errorf("ListExecutions() with states and limit = %+v, want %s", done, ids[0])
+	}
+	newest, err := d.ListExecutions(ExecutionFilter{CreatedBefore: 4, Owner: "alice", NewestFirst: true, Limit: 2})
+	if err != nil {
+		t.Fatalf("ListExecutions() = %v", err)
+	}
+	if len(newest) != 2 || newest[0].ID != ids[2] || newest[1].ID != ids[0] {
+		t.Errorf("ListExecutions() of an owner newest first = %+v, want %s, %s", newest, ids[2], ids[0])
+	}
+
+	for _, id := range ids {
+		if err := d.DeleteExecution(id); err != nil {
+			t.Fatalf("DeleteExecution() = %v", err)
+		}
+	}
+	if _, err := d.GetExecution(ids[0]); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("GetExecution() after delete = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+	all, err = d.ListExecutions(ExecutionFilter{CreatedBefore: 4})
+	if err != nil || len(all) != 0 {
+		t.Errorf("ListExecutions() after delete = %+v, %v", all, err)
+	}
+}
+
+func testSchedules(t *testing.T, d DB) {
+	schedule := Schedule{
+		ID:      uuid.New().String(),
+		Cron:    "@hourly",
+		Request: datatypes.JSON(`{"command":"uptime"}`),
+	}
+	if err := d.CreateSchedule(schedule); err != nil {
+		t.Fatalf("CreateSchedule() = %v", err)
+	}
+	got, err := d.GetSchedule(schedule.ID)
+	if err != nil {
+		t.Fatalf("GetSchedule() = %v", err)
+	}
+	if got.Cron != schedule.Cron || got.CreatedAt == 0 {
+		t.Errorf("GetSchedule() = %+v, want %+v", got, schedule)
+	}
+	var req map[string]string
+	if err := json.Unmarshal(got.Request, &req); err != nil || req["command"] != "uptime" {
+		t.Errorf("request = %s, %v", got.Request, err)
+	}
+
+	got.LastExecutionID = "job"
+	got.LastRunAt = 10
+	if err := d.UpdateSchedule(*got); err != nil {
+		t.Fatalf("UpdateSchedule() = %v", err)
+	}
+	schedules, err := d.ListSchedules()
+	if err != nil {
+		t.Fatalf("ListSchedules() = %v", err)
+	}
+	found := false
+	for _, s := range schedules {
+		if s.ID == schedule.ID {
+			found = true
+			if s.LastExecutionID != "job" || s.LastRunAt != 10 {
+				t.Errorf("ListSchedules() returned %+v, update lost", s)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("ListSchedules() = %+v, missing %s", schedules, schedule.ID)
+	}
+
+	if err := d.DeleteSchedule(schedule.ID); err != nil {
+		t.Fatalf("DeleteSchedule() = %v", err)
+	}
+	if _, err := d.GetSchedule(schedule.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("GetSchedule() after delete = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+	if err := d.DeleteSchedule(schedule.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("DeleteSchedule() of a deleted schedule = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+}
+
+func testWorkflows(t *testing.T, d DB) {
+	workflow := Workflow{
+		ID:      uuid.New().String(),
+		Name:    "disk",
+		Status:  4,
+		Request: datatypes.JSON(`{"name":"disk"}`),
+	}
+	if err := d.CreateWorkflow(workflow); err != nil {
+		t.Fatalf("CreateWorkflow() = %v", err)
+	}
+	step := newExecution(t)
+	step.WorkflowID = workflow.ID
+	step.Step = "df"
+	if err := d.CreateExecution(step); err != nil {
+		t.Fatalf("CreateExecution() = %v", err)
+	}
+	other := newExecution(t)
+	if err := d.CreateExecution(other); err != nil {
+		t.Fatalf("CreateExecution() = %v", err)
+	}
+	steps, err := d.ListExecutions(ExecutionFilter{WorkflowID: workflow.ID})
+	if err != nil {
+		t.Fatalf("ListExecutions() = %v", err)
+	}
+	if len(steps) != 1 || steps[0].ID != step.ID || steps[0].Step != "df" {
+		t.Errorf("ListExecutions() of workflow = %+v, want %s", steps, step.ID)
+	}
+
+	workflow.Status = 1
+	if err := d.UpdateWorkflow(workflow); err != nil {
+		t.Fatalf("UpdateWorkflow() = %v", err)
+	}
+	got, err := d.GetWorkflow(workflow.ID)
+	if err != nil {
+		t.Fatalf("GetWorkflow() = %v", err)
+	}
+	if got.Name != "disk" || got.Status != 1 {
+		t.Errorf("GetWorkflow() = %+v, want %+v", got, workflow)
+	}
+	for status, want := range map[int32]int{1: 1, 4: 0} {
+		workflows, err := d.ListWorkflows(status)
+		if err != nil {
+			t.Fatalf("ListWorkflows() = %v", err)
+		}
+		if len(workflows) != want || (want == 1 && workflows[0].ID != workflow.ID) {
+			t.Errorf("ListWorkflows(%d) = %+v, want %d workflows", status, workflows, want)
+		}
+	}
+	if _, err := d.GetWorkflow(uuid.New().String()); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("GetWorkflow() of a missing workflow = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+	if err := d.DeleteWorkflow(workflow.ID); err != nil {
+		t.Fatalf("DeleteWorkflow() = %v", err)
+	}
+	if _, err := d.GetWorkflow(workflow.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("GetWorkflow() of a deleted workflow = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+	if err := d.DeleteWorkflow(workflow.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("DeleteWorkflow() twice = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+	retry := newExecution(t)
+	retry.RetryOf = step.ID
+	retry.Attempt = 2
+	if err := d.CreateExecution(retry); err != nil {
+		t.Fatalf("CreateExecution() = %v", err)
+	}
+	retries, err := d.ListExecutions(ExecutionFilter{RetryOf: step.ID})
+	if err != nil {
+		t.Fatalf("ListExecutions() = %v", err)
+	}
+	if len(retries) != 1 || retries[0].ID != retry.ID || retries[0].Attempt != 2 {
+		t.Errorf("ListExecutions() of retries = %+v, want %s", retries, retry.ID)
+	}
+	for _, id := range []string{step.ID, other.ID, retry.ID} {
+		if err := d.DeleteExecution(id); err != nil {
+			t.Fatalf("DeleteExecution() = %v", err)
+		}
+	}
+}
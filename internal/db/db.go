@@ -1,8 +1,70 @@
 package db
 
+import (
+	"context"
+	"fmt"
+
+	"github.com/stewyb314/remote-control/internal/config"
+)
+
 type DB interface{
 	GetExecution(id string) (*Execution, error)
 	CreateExecution(execution Execution) error
 	UpdateExecution(execution Execution) error
+	// ListExecutions returns the executions matching filter, oldest first
+	ListExecutions(filter ExecutionFilter) ([]Execution, error)
+	// DeleteExecution removes an execution, its output is not touched
+	DeleteExecution(id string) error
+	CreateSchedule(schedule Schedule) error
+	GetSchedule(id string) (*Schedule, error)
+	UpdateSchedule(schedule Schedule) error
+	// ListSchedules returns all schedules, oldest first
+	ListSchedules() ([]Schedule, error)
+	DeleteSchedule(id string) error
+	CreateWorkflow(workflow Workflow) error
+	GetWorkflow(id string) (*Workflow, error)
+	UpdateWorkflow(workflow Workflow) error
+	// ListWorkflows returns the workflows with status, oldest first
+	ListWorkflows(status int32) ([]Workflow, error)
+	// DeleteWorkflow removes a workflow, its steps are not touched
+	DeleteWorkflow(id string) error
+	// CreateOutputChunk stores a piece of a job's output
+	CreateOutputChunk(chunk OutputChunk) error
+	// GetOutputChunks returns up to limit chunks of a job's output that end
+	// after offset, ordered by position
+	GetOutputChunks(id string, offset int64, limit int) ([]OutputChunk, error)
+	// DeleteOutputChunks removes all stored output of a job
+	DeleteOutputChunks(id string) error
+	// ListLegacyOutputs returns the output files of jobs from before output
+	// stores that are left to import
+	ListLegacyOutputs() ([]LegacyOutput, error)
+	// DeleteLegacyOutput forgets the output file of a job once imported
+	DeleteLegacyOutput(executionID string) error
+	// Migrate applies all pending schema migrations
 	Migrate() error
-}
\ No newline at end of file
+	// MigrateTo applies or reverts migrations until the schema is at version
+	MigrateTo(version int) error
+	// SchemaVersion returns the version of the most recent applied migration
+	SchemaVersion() (int, error)
+	// Ping checks that the database is reachable
+	Ping(ctx context.Context) error
+	// WithContext returns a DB whose operations run in ctx, e.g. to trace
+	// them as part of a request
+	WithContext(ctx context.Context) DB
+}
+
+// New opens the backend selected by conf.Driver.
+func New(conf config.DbConfig) (DB, error) {
+	switch conf.Driver {
+	case config.DriverSQLite:
+		return NewSQLite(conf)
+	case config.DriverMySQL:
+		return NewMySQL(conf)
+	case config.DriverPostgres:
+		return NewPostgres(conf)
+	case config.DriverMemory:
+		return NewMemory(), nil
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", conf.Driver)
+	}
+}
@@ -0,0 +1,182 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// gormDB implements DB on top of any gorm dialector. The backend specific
+// types embed it and only differ in how the connection is opened.
+type gormDB struct {
+	db *gorm.DB
+}
+
+func (g gormDB) GetExecution(id string) (*Execution, error) {
+	var execution Execution
+	tx := g.db.First(&execution, "id = ?", id)
+	return &execution, tx.Error
+}
+
+func (g gormDB) CreateExecution(execution Execution) error {
+	tx := g.db.Create(&execution)
+	if tx.Error != nil {
+		return fmt.Errorf("error creating execution: %v", tx.Error)
+	}
+
+	return nil
+}
+
+func (g gormDB) UpdateExecution(exec Execution) error {
+	tx := g.db.Save(&exec)
+	return tx.Error
+}
+
+func (g gormDB) ListExecutions(filter ExecutionFilter) ([]Execution, error) {
+	var executions []Execution
+	tx := g.db.Order("created_at, id")
+	if filter.NewestFirst {
+		tx = g.db.Order("created_at DESC, id DESC")
+	}
+	if len(filter.States) > 0 {
+		tx = tx.Where("status IN ?", filter.States)
+	}
+	if filter.CreatedBefore > 0 {
+		tx = tx.Where("created_at < ?", filter.CreatedBefore)
+	}
+	if filter.WorkflowID != "" {
+		tx = tx.Where("workflow_id = ?", filter.WorkflowID)
+	}
+	if filter.RetryOf != "" {
+		tx = tx.Where("retry_of = ?", filter.RetryOf)
+	}
+	if filter.IdempotencyKey != "" {
+		tx = tx.Where("idempotency_key = ?", filter.IdempotencyKey)
+	}
+	if filter.CreatedAfter > 0 {
+		tx = tx.Where("created_at >= ?", filter.CreatedAfter)
+	}
+	if filter.Owner != "" {
+		tx = tx.Where("owner = ?", filter.Owner)
+	}
+	if filter.Limit > 0 {
+		tx = tx.Limit(filter.Limit)
+	}
+	tx = tx.Find(&executions)
+	return executions, tx.Error
+}
+
+func (g gormDB) DeleteExecution(id string) error {
+	tx := g.db.Delete(&Execution{}, "id = ?", id)
+	return tx.Error
+}
+
+func (g gormDB) CreateSchedule(schedule Schedule) error {
+	tx := g.db.Create(&schedule)
+	if tx.Error != nil {
+		return fmt.Errorf("error creating schedule: %v", tx.Error)
+	}
+	return nil
+}
+
+func (g gormDB) GetSchedule(id string) (*Schedule, error) {
+	var schedule Schedule
+	tx := g.db.First(&schedule, "id = ?", id)
+	return &schedule, tx.Error
+}
+
+func (g gormDB) UpdateSchedule(schedule Schedule) error {
+	tx := g.db.Save(&schedule)
+	return tx.Error
+}
+
+func (g gormDB) ListSchedules() ([]Schedule, error) {
+	var schedules []Schedule
+	tx := g.db.Order("created_at, id").Find(&schedules)
+	return schedules, tx.Error
+}
+
+func (g gormDB) DeleteSchedule(id string) error {
+	tx := g.db.Delete(&Schedule{}, "id = ?", id)
+	if tx.Error == nil && tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return tx.Error
+}
+
+func (g gormDB) CreateWorkflow(workflow Workflow) error {
+	tx := g.db.Create(&workflow)
+	if tx.Error != nil {
+		return fmt.Errorf("error creating workflow: %v", tx.Error)
+	}
+	return nil
+}
+
+func (g gormDB) GetWorkflow(id string) (*Workflow, error) {
+	var workflow Workflow
+	tx := g.db.First(&workflow, "id = ?", id)
+	return &workflow, tx.Error
+}
+
+func (g gormDB) UpdateWorkflow(workflow Workflow) error {
+	tx := g.db.Save(&workflow)
+	return tx.Error
+}
+
+func (g gormDB) ListWorkflows(status int32) ([]Workflow, error) {
+	var workflows []Workflow
+	tx := g.db.Where("status = ?", status).Order("created_at, id").Find(&workflows)
+	return workflows, tx.Error
+}
+
+func (g gormDB) DeleteWorkflow(id string) error {
+	tx := g.db.Delete(&Workflow{}, "id = ?", id)
+	if tx.Error == nil && tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return tx.Error
+}
+
+func (g gormDB) CreateOutputChunk(chunk OutputChunk) error {
+	tx := g.db.Create(&chunk)
+	if tx.Error != nil {
+		return fmt.Errorf("error creating output chunk: %v", tx.Error)
+	}
+	return nil
+}
+
+func (g gormDB) GetOutputChunks(id string, offset int64, limit int) ([]OutputChunk, error) {
+	var chunks []OutputChunk
+	tx := g.db.Where("execution_id = ? AND start + size > ?", id, offset).
+		Order("start").Limit(limit).Find(&chunks)
+	return chunks, tx.Error
+}
+
+func (g gormDB) WithContext(ctx context.Context) DB {
+	return gormDB{db: g.db.WithContext(ctx)}
+}
+
+func (g gormDB) Ping(ctx context.Context) error {
+	sqlDB, err := g.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+func (g gormDB) DeleteOutputChunks(id string) error {
+	tx := g.db.Where("execution_id = ?", id).Delete(&OutputChunk{})
+	return tx.Error
+}
+
+func (g gormDB) ListLegacyOutputs() ([]LegacyOutput, error) {
+	var outputs []LegacyOutput
+	tx := g.db.Order("execution_id").Find(&outputs)
+	return outputs, tx.Error
+}
+
+func (g gormDB) DeleteLegacyOutput(executionID string) error {
+	tx := g.db.Delete(&LegacyOutput{}, "execution_id = ?", executionID)
+	return tx.Error
+}
@@ -0,0 +1,179 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/stewyb314/remote-control/internal/metrics"
+	"github.com/stewyb314/remote-control/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// Instrument returns d with the latency and the errors of every operation
+// recorded in the agent's metrics. Looking up a missing record is not an
+// error there. Operations run with a context from WithContext are traced
+// as part of its span.
+func Instrument(d DB) DB {
+	return instrumented{db: d, ctx: context.Background()}
+}
+
+type instrumented struct {
+	db  DB
+	ctx context.Context
+}
+
+// observe starts timing and tracing an operation. The returned function
+// records it once it returned err.
+func (i instrumented) observe(operation string) func(err *error) {
+	start := time.Now()
+	var span trace.Span
+	// operations outside of a traced request, e.g. of the retention
+	// sweeper, are not worth traces of their own
+	if trace.SpanContextFromContext(i.ctx).IsValid() {
+		_, span = tracing.Tracer().Start(i.ctx, "db."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attribute.String("db.operation.name", operation)))
+	}
+	return func(err *error) {
+		e := *err
+		if errors.Is(e, gorm.ErrRecordNotFound) {
+			e = nil
+		}
+		metrics.ObserveDB(operation, start, e)
+		if span != nil {
+			if e != nil {
+				span.RecordError(e)
+				span.SetStatus(codes.Error, e.Error())
+			}
+			span.End()
+		}
+	}
+}
+
+func (i instrumented) WithContext(ctx context.Context) DB {
+	return instrumented{db: i.db.WithContext(ctx), ctx: ctx}
+}
+
+func (i instrumented) GetExecution(id string) (execution *Execution, err error) {
+	defer i.observe("get_execution")(&err)
+	return i.db.GetExecution(id)
+}
+
+func (i instrumented) CreateExecution(execution Execution) (err error) {
+	defer i.observe("create_execution")(&err)
+	return i.db.CreateExecution(execution)
+}
+
+func (i instrumented) UpdateExecution(execution Execution) (err error) {
+	defer i.observe("update_execution")(&err)
+	return i.db.UpdateExecution(execution)
+}
+
+func (i instrumented) ListExecutions(filter ExecutionFilter) (executions []Execution, err error) {
+	defer i.observe("list_executions")(&err)
+	return i.db.ListExecutions(filter)
+}
+
+func (i instrumented) DeleteExecution(id string) (err error) {
+	defer i.observe("delete_execution")(&err)
+	return i.db.DeleteExecution(id)
+}
+
+func (i instrumented) CreateSchedule(schedule Schedule) (err error) {
+	defer i.observe("create_schedule")(&err)
+	return i.db.CreateSchedule(schedule)
+}
+
+func (i instrumented) GetSchedule(id string) (schedule *Schedule, err error) {
+	defer i.observe("get_schedule")(&err)
+	return i.db.GetSchedule(id)
+}
+
+func (i instrumented) UpdateSchedule(schedule Schedule) (err error) {
+	defer i.observe("update_schedule")(&err)
+	return i.db.UpdateSchedule(schedule)
+}
+
+func (i instrumented) ListSchedules() (schedules []Schedule, err error) {
+	defer i.observe("list_schedules")(&err)
+	return i.db.ListSchedules()
+}
+
+func (i instrumented) DeleteSchedule(id string) (err error) {
+	defer i.observe("delete_schedule")(&err)
+	return i.db.DeleteSchedule(id)
+}
+
+func (i instrumented) CreateWorkflow(workflow Workflow) (err error) {
+	defer i.observe("create_workflow")(&err)
+	return i.db.CreateWorkflow(workflow)
+}
+
+func (i instrumented) GetWorkflow(id string) (workflow *Workflow, err error) {
+	defer i.observe("get_workflow")(&err)
+	return i.db.GetWorkflow(id)
+}
+
+func (i instrumented) UpdateWorkflow(workflow Workflow) (err error) {
+	defer i.observe("update_workflow")(&err)
+	return i.db.UpdateWorkflow(workflow)
+}
+
+func (i instrumented) ListWorkflows(status int32) (workflows []Workflow, err error) {
+	defer i.observe("list_workflows")(&err)
+	return i.db.ListWorkflows(status)
+}
+
+func (i instrumented) DeleteWorkflow(id string) (err error) {
+	defer i.observe("delete_workflow")(&err)
+	return i.db.DeleteWorkflow(id)
+}
+
+func (i instrumented) CreateOutputChunk(chunk OutputChunk) (err error) {
+	defer i.observe("create_output_chunk")(&err)
+	return i.db.CreateOutputChunk(chunk)
+}
+
+func (i instrumented) GetOutputChunks(id string, offset int64, limit int) (chunks []OutputChunk, err error) {
+	defer i.observe("get_output_chunks")(&err)
+	return i.db.GetOutputChunks(id, offset, limit)
+}
+
+func (i instrumented) DeleteOutputChunks(id string) (err error) {
+	defer i.observe("delete_output_chunks")(&err)
+	return i.db.DeleteOutputChunks(id)
+}
+
+func (i instrumented) ListLegacyOutputs() (outputs []LegacyOutput, err error) {
+	defer i.observe("list_legacy_outputs")(&err)
+	return i.db.ListLegacyOutputs()
+}
+
+func (i instrumented) DeleteLegacyOutput(executionID string) (err error) {
+	defer i.observe("delete_legacy_output")(&err)
+	return i.db.DeleteLegacyOutput(executionID)
+}
+
+func (i instrumented) Migrate() (err error) {
+	defer i.observe("migrate")(&err)
+	return i.db.Migrate()
+}
+
+func (i instrumented) MigrateTo(version int) (err error) {
+	defer i.observe("migrate")(&err)
+	return i.db.MigrateTo(version)
+}
+
+func (i instrumented) SchemaVersion() (version int, err error) {
+	defer i.observe("schema_version")(&err)
+	return i.db.SchemaVersion()
+}
+
+func (i instrumented) Ping(ctx context.Context) (err error) {
+	defer i.observe("ping")(&err)
+	return i.db.Ping(ctx)
+}
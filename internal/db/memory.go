@@ -0,0 +1,341 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Memory keeps executions in process memory. It behaves like the gorm
+// backends but nothing survives a restart, which makes it suitable for
+// tests and for agents that should not keep any history.
+type Memory struct {
+	mu         sync.RWMutex
+	executions map[string]Execution
+	chunks     map[string][]OutputChunk
+	schedules  map[string]Schedule
+	workflows  map[string]Workflow
+	version    int
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		executions: make(map[string]Execution),
+		chunks:     make(map[string][]OutputChunk),
+		schedules:  make(map[string]Schedule),
+		workflows:  make(map[string]Workflow),
+	}
+}
+
+func (m *Memory) GetExecution(id string) (*Execution, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	execution, ok := m.executions[id]
+	if !ok {
+		return &Execution{}, gorm.ErrRecordNotFound
+	}
+	execution = copyExecution(execution)
+	return &execution, nil
+}
+
+func (m *Memory) CreateExecution(execution Execution) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.executions[execution.ID]; ok {
+		return fmt.Errorf("error creating execution: %v", gorm.ErrDuplicatedKey)
+	}
+	now := time.Now().Unix()
+	if execution.CreatedAt == 0 {
+		execution.CreatedAt = now
+	}
+	if execution.UpdatedAt == 0 {
+		execution.UpdatedAt = now
+	}
+	m.executions[execution.ID] = copyExecution(execution)
+	return nil
+}
+
+func (m *Memory) UpdateExecution(execution Execution) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now().Unix()
+	if execution.CreatedAt == 0 {
+		execution.CreatedAt = now
+	}
+	execution.UpdatedAt = now
+	m.executions[execution.ID] = copyExecution(execution)
+	return nil
+}
+
+func (m *Memory) ListExecutions(filter ExecutionFilter) ([]Execution, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var executions []Execution
+	for _, execution := range m.executions {
+		if len(filter.States) > 0 && !slices.Contains(filter.States, execution.Status) {
+			continue
+		}
+		if filter.CreatedBefore > 0 && execution.CreatedAt >= filter.CreatedBefore {
+			continue
+		}
+		if filter.WorkflowID != "" && execution.WorkflowID != filter.WorkflowID {
+			continue
+		}
+		if filter.RetryOf != "" && execution.RetryOf != filter.RetryOf {
+			continue
+		}
+		if filter.IdempotencyKey != "" && execution.IdempotencyKey != filter.IdempotencyKey {
+			continue
+		}
+		if filter.CreatedAfter > 0 && execution.CreatedAt < filter.CreatedAfter {
+			continue
+		}
+		if filter.Owner != "" && execution.Owner != filter.Owner {
+			continue
+		}
+		executions = append(executions, copyExecution(execution))
+	}
+	sort.Slice(executions, func(i, j int) bool {
+		a, b := executions[i], executions[j]
+		if filter.NewestFirst {
+			a, b = b, a
+		}
+		if a.CreatedAt != b.CreatedAt {
+			return a.CreatedAt < b.CreatedAt
+		}
+		return a.ID < b.ID
+	})
+	if filter.Limit > 0 && len(executions) > filter.Limit {
+		executions = executions[:filter.Limit]
+	}
+	return executions, nil
+}
+
+func (m *Memory) DeleteExecution(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.executions, id)
+	return nil
+}
+
+func (m *Memory) CreateSchedule(schedule Schedule) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.schedules[schedule.ID]; ok {
+		return fmt.Errorf("error creating schedule: %v", gorm.ErrDuplicatedKey)
+	}
+	now := time.Now().Unix()
+	if schedule.CreatedAt == 0 {
+		schedule.CreatedAt = now
+	}
+	schedule.UpdatedAt = now
+	schedule.Request = bytes.Clone(schedule.Request)
+	m.schedules[schedule.ID] = schedule
+	return nil
+}
+
+func (m *Memory) GetSchedule(id string) (*Schedule, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	schedule, ok := m.schedules[id]
+	if !ok {
+		return &Schedule{}, gorm.ErrRecordNotFound
+	}
+	schedule.Request = bytes.Clone(schedule.Request)
+	return &schedule, nil
+}
+
+func (m *Memory) UpdateSchedule(schedule Schedule) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	schedule.UpdatedAt = time.Now().Unix()
+	schedule.Request = bytes.Clone(schedule.Request)
+	m.schedules[schedule.ID] = schedule
+	return nil
+}
+
+func (m *Memory) ListSchedules() ([]Schedule, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var schedules []Schedule
+	for _, schedule := range m.schedules {
+		schedule.Request = bytes.Clone(schedule.Request)
+		schedules = append(schedules, schedule)
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		if schedules[i].CreatedAt != schedules[j].CreatedAt {
+			return schedules[i].CreatedAt < schedules[j].CreatedAt
+		}
+		return schedules[i].ID < schedules[j].ID
+	})
+	return schedules, nil
+}
+
+func (m *Memory) DeleteSchedule(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.schedules[id]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delete(m.schedules, id)
+	return nil
+}
+
+func (m *Memory) CreateWorkflow(workflow Workflow) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.workflows[workflow.ID]; ok {
+		return fmt.Errorf("error creating workflow: %v", gorm.ErrDuplicatedKey)
+	}
+	now := time.Now().Unix()
+	if workflow.CreatedAt == 0 {
+		workflow.CreatedAt = now
+	}
+	workflow.UpdatedAt = now
+	workflow.Request = bytes.Clone(workflow.Request)
+	m.workflows[workflow.ID] = workflow
+	return nil
+}
+
+func (m *Memory) GetWorkflow(id string) (*Workflow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	workflow, ok := m.workflows[id]
+	if !ok {
+		return &Workflow{}, gorm.ErrRecordNotFound
+	}
+	workflow.Request = bytes.Clone(workflow.Request)
+	return &workflow, nil
+}
+
+func (m *Memory) UpdateWorkflow(workflow Workflow) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	workflow.UpdatedAt = time.Now().Unix()
+	workflow.Request = bytes.Clone(workflow.Request)
+	m.workflows[workflow.ID] = workflow
+	return nil
+}
+
+func (m *Memory) ListWorkflows(status int32) ([]Workflow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var workflows []Workflow
+	for _, workflow := range m.workflows {
+		if workflow.Status != status {
+			continue
+		}
+		workflow.Request = bytes.Clone(workflow.Request)
+		workflows = append(workflows, workflow)
+	}
+	sort.Slice(workflows, func(i, j int) bool {
+		if workflows[i].CreatedAt != workflows[j].CreatedAt {
+			return workflows[i].CreatedAt < workflows[j].CreatedAt
+		}
+		return workflows[i].ID < workflows[j].ID
+	})
+	return workflows, nil
+}
+
+func (m *Memory) DeleteWorkflow(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.workflows[id]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delete(m.workflows, id)
+	return nil
+}
+
+func (m *Memory) CreateOutputChunk(chunk OutputChunk) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	chunks := m.chunks[chunk.ExecutionID]
+	for _, c := range chunks {
+		if c.Start == chunk.Start {
+			return fmt.Errorf("error creating output chunk: %v", gorm.ErrDuplicatedKey)
+		}
+	}
+	chunk.Data = bytes.Clone(chunk.Data)
+	chunks = append(chunks, chunk)
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].Start < chunks[j].Start })
+	m.chunks[chunk.ExecutionID] = chunks
+	return nil
+}
+
+func (m *Memory) GetOutputChunks(id string, offset int64, limit int) ([]OutputChunk, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var chunks []OutputChunk
+	for _, c := range m.chunks[id] {
+		if len(chunks) == limit {
+			break
+		}
+		if c.Start+int64(c.Size) > offset {
+			c.Data = bytes.Clone(c.Data)
+			chunks = append(chunks, c)
+		}
+	}
+	return chunks, nil
+}
+
+func (m *Memory) DeleteOutputChunks(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.chunks, id)
+	return nil
+}
+
+// ListLegacyOutputs returns nothing, a memory database never held output
+// from before output stores.
+func (m *Memory) ListLegacyOutputs() ([]LegacyOutput, error) {
+	return nil, nil
+}
+
+func (m *Memory) DeleteLegacyOutput(executionID string) error {
+	return nil
+}
+
+func (m *Memory) Migrate() error {
+	return m.MigrateTo(LatestSchemaVersion())
+}
+
+// MigrateTo only records the version, there is no schema to change.
+func (m *Memory) MigrateTo(version int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := checkTarget(m.version, version); err != nil {
+		return err
+	}
+	m.version = version
+	return nil
+}
+
+func (m *Memory) SchemaVersion() (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.version, nil
+}
+
+// Ping always succeeds, there is no connection to lose.
+func (m *Memory) Ping(ctx context.Context) error {
+	return nil
+}
+
+// WithContext returns m, its operations do not block.
+func (m *Memory) WithContext(ctx context.Context) DB {
+	return m
+}
+
+// copyExecution returns a copy that does not share the Args buffer, so
+// callers can not modify stored executions behind the lock's back.
+func copyExecution(execution Execution) Execution {
+	execution.Args = bytes.Clone(execution.Args)
+	return execution
+}
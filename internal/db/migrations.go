@@ -0,0 +1,460 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// ErrSchemaTooNew is returned when the database was migrated by a newer
+// agent than this one. Running against it could corrupt data, so the agent
+// refuses to start.
+var ErrSchemaTooNew = errors.New("database schema is newer than this agent supports")
+
+// Migration is a single numbered schema change. Up and Down receive a
+// transaction and must only use the table snapshots declared alongside
+// them, never the live models, so that old steps keep producing the same
+// schema as the models evolve.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// migrations must be kept in ascending version order. Add new steps to the
+// end and never edit a step that has been released.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create executions",
+		Up: func(tx *gorm.DB) error {
+			// databases created by AutoMigrate already have the table
+			if tx.Migrator().HasTable(&executionV1{}) {
+				return nil
+			}
+			return tx.Migrator().CreateTable(&executionV1{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&executionV1{})
+		},
+	},
+	{
+		Version: 2,
+		Name:    "move job output out of executions",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().CreateTable(&outputChunkV2{}); err != nil {
+				return err
+			}
+			// the agent imports the output files of earlier jobs into its
+			// output store on startup, see output.ImportLegacy
+			if err := tx.Migrator().CreateTable(&legacyOutputV2{}); err != nil {
+				return err
+			}
+			if err := tx.Exec("INSERT INTO legacy_outputs (execution_id, path) SELECT id, output FROM executions WHERE output <> ''").Error; err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&executionV1{}, "Output")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().AddColumn(&executionV1{}, "Output"); err != nil {
+				return err
+			}
+			// files not imported yet are where they were
+			if err := tx.Exec("UPDATE executions SET output = (SELECT path FROM legacy_outputs WHERE legacy_outputs.execution_id = executions.id) WHERE id IN (SELECT execution_id FROM legacy_outputs)").Error; err != nil {
+				return err
+			}
+			if err := tx.Migrator().DropTable(&legacyOutputV2{}); err != nil {
+				return err
+			}
+			return tx.Migrator().DropTable(&outputChunkV2{})
+		},
+	},
+	{
+		Version: 3,
+		Name:    "record output size of executions",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AddColumn(&executionV3{}, "OutputSize")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&executionV3{}, "OutputSize")
+		},
+	},
+	{
+		Version: 4,
+		Name:    "flag truncated output",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AddColumn(&executionV4{}, "Truncated")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&executionV4{}, "Truncated")
+		},
+	},
+	{
+		Version: 5,
+		Name:    "record output compression",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AddColumn(&executionV5{}, "Compression")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&executionV5{}, "Compression")
+		},
+	},
+	{
+		Version: 6,
+		Name:    "record owner and priority of executions",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().AddColumn(&executionV6{}, "Owner"); err != nil {
+				return err
+			}
+			return tx.Migrator().AddColumn(&executionV6{}, "Priority")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropColumn(&executionV6{}, "Priority"); err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&executionV6{}, "Owner")
+		},
+	},
+	{
+		Version: 7,
+		Name:    "add schedules",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().CreateTable(&scheduleV7{}); err != nil {
+				return err
+			}
+			return tx.Migrator().AddColumn(&executionV7{}, "ScheduleID")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropColumn(&executionV7{}, "ScheduleID"); err != nil {
+				return err
+			}
+			return tx.Migrator().DropTable(&scheduleV7{})
+		},
+	},
+	{
+		Version: 8,
+		Name:    "add workflows",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().CreateTable(&workflowV8{}); err != nil {
+				return err
+			}
+			for _, column := range []string{"WorkflowID", "Step"} {
+				if err := tx.Migrator().AddColumn(&executionV8{}, column); err != nil {
+					return err
+				}
+			}
+			return tx.Migrator().CreateIndex(&executionV8{}, "WorkflowID")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropIndex(&executionV8{}, "WorkflowID"); err != nil {
+				return err
+			}
+			for _, column := range []string{"Step", "WorkflowID"} {
+				if err := tx.Migrator().DropColumn(&executionV8{}, column); err != nil {
+					return err
+				}
+			}
+			return tx.Migrator().DropTable(&workflowV8{})
+		},
+	},
+	{
+		Version: 9,
+		Name:    "add job attempts",
+		Up: func(tx *gorm.DB) error {
+			for _, column := range []string{"Attempt", "RetryOf"} {
+				if err := tx.Migrator().AddColumn(&executionV9{}, column); err != nil {
+					return err
+				}
+			}
+			return tx.Migrator().CreateIndex(&executionV9{}, "RetryOf")
+		},
+		Down: func(tx *gorm.DB) error {
+			// sqlite loses indexes when a later down step rebuilds the table
+			if tx.Migrator().HasIndex(&executionV9{}, "RetryOf") {
+				if err := tx.Migrator().DropIndex(&executionV9{}, "RetryOf"); err != nil {
+					return err
+				}
+			}
+			for _, column := range []string{"RetryOf", "Attempt"} {
+				if err := tx.Migrator().DropColumn(&executionV9{}, column); err != nil {
+					return err
+				}
+			}
+			// sqlite rebuilds the table to drop the columns, losing the index
+			// version 8 drops on its way down
+			if !tx.Migrator().HasIndex(&executionV8{}, "WorkflowID") {
+				return tx.Migrator().CreateIndex(&executionV8{}, "WorkflowID")
+			}
+			return nil
+		},
+	},
+	{
+		Version: 10,
+		Name:    "add idempotency keys",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().AddColumn(&executionV10{}, "IdempotencyKey"); err != nil {
+				return err
+			}
+			return tx.Migrator().CreateIndex(&executionV10{}, "IdempotencyKey")
+		},
+		Down: func(tx *gorm.DB) error {
+			if tx.Migrator().HasIndex(&executionV10{}, "IdempotencyKey") {
+				if err := tx.Migrator().DropIndex(&executionV10{}, "IdempotencyKey"); err != nil {
+					return err
+				}
+			}
+			if err := tx.Migrator().DropColumn(&executionV10{}, "IdempotencyKey"); err != nil {
+				return err
+			}
+			// sqlite rebuilds the table to drop the column, losing its indexes
+			for _, index := range []struct {
+				model any
+				field string
+			}{{&executionV8{}, "WorkflowID"}, {&executionV9{}, "RetryOf"}} {
+				if !tx.Migrator().HasIndex(index.model, index.field) {
+					if err := tx.Migrator().CreateIndex(index.model, index.field); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 11,
+		Name:    "add job errors",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AddColumn(&executionV11{}, "Error")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropColumn(&executionV11{}, "Error"); err != nil {
+				return err
+			}
+			// sqlite rebuilds the table to drop the column, losing its indexes
+			for _, index := range []struct {
+				model any
+				field string
+			}{{&executionV8{}, "WorkflowID"}, {&executionV9{}, "RetryOf"}, {&executionV10{}, "IdempotencyKey"}} {
+				if !tx.Migrator().HasIndex(index.model, index.field) {
+					if err := tx.Migrator().CreateIndex(index.model, index.field); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	},
+}
+
+type executionV1 struct {
+	ID        string `gorm:"primaryKey"`
+	Status    int32
+	Command   string
+	CreatedAt int64 `gorm:"autoCreateTime"`
+	UpdatedAt int64 `gorm:"autoUpdateTime"`
+	Output    string
+	ExitCode  int32
+	Args      datatypes.JSON `gorm:"type:json"`
+}
+
+func (executionV1) TableName() string { return "executions" }
+
+// executionV3 only declares the columns added in version 3
+type executionV3 struct {
+	OutputSize int64
+}
+
+func (executionV3) TableName() string { return "executions" }
+
+// executionV4 only declares the columns added in version 4
+type executionV4 struct {
+	Truncated bool
+}
+
+func (executionV4) TableName() string { return "executions" }
+
+// executionV5 only declares the columns added in version 5
+type executionV5 struct {
+	Compression string
+}
+
+func (executionV5) TableName() string { return "executions" }
+
+// executionV6 only declares the columns added in version 6
+type executionV6 struct {
+	Owner    string
+	Priority int32
+}
+
+func (executionV6) TableName() string { return "executions" }
+
+// executionV7 only declares the columns added in version 7
+type executionV7 struct {
+	ScheduleID string
+}
+
+func (executionV7) TableName() string { return "executions" }
+
+type scheduleV7 struct {
+	ID              string `gorm:"primaryKey"`
+	Cron            string
+	RunAt           int64
+	Request         datatypes.JSON `gorm:"type:json"`
+	CreatedAt       int64          `gorm:"autoCreateTime"`
+	UpdatedAt       int64          `gorm:"autoUpdateTime"`
+	LastRunAt       int64
+	LastExecutionID string
+	Finished        bool
+}
+
+func (scheduleV7) TableName() string { return "schedules" }
+
+// executionV8 only declares the columns added in version 8
+type executionV8 struct {
+	WorkflowID string `gorm:"index"`
+	Step       string
+}
+
+func (executionV8) TableName() string { return "executions" }
+
+// executionV9 only declares the columns added in version 9
+type executionV9 struct {
+	Attempt int32
+	RetryOf string `gorm:"index"`
+}
+
+func (executionV9) TableName() string { return "executions" }
+
+// executionV10 only declares the columns added in version 10
+type executionV10 struct {
+	IdempotencyKey string `gorm:"index"`
+}
+
+func (executionV10) TableName() string { return "executions" }
+
+type executionV11 struct {
+	Error string
+}
+
+func (executionV11) TableName() string { return "executions" }
+
+type workflowV8 struct {
+	ID        string `gorm:"primaryKey"`
+	Name      string
+	Status    int32
+	Request   datatypes.JSON `gorm:"type:json"`
+	CreatedAt int64          `gorm:"autoCreateTime"`
+	UpdatedAt int64          `gorm:"autoUpdateTime"`
+}
+
+func (workflowV8) TableName() string { return "workflows" }
+
+type outputChunkV2 struct {
+	ExecutionID string `gorm:"primaryKey"`
+	Start       int64  `gorm:"primaryKey;autoIncrement:false"`
+	Size        int
+	Data        []byte
+}
+
+func (outputChunkV2) TableName() string { return "output_chunks" }
+
+type legacyOutputV2 struct {
+	ExecutionID string `gorm:"primaryKey"`
+	Path        string
+}
+
+func (legacyOutputV2) TableName() string { return "legacy_outputs" }
+
+// Migrations returns the schema steps known to this agent.
+func Migrations() []Migration {
+	return migrations
+}
+
+// LatestSchemaVersion is the version the database is at after Migrate.
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// schemaVersion records every applied migration, the current version of the
+// database is the highest one.
+type schemaVersion struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt int64 `gorm:"autoCreateTime"`
+}
+
+func (schemaVersion) TableName() string { return "schema_version" }
+
+func checkTarget(current, target int) error {
+	latest := LatestSchemaVersion()
+	if current > latest {
+		return fmt.Errorf("%w: database is at version %d, latest known version is %d", ErrSchemaTooNew, current, latest)
+	}
+	if target < 0 || target > latest {
+		return fmt.Errorf("unknown schema version %d, must be between 0 and %d", target, latest)
+	}
+	return nil
+}
+
+func (g gormDB) SchemaVersion() (int, error) {
+	if !g.db.Migrator().HasTable(&schemaVersion{}) {
+		if err := g.db.Migrator().CreateTable(&schemaVersion{}); err != nil {
+			return 0, fmt.Errorf("error creating schema_version table: %v", err)
+		}
+	}
+	var version int
+	tx := g.db.Model(&schemaVersion{}).Select("COALESCE(MAX(version), 0)").Scan(&version)
+	if tx.Error != nil {
+		return 0, fmt.Errorf("error reading schema version: %v", tx.Error)
+	}
+	return version, nil
+}
+
+func (g gormDB) Migrate() error {
+	return g.MigrateTo(LatestSchemaVersion())
+}
+
+func (g gormDB) MigrateTo(target int) error {
+	current, err := g.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if err := checkTarget(current, target); err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.Version <= current || m.Version > target {
+			continue
+		}
+		err := g.db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&schemaVersion{Version: m.Version, Name: m.Name}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("error applying migration %d (%s): %v", m.Version, m.Name, err)
+		}
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.Version > current || m.Version <= target {
+			continue
+		}
+		err := g.db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&schemaVersion{}, m.Version).Error
+		})
+		if err != nil {
+			return fmt.Errorf("error reverting migration %d (%s): %v", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
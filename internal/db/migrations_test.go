@@ -0,0 +1,62 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stewyb314/remote-control/internal/config"
+)
+
+// TestMigrateLegacyOutput checks that migration 2 keeps the output files of
+// jobs from before output stores for the agent to import, and that reverting
+// it puts them back.
+func TestMigrateLegacyOutput(t *testing.T) {
+	d, err := NewSQLite(config.DbConfig{Path: filepath.Join(t.TempDir(), "executions.db")})
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	if err := d.MigrateTo(1); err != nil {
+		t.Fatalf("MigrateTo(1) = %v", err)
+	}
+	for _, exec := range []executionV1{
+		{ID: "with-output", Command: "echo", Output: "jobs/with-output.txt"},
+		{ID: "without-output", Command: "echo"},
+	} {
+		if err := d.db.Create(&exec).Error; err != nil {
+			t.Fatalf("failed to insert version 1 execution: %v", err)
+		}
+	}
+
+	if err := d.Migrate(); err != nil {
+		t.Fatalf("Migrate() = %v", err)
+	}
+	legacy, err := d.ListLegacyOutputs()
+	if err != nil {
+		t.Fatalf("ListLegacyOutputs() = %v", err)
+	}
+	want := LegacyOutput{ExecutionID: "with-output", Path: "jobs/with-output.txt"}
+	if len(legacy) != 1 || legacy[0] != want {
+		t.Fatalf("ListLegacyOutputs() = %+v, want [%+v]", legacy, want)
+	}
+
+	if err := d.MigrateTo(1); err != nil {
+		t.Fatalf("MigrateTo(1) = %v", err)
+	}
+	var got executionV1
+	if err := d.db.First(&got, "id = ?", "with-output").Error; err != nil {
+		t.Fatalf("failed to read version 1 execution: %v", err)
+	}
+	if got.Output != want.Path {
+		t.Errorf("output after reverting = %q, want %q", got.Output, want.Path)
+	}
+
+	if err := d.Migrate(); err != nil {
+		t.Fatalf("Migrate() = %v", err)
+	}
+	if err := d.DeleteLegacyOutput("with-output"); err != nil {
+		t.Fatalf("DeleteLegacyOutput() = %v", err)
+	}
+	if legacy, err := d.ListLegacyOutputs(); err != nil || len(legacy) != 0 {
+		t.Errorf("ListLegacyOutputs() after delete = %+v, %v, want none", legacy, err)
+	}
+}
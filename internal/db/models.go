@@ -10,8 +10,102 @@ type Execution struct {
 	Command string
 	CreatedAt int64 `gorm:"autoCreateTime"` 
 	UpdatedAt int64 `gorm:"autoUpdateTime"`
-	Output string `gorm:"type:longtext"`
 	ExitCode int32
+	// OutputSize is the number of output bytes stored once the job finished
+	OutputSize int64
+	// Truncated is set when the output exceeded the job's output limit
+	Truncated bool
+	// Compression is the codec the stored output was compressed with once
+	// the job finished, empty when it is stored uncompressed
+	Compression string
+	// Owner is the user the job runs on behalf of
+	Owner string
+	// Priority orders the job in the agent's queue
+	Priority int32
+	// ScheduleID is the schedule that started the job, if any
+	ScheduleID string
+	// WorkflowID and Step name the workflow step the job runs, if any
+	WorkflowID string `gorm:"index"`
+	Step       string
+	// Attempt counts the runs of a retried job, starting at 1. RetryOf is
+	// the ID of the first attempt for all later ones.
+	Attempt int32
+	RetryOf string `gorm:"index"`
+	// IdempotencyKey is the client's key of the request that started the
+	// job, if any
+	IdempotencyKey string `gorm:"index"`
 	Args datatypes.JSON `gorm:"type:json"`
-}	
-	
\ No newline at end of file
+	// Error says why a job in ERROR failed, when the agent knows
+	Error string
+}
+
+// Schedule starts a job on every match of a cron expression, or once at
+// RunAt when Cron is empty.
+type Schedule struct {
+	ID        string `gorm:"primaryKey"`
+	Cron      string
+	RunAt     int64
+	// Request is the StartRequest of the jobs, as protobuf JSON
+	Request   datatypes.JSON `gorm:"type:json"`
+	CreatedAt int64 `gorm:"autoCreateTime"`
+	UpdatedAt int64 `gorm:"autoUpdateTime"`
+	LastRunAt int64
+	// LastExecutionID is the job started by the last run
+	LastExecutionID string
+	// Finished is set once a one-shot schedule ran
+	Finished  bool
+}
+
+// Workflow is the parent record of the jobs started for the steps of a
+// workflow. Status rolls up the state of the steps once they all finished.
+type Workflow struct {
+	ID        string `gorm:"primaryKey"`
+	Name      string
+	Status    int32
+	// Request is the WorkflowRequest, as protobuf JSON
+	Request   datatypes.JSON `gorm:"type:json"`
+	CreatedAt int64 `gorm:"autoCreateTime"`
+	UpdatedAt int64 `gorm:"autoUpdateTime"`
+}
+
+// ExecutionFilter selects executions for ListExecutions. Zero fields
+// match everything.
+type ExecutionFilter struct {
+	// States limits the result to executions in one of these states
+	States []int32
+	// CreatedBefore limits the result to executions created before this
+	// unix time
+	CreatedBefore int64
+	// WorkflowID limits the result to the steps of a workflow
+	WorkflowID string
+	// RetryOf limits the result to the retries of a job
+	RetryOf string
+	// IdempotencyKey limits the result to jobs started with this key
+	IdempotencyKey string
+	// CreatedAfter limits the result to executions created at or after
+	// this unix time
+	CreatedAfter int64
+	// Owner limits the result to the jobs of one owner
+	Owner string
+	// NewestFirst lists the newest executions first instead of the oldest,
+	// so Limit keeps the most recent ones
+	NewestFirst bool
+	// Limit caps the number of executions returned
+	Limit int
+}
+
+// OutputChunk is a piece of a job's output, stored when the agent keeps
+// output in the database. Start is the byte offset of Data in the output.
+type OutputChunk struct {
+	ExecutionID string `gorm:"primaryKey"`
+	Start       int64  `gorm:"primaryKey;autoIncrement:false"`
+	Size        int
+	Data        []byte
+}
+
+// LegacyOutput is the output file of a job that ran before output was kept
+// in an output store, recorded by migration 2 until the agent imported it.
+type LegacyOutput struct {
+	ExecutionID string `gorm:"primaryKey"`
+	Path        string
+}
@@ -10,7 +10,7 @@ import (
 )
 
 type MySQL struct {
-	db *gorm.DB
+	gormDB
 }
 
 func NewMySQL(conf config.DbConfig) (*MySQL, error) {
@@ -24,37 +24,7 @@ func NewMySQL(conf config.DbConfig) (*MySQL, error) {
 	}
 
 	return &MySQL{
-		db: databaseConnection,
+		gormDB: gormDB{db: databaseConnection},
 	}, nil
 
 }
-
-func (m MySQL) GetExecution(id string) (*Execution, error) {
-	var execution Execution
-	tx := m.db.First(&execution, "id = ?", id)
-	return &execution, tx.Error
-}
-func (m MySQL) CreateExecution(execution Execution) error {
-	tx := m.db.Create(&execution)
-	if tx.Error != nil {
-		return fmt.Errorf("error creating execution: %v", tx.Error)
-	}
-
-	return nil
-}	
-
-func (m MySQL) UpdateExecution(exec Execution) error {
-	tx := m.db.Save(&exec)
-	return tx.Error
-}
-
-func (m MySQL) Migrate() error {
-	err := m.db.AutoMigrate(
-		&Execution{},
-	)
-	if err != nil {
-		return fmt.Errorf("error migrating database: %v", err)
-	}
-
-	return nil
-}	
\ No newline at end of file
@@ -0,0 +1,32 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/stewyb314/remote-control/internal/config"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type Postgres struct {
+	gormDB
+}
+
+func NewPostgres(conf config.DbConfig) (*Postgres, error) {
+	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		conf.Host, conf.Port, conf.User, conf.Password, conf.Database, conf.SSLMode)
+	if conf.SSLRootCert != "" {
+		dsn += fmt.Sprintf(" sslrootcert=%s", conf.SSLRootCert)
+	}
+	databaseConnection, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Info),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Postgres{
+		gormDB: gormDB{db: databaseConnection},
+	}, nil
+}
@@ -0,0 +1,38 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stewyb314/remote-control/internal/config"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// SQLite stores executions in a single local database file. It is pure Go,
+// so the agent can be built as a static binary with no database server.
+type SQLite struct {
+	gormDB
+}
+
+func NewSQLite(conf config.DbConfig) (*SQLite, error) {
+	dsn := fmt.Sprintf("%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", conf.Path)
+	databaseConnection, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Warn),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite only allows a single writer; serialise access through one
+	// connection instead of surfacing SQLITE_BUSY to the job monitor.
+	sqlDB, err := databaseConnection.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	return &SQLite{
+		gormDB: gormDB{db: databaseConnection},
+	}, nil
+}
@@ -0,0 +1,161 @@
+package logging
+
+import (
+	"context"
+	"crypto/x509"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// RequestIDHeader is the metadata key of a request's ID. A caller may
+// send its own, e.g. to find the request of a client run in the agent's
+// log, and the agent returns the ID it used in the response header.
+const RequestIDHeader = "x-request-id"
+
+// maxRequestID bounds the length of request IDs sent by callers.
+const maxRequestID = 64
+
+// UnaryServerInterceptor gives every request an entry derived from log
+// with the request's ID, caller and method, passes it on in the context
+// and logs the outcome and latency once the request is handled.
+func UnaryServerInterceptor(log *logrus.Entry) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, reqLog := newRequest(ctx, log, info.FullMethod)
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		finished(reqLog, info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor is UnaryServerInterceptor for streaming
+// requests, the latency is the time until the stream ends.
+func StreamServerInterceptor(log *logrus.Entry) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, reqLog := newRequest(ss.Context(), log, info.FullMethod)
+		start := time.Now()
+		err := handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		finished(reqLog, info.FullMethod, start, err)
+		return err
+	}
+}
+
+// serverStream replaces the context of a stream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// newRequest returns the entry of a request and ctx carrying it.
+func newRequest(ctx context.Context, log *logrus.Entry, method string) (context.Context, *logrus.Entry) {
+	id := requestID(ctx)
+	// the header is sent with the response, failing to set it only
+	// means the caller does not learn the ID
+	_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, id))
+	fields := logrus.Fields{
+		"request_id": id,
+		"method":     method,
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		fields["peer"] = p.Addr.String()
+		if caller := callerName(p.AuthInfo); caller != "" {
+			fields["caller"] = caller
+		}
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		fields["trace_id"] = sc.TraceID().String()
+	}
+	reqLog := log.WithFields(fields)
+	return NewContext(ctx, reqLog), reqLog
+}
+
+// requestID returns the ID the caller sent for the request, or a new one
+// when it sent none or one that is not safe to log.
+func requestID(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(RequestIDHeader); len(ids) > 0 && validRequestID(ids[0]) {
+			return ids[0]
+		}
+	}
+	return uuid.New().String()
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestID {
+		return false
+	}
+	return strings.IndexFunc(id, func(r rune) bool {
+		return r > unicode.MaxASCII || !unicode.IsPrint(r) || unicode.IsSpace(r)
+	}) < 0
+}
+
+// Caller returns the common name of the client certificate the caller of
+// the request ctx belongs to authenticated with, empty without mutual TLS.
+func Caller(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	return callerName(p.AuthInfo)
+}
+
+// callerName returns the common name of the client certificate a caller
+// authenticated with, empty without mutual TLS.
+func callerName(auth credentials.AuthInfo) string {
+	tlsInfo, ok := auth.(credentials.TLSInfo)
+	if !ok {
+		return ""
+	}
+	var cert *x509.Certificate
+	if chains := tlsInfo.State.VerifiedChains; len(chains) > 0 && len(chains[0]) > 0 {
+		cert = chains[0][0]
+	} else if certs := tlsInfo.State.PeerCertificates; len(certs) > 0 {
+		cert = certs[0]
+	}
+	if cert == nil {
+		return ""
+	}
+	return cert.Subject.CommonName
+}
+
+// finished logs the outcome of a request. Failures whose code blames the
+// request, e.g. NotFound, are logged as warnings and others as errors.
+// Health checks, which load balancers make all the time, are only logged
+// at debug level.
+func finished(log *logrus.Entry, method string, start time.Time, err error) {
+	code := status.Code(err)
+	log = log.WithFields(logrus.Fields{
+		"code":       code.String(),
+		"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+	})
+	if err != nil {
+		log = log.WithError(err)
+	}
+	level := logrus.InfoLevel
+	switch code {
+	case codes.OK:
+		if strings.HasPrefix(method, "/grpc.health.v1.Health/") {
+			level = logrus.DebugLevel
+		}
+	case codes.Unknown, codes.Internal, codes.Unavailable, codes.DataLoss, codes.Unimplemented:
+		level = logrus.ErrorLevel
+	default:
+		level = logrus.WarnLevel
+	}
+	log.Log(level, "Finished request")
+}
@@ -0,0 +1,206 @@
+package logging
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestValidRequestID(t *testing.T) {
+	for id, want := range map[string]bool{
+		"build-1234":              true,
+		uuid.New().String():       true,
+		"":                        false,
+		"has space":               false,
+		"new\nline":               false,
+		"tab\there":               false,
+		"café":                    false,
+		strings.Repeat("a", 64):   true,
+		strings.Repeat("a", 65):   false,
+		"\x1b[31mred\x1b[0m":      false,
+		"quotes\"and{braces}=ok!": true,
+	} {
+		if got := validRequestID(id); got != want {
+			t.Errorf("validRequestID(%q) = %v, want %v", id, got, want)
+		}
+	}
+}
+
+// callUnary runs a request through the unary interceptor and returns the
+// entry the handler got and the log of the request.
+func callUnary(t *testing.T, ctx context.Context, method string, err error) (*logrus.Entry, []*logrus.Entry) {
+	t.Helper()
+	logger, hook := logtest.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	var handlerLog *logrus.Entry
+	handler := func(ctx context.Context, req any) (any, error) {
+		handlerLog = FromContext(ctx, nil)
+		return nil, err
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: method}
+	if _, got := UnaryServerInterceptor(logrus.NewEntry(logger))(ctx, nil, info, handler); got != err {
+		t.Errorf("interceptor returned %v, want the handler's %v", got, err)
+	}
+	if handlerLog == nil {
+		t.Fatalf("the handler's context carries no entry")
+	}
+	return handlerLog, hook.AllEntries()
+}
+
+func TestRequestID(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		sent string
+		keep bool
+	}{
+		{name: "sent", sent: "build-1234", keep: true},
+		{name: "not sent"},
+		{name: "unsafe", sent: "two words"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.sent != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(RequestIDHeader, tc.sent))
+			}
+			handlerLog, entries := callUnary(t, ctx, "/cmd.Agent/Status", nil)
+			id, _ := handlerLog.Data["request_id"].(string)
+			if tc.keep && id != tc.sent {
+				t.Errorf("request ID = %q, want the one sent %q", id, tc.sent)
+			}
+			if !tc.keep {
+				if _, err := uuid.Parse(id); err != nil {
+					t.Errorf("request ID = %q, want a new UUID", id)
+				}
+			}
+			if len(entries) != 1 || entries[0].Data["request_id"] != id {
+				t.Errorf("finishing log = %v, want one line with request ID %q", entries, id)
+			}
+			if handlerLog.Data["method"] != "/cmd.Agent/Status" {
+				t.Errorf("method = %v, want /cmd.Agent/Status", handlerLog.Data["method"])
+			}
+		})
+	}
+}
+
+func TestCallerName(t *testing.T) {
+	cert := func(cn string) *x509.Certificate {
+		return &x509.Certificate{Subject: pkix.Name{CommonName: cn}}
+	}
+	for _, tc := range []struct {
+		name string
+		auth credentials.AuthInfo
+		want string
+	}{
+		{name: "no TLS", auth: nil, want: ""},
+		{name: "TLS without client certificate", auth: credentials.TLSInfo{}, want: ""},
+		{name: "peer certificate", auth: credentials.TLSInfo{State: tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{cert("alice"), cert("intermediate")},
+		}}, want: "alice"},
+		{name: "verified chain", auth: credentials.TLSInfo{State: tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{cert("unverified")},
+			VerifiedChains:   [][]*x509.Certificate{{cert("bob"), cert("ca")}},
+		}}, want: "bob"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := callerName(tc.auth); got != tc.want {
+				t.Errorf("callerName() = %q, want %q", got, tc.want)
+			}
+			ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 4000}, AuthInfo: tc.auth})
+			if got := Caller(ctx); got != tc.want {
+				t.Errorf("Caller() = %q, want %q", got, tc.want)
+			}
+			handlerLog, _ := callUnary(t, ctx, "/cmd.Agent/Status", nil)
+			if caller, ok := handlerLog.Data["caller"]; (tc.want != "") != ok || (ok && caller != tc.want) {
+				t.Errorf("caller field = %v, want %q", caller, tc.want)
+			}
+			if handlerLog.Data["peer"] != "10.0.0.1:4000" {
+				t.Errorf("peer field = %v, want 10.0.0.1:4000", handlerLog.Data["peer"])
+			}
+		})
+	}
+	if got := Caller(context.Background()); got != "" {
+		t.Errorf("Caller() without a peer = %q, want none", got)
+	}
+}
+
+func TestFinishedLevel(t *testing.T) {
+	for _, tc := range []struct {
+		method string
+		err    error
+		want   logrus.Level
+	}{
+		{"/cmd.Agent/Status", nil, logrus.InfoLevel},
+		{"/grpc.health.v1.Health/Check", nil, logrus.DebugLevel},
+		{"/grpc.health.v1.Health/Check", status.Error(codes.Unavailable, "draining"), logrus.ErrorLevel},
+		{"/cmd.Agent/Status", status.Error(codes.NotFound, "no such job"), logrus.WarnLevel},
+		{"/cmd.Agent/Start", status.Error(codes.InvalidArgument, "bad"), logrus.WarnLevel},
+		{"/cmd.Agent/Start", status.Error(codes.PermissionDenied, "policy"), logrus.WarnLevel},
+		{"/cmd.Agent/Output", status.Error(codes.DeadlineExceeded, "timeout"), logrus.WarnLevel},
+		{"/cmd.Agent/Start", status.Error(codes.Internal, "db"), logrus.ErrorLevel},
+		{"/cmd.Agent/Start", status.Error(codes.Unimplemented, "old agent"), logrus.ErrorLevel},
+		// plain errors of the handlers are Unknown
+		{"/cmd.Agent/Start", errors.New("failed"), logrus.ErrorLevel},
+	} {
+		_, entries := callUnary(t, context.Background(), tc.method, tc.err)
+		if len(entries) != 1 {
+			t.Fatalf("%s with %v logged %d lines, want 1", tc.method, tc.err, len(entries))
+		}
+		e := entries[0]
+		if e.Level != tc.want || e.Message != "Finished request" {
+			t.Errorf("%s with %v logged %q at %s, want Finished request at %s", tc.method, tc.err, e.Message, e.Level, tc.want)
+		}
+		if code := status.Code(tc.err).String(); e.Data["code"] != code {
+			t.Errorf("code field = %v, want %s", e.Data["code"], code)
+		}
+		if _, ok := e.Data["latency_ms"].(float64); !ok {
+			t.Errorf("latency_ms field = %v, want a number", e.Data["latency_ms"])
+		}
+		if (tc.err != nil) != (e.Data[logrus.ErrorKey] != nil) {
+			t.Errorf("error field = %v with error %v", e.Data[logrus.ErrorKey], tc.err)
+		}
+	}
+}
+
+// fakeStream is a server stream with only a context.
+type fakeStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s fakeStream) Context() context.Context { return s.ctx }
+
+func TestStreamServerInterceptor(t *testing.T) {
+	logger, hook := logtest.NewNullLogger()
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(RequestIDHeader, "stream-1"))
+	var id any
+	handler := func(srv any, ss grpc.ServerStream) error {
+		id = FromContext(ss.Context(), nil).Data["request_id"]
+		return status.Error(codes.NotFound, "no such job")
+	}
+	info := &grpc.StreamServerInfo{FullMethod: "/cmd.Agent/Output"}
+	if err := StreamServerInterceptor(logrus.NewEntry(logger))(nil, fakeStream{ctx: ctx}, info, handler); status.Code(err) != codes.NotFound {
+		t.Errorf("interceptor returned %v, want the handler's error", err)
+	}
+	if id != "stream-1" {
+		t.Errorf("request ID in the stream's context = %v, want stream-1", id)
+	}
+	e := hook.LastEntry()
+	if e == nil || e.Level != logrus.WarnLevel || e.Data["request_id"] != "stream-1" {
+		t.Errorf("finishing log = %v, want a warning with request ID stream-1", e)
+	}
+}
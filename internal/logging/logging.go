@@ -0,0 +1,40 @@
+// Package logging carries the agent's logrus entry through contexts, so
+// every entry logged while handling a request has the fields identifying
+// it.
+package logging
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stewyb314/remote-control/internal/config"
+)
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying log.
+func NewContext(ctx context.Context, log *logrus.Entry) context.Context {
+	return context.WithValue(ctx, contextKey{}, log)
+}
+
+// FromContext returns the entry ctx carries, fallback when it has none.
+func FromContext(ctx context.Context, fallback *logrus.Entry) *logrus.Entry {
+	if log, ok := ctx.Value(contextKey{}).(*logrus.Entry); ok {
+		return log
+	}
+	return fallback
+}
+
+// Configure sets the level and the format of the logger of log. Both were
+// validated with the configuration.
+func Configure(log *logrus.Entry, conf config.LogConfig) {
+	if level, err := logrus.ParseLevel(conf.Level); err == nil {
+		log.Logger.SetLevel(level)
+	}
+	switch conf.Format {
+	case config.LogFormatText:
+		log.Logger.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	default:
+		log.Logger.SetFormatter(&logrus.JSONFormatter{})
+	}
+}
@@ -0,0 +1,128 @@
+// Package metrics defines the Prometheus metrics of the agent and serves
+// them over HTTP.
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	grpcprom "github.com/grpc-ecosystem/go-grpc-middleware/providers/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+)
+
+const namespace = "trc"
+
+// Job states used as the state label of JobsFinished and JobDuration.
+const (
+	StateCompleted = "completed"
+	StateFailed    = "failed"
+	StateStopped   = "stopped"
+)
+
+// Registry holds every metric of the agent. The metrics are always
+// collected, Serve only exposes them.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	JobsStarted = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_started_total",
+		Help:      "Jobs whose process was started, every attempt of a retried job counts.",
+	})
+	JobsFinished = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_finished_total",
+		Help:      "Jobs that finished by final state: completed with exit code 0, failed with another exit code or to start, or stopped.",
+	}, []string{"state"})
+	JobDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_duration_seconds",
+		Help:      "Time from starting a job's process until it exited, by final state.",
+		// from a tenth of a second to about a day
+		Buckets: prometheus.ExponentialBuckets(0.1, 4, 10),
+	}, []string{"state"})
+	OutputBytes = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "job_output_bytes_total",
+		Help:      "Output bytes written by jobs, before output limits and compression.",
+	})
+	DBDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_operation_duration_seconds",
+		Help:      "Latency of database operations by operation.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 4, 9),
+	}, []string{"operation"})
+	DBErrors = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_errors_total",
+		Help:      "Failed database operations by operation.",
+	}, []string{"operation"})
+
+	// GRPC counts and times the RPCs the agent serves by method and code.
+	GRPC = grpcprom.NewServerMetrics(grpcprom.WithServerHandlingTimeHistogram())
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		GRPC,
+	)
+}
+
+// RegisterJobs exports the number of running and queued jobs as reported
+// by the functions, which are called on every scrape.
+func RegisterJobs(running, queued func() int) {
+	factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "jobs_running",
+		Help:      "Jobs whose process is running.",
+	}, func() float64 { return float64(running()) })
+	factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "jobs_queued",
+		Help:      "Jobs waiting for a free slot under the concurrency limits.",
+	}, func() float64 { return float64(queued()) })
+}
+
+// ObserveDB records the latency of a database operation that started at
+// start and counts it when it failed.
+func ObserveDB(operation string, start time.Time, err error) {
+	DBDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		DBErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+// Handler serves the metrics at /metrics.
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry}))
+	return mux
+}
+
+// Serve serves the metrics at /metrics on addr until the process exits.
+// It fails right away when addr can not be listened on.
+func Serve(addr string, log *logrus.Entry) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %v", err)
+	}
+	server := &http.Server{Handler: Handler(), ReadHeaderTimeout: 10 * time.Second}
+	log.Infof("Serving metrics at http://%v/metrics", lis.Addr())
+	go func() {
+		if err := server.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("Failed to serve metrics: %v", err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,150 @@
+package output
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// chunkSize is the largest piece of output stored at once
+	chunkSize = 64 * 1024
+	// flushInterval bounds how long output of a quiet job stays buffered
+	// before readers can see it
+	flushInterval = time.Second
+	// chunksPerFetch is how many chunks a reader loads at a time
+	chunksPerFetch = 16
+)
+
+type chunk struct {
+	start int64
+	data  []byte
+}
+
+// chunkBackend is implemented by stores that can not append to an object
+// and instead keep output as a sequence of chunks, each no larger than
+// chunkSize.
+type chunkBackend interface {
+	putChunk(id string, start int64, data []byte) error
+	// getChunks returns up to limit chunks that end after offset, in order
+	getChunks(id string, offset int64, limit int) ([]chunk, error)
+}
+
+// chunkWriter buffers output and stores it as chunks when chunkSize bytes
+// are buffered, when flushInterval has passed and on Close.
+type chunkWriter struct {
+	mu      sync.Mutex
+	backend chunkBackend
+	id      string
+	buf     []byte
+	written int64
+	err     error
+	done    chan struct{}
+}
+
+func newChunkWriter(backend chunkBackend, id string) *chunkWriter {
+	w := &chunkWriter{
+		backend: backend,
+		id:      id,
+		done:    make(chan struct{}),
+	}
+	go w.flushPeriodically()
+	return w
+}
+
+func (w *chunkWriter) flushPeriodically() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			w.mu.Lock()
+			w.flush(len(w.buf))
+			w.mu.Unlock()
+		}
+	}
+}
+
+// flush stores the first n buffered bytes, w.mu must be held.
+func (w *chunkWriter) flush(n int) {
+	if n == 0 || w.err != nil {
+		return
+	}
+	data := make([]byte, n)
+	copy(data, w.buf)
+	if err := w.backend.putChunk(w.id, w.written, data); err != nil {
+		w.err = err
+		return
+	}
+	w.written += int64(n)
+	w.buf = append(w.buf[:0], w.buf[n:]...)
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return 0, w.err
+	}
+	w.buf = append(w.buf, p...)
+	for len(w.buf) >= chunkSize && w.err == nil {
+		w.flush(chunkSize)
+	}
+	return len(p), w.err
+}
+
+func (w *chunkWriter) Close() error {
+	close(w.done)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.flush(len(w.buf))
+	return w.err
+}
+
+// chunkReader reads chunks in order, starting at offset.
+type chunkReader struct {
+	backend chunkBackend
+	id      string
+	offset  int64
+	buf     []byte
+	pending []chunk
+}
+
+func newChunkReader(backend chunkBackend, id string, offset int64) *chunkReader {
+	return &chunkReader{
+		backend: backend,
+		id:      id,
+		offset:  offset,
+	}
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if len(r.pending) == 0 {
+			chunks, err := r.backend.getChunks(r.id, r.offset, chunksPerFetch)
+			if err != nil {
+				return 0, err
+			}
+			if len(chunks) == 0 {
+				return 0, io.EOF
+			}
+			r.pending = chunks
+		}
+		c := r.pending[0]
+		r.pending = r.pending[1:]
+		skip := max(r.offset-c.start, 0)
+		if skip < int64(len(c.data)) {
+			r.buf = c.data[skip:]
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	r.offset += int64(n)
+	return n, nil
+}
+
+func (r *chunkReader) Close() error {
+	return nil
+}
@@ -0,0 +1,149 @@
+package output
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stewyb314/remote-control/internal/config"
+)
+
+// compressedKey is the key the compressed copy of a job's output is stored
+// under, next to the uncompressed output.
+func compressedKey(id, codec string) (string, error) {
+	switch codec {
+	case config.CompressionZstd:
+		return id + ".zst", nil
+	case config.CompressionGzip:
+		return id + ".gz", nil
+	default:
+		return "", fmt.Errorf("unknown compression %q", codec)
+	}
+}
+
+// Compress stores a compressed copy of a finished job's output and returns
+// its size. The uncompressed output is left in place, the caller deletes it
+// once readers have been told to use the compressed copy.
+func Compress(store Store, id, codec string) (int64, error) {
+	r, err := store.Open(id, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	return CompressFrom(store, id, codec, r)
+}
+
+// CompressFrom is Compress for output read from r instead of the stored
+// output, e.g. when only part of it is kept.
+func CompressFrom(store Store, id, codec string, r io.Reader) (int64, error) {
+	key, err := compressedKey(id, codec)
+	if err != nil {
+		return 0, err
+	}
+	w, err := store.Create(key)
+	if err != nil {
+		return 0, err
+	}
+	counter := &countWriter{w: w}
+
+	var enc io.WriteCloser
+	if codec == config.CompressionZstd {
+		enc, err = zstd.NewWriter(counter)
+		if err != nil {
+			w.Close()
+			return 0, err
+		}
+	} else {
+		enc = gzip.NewWriter(counter)
+	}
+	if _, err := io.Copy(enc, r); err != nil {
+		enc.Close()
+		w.Close()
+		return 0, fmt.Errorf("failed to compress output of job %s: %v", id, err)
+	}
+	if err := enc.Close(); err != nil {
+		w.Close()
+		return 0, fmt.Errorf("failed to compress output of job %s: %v", id, err)
+	}
+	if err := w.Close(); err != nil {
+		return 0, fmt.Errorf("failed to store compressed output of job %s: %v", id, err)
+	}
+	return counter.n, nil
+}
+
+// OpenOutput returns the uncompressed output of a job starting at offset.
+// codec is the compression recorded for the job, empty for output that was
+// never compressed.
+func OpenOutput(store Store, id, codec string, offset int64) (io.ReadCloser, error) {
+	if codec == "" {
+		return store.Open(id, offset)
+	}
+	key, err := compressedKey(id, codec)
+	if err != nil {
+		return nil, err
+	}
+	r, err := store.Open(key, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var dec io.ReadCloser
+	if codec == config.CompressionZstd {
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		dec = d.IOReadCloser()
+	} else {
+		dec, err = gzip.NewReader(r)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+	}
+	// offsets are positions in the uncompressed output
+	if _, err := io.CopyN(io.Discard, dec, offset); err != nil && err != io.EOF {
+		dec.Close()
+		r.Close()
+		return nil, fmt.Errorf("failed to seek output of job %s: %v", id, err)
+	}
+	return &decompressReader{ReadCloser: dec, raw: r}, nil
+}
+
+// Delete removes the output of a job and any compressed copy of it.
+func Delete(store Store, id string) error {
+	if err := store.Delete(id); err != nil {
+		return err
+	}
+	for _, codec := range []string{config.CompressionZstd, config.CompressionGzip} {
+		key, _ := compressedKey(id, codec)
+		if err := store.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// decompressReader closes both the decoder and the stored object.
+type decompressReader struct {
+	io.ReadCloser
+	raw io.Closer
+}
+
+func (d *decompressReader) Close() error {
+	d.ReadCloser.Close()
+	return d.raw.Close()
+}
@@ -0,0 +1,55 @@
+package output
+
+import (
+	"context"
+	"io"
+
+	"github.com/stewyb314/remote-control/internal/db"
+)
+
+// Database keeps job output as chunks in the agent's database, so it lives
+// and is backed up together with the execution history.
+type Database struct {
+	db db.DB
+}
+
+func NewDatabase(database db.DB) *Database {
+	return &Database{db: database}
+}
+
+func (d *Database) Create(id string) (io.WriteCloser, error) {
+	return newChunkWriter(d, id), nil
+}
+
+func (d *Database) Open(id string, offset int64) (io.ReadCloser, error) {
+	return newChunkReader(d, id, offset), nil
+}
+
+func (d *Database) Delete(id string) error {
+	return d.db.DeleteOutputChunks(id)
+}
+
+func (d *Database) Check(ctx context.Context) error {
+	return d.db.Ping(ctx)
+}
+
+func (d *Database) putChunk(id string, start int64, data []byte) error {
+	return d.db.CreateOutputChunk(db.OutputChunk{
+		ExecutionID: id,
+		Start:       start,
+		Size:        len(data),
+		Data:        data,
+	})
+}
+
+func (d *Database) getChunks(id string, offset int64, limit int) ([]chunk, error) {
+	stored, err := d.db.GetOutputChunks(id, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	chunks := make([]chunk, len(stored))
+	for i, c := range stored {
+		chunks[i] = chunk{start: c.Start, data: c.Data}
+	}
+	return chunks, nil
+}
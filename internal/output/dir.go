@@ -0,0 +1,83 @@
+package output
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Dir keeps the output of every job in a <id>.txt file in a local directory.
+// Keys that already have an extension, like compressed output, are used as
+// the file name as they are.
+type Dir struct {
+	path string
+}
+
+func NewDir(path string) (*Dir, error) {
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory %s: %v", path, err)
+	}
+	return &Dir{path: path}, nil
+}
+
+func (d *Dir) file(id string) (string, error) {
+	if id == "" || filepath.Base(id) != id {
+		return "", fmt.Errorf("invalid job ID %q", id)
+	}
+	if filepath.Ext(id) == "" {
+		id += ".txt"
+	}
+	return filepath.Join(d.path, id), nil
+}
+
+func (d *Dir) Create(id string) (io.WriteCloser, error) {
+	file, err := d.file(id)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file %s: %v", file, err)
+	}
+	return f, nil
+}
+
+func (d *Dir) Open(id string, offset int64) (io.ReadCloser, error) {
+	file, err := d.file(id)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %v", file, err)
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to seek file %s: %v", file, err)
+	}
+	return f, nil
+}
+
+// Check writes and removes a file to make sure the directory is writable.
+func (d *Dir) Check(ctx context.Context) error {
+	f, err := os.CreateTemp(d.path, ".check-*")
+	if err != nil {
+		return fmt.Errorf("output directory %s is not writable: %v", d.path, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+func (d *Dir) Delete(id string) error {
+	file, err := d.file(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove file %s: %v", file, err)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package output
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/stewyb314/remote-control/internal/db"
+)
+
+// ImportLegacy moves the output files of jobs that ran before output stores
+// into store and returns how many it imported. A file already where a Dir
+// store keeps the job's output stays in place, and a file that no longer
+// exists is skipped.
+func ImportLegacy(database db.DB, store Store) (int, error) {
+	legacy, err := database.ListLegacyOutputs()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list legacy output: %v", err)
+	}
+	imported := 0
+	for _, l := range legacy {
+		size, err := importLegacy(store, l)
+		if errors.Is(err, fs.ErrNotExist) {
+			if err := database.DeleteLegacyOutput(l.ExecutionID); err != nil {
+				return imported, err
+			}
+			continue
+		}
+		if err != nil {
+			return imported, fmt.Errorf("failed to import output of job %s: %v", l.ExecutionID, err)
+		}
+		exec, err := database.GetExecution(l.ExecutionID)
+		if err == nil && exec != nil {
+			exec.OutputSize = size
+			if err := database.UpdateExecution(*exec); err != nil {
+				return imported, err
+			}
+		}
+		if err := database.DeleteLegacyOutput(l.ExecutionID); err != nil {
+			return imported, err
+		}
+		imported++
+	}
+	return imported, nil
+}
+
+func importLegacy(store Store, l db.LegacyOutput) (int64, error) {
+	src, err := os.Open(l.Path)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if d, ok := store.(*Dir); ok {
+		if file, err := d.file(l.ExecutionID); err == nil {
+			if target, err := os.Stat(file); err == nil && os.SameFile(info, target) {
+				return info.Size(), nil
+			}
+		}
+	}
+
+	w, err := store.Create(l.ExecutionID)
+	if err != nil {
+		return 0, err
+	}
+	size, err := io.Copy(w, src)
+	if err != nil {
+		w.Close()
+		store.Delete(l.ExecutionID)
+		return 0, err
+	}
+	if err := w.Close(); err != nil {
+		return 0, err
+	}
+	src.Close()
+	if err := os.Remove(l.Path); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
@@ -0,0 +1,40 @@
+package output
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/stewyb314/remote-control/internal/config"
+	"github.com/stewyb314/remote-control/internal/db"
+)
+
+// Store keeps the combined stdout and stderr of jobs, keyed by job ID.
+type Store interface {
+	// Create returns a writer for the output of a new job. Output written to
+	// it becomes readable while the job runs, not only after Close.
+	Create(id string) (io.WriteCloser, error)
+	// Open returns a reader over the output of a job starting at offset.
+	// Reading a running job returns io.EOF at the end of the output written
+	// so far, open it again at the new offset to follow it.
+	Open(id string, offset int64) (io.ReadCloser, error)
+	// Delete removes the output of a job
+	Delete(id string) error
+	// Check reports whether output can be stored, e.g. for health checks
+	Check(ctx context.Context) error
+}
+
+// New returns the store selected by conf.Store. database is only used by
+// the db store.
+func New(conf config.OutputConfig, database db.DB) (Store, error) {
+	switch conf.Store {
+	case config.OutputStoreDir:
+		return NewDir(conf.Dir)
+	case config.OutputStoreDB:
+		return NewDatabase(database), nil
+	case config.OutputStoreS3:
+		return NewS3(conf.S3)
+	default:
+		return nil, fmt.Errorf("unknown output store %q", conf.Store)
+	}
+}
@@ -0,0 +1,236 @@
+package output
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stewyb314/remote-control/internal/config"
+	"github.com/stewyb314/remote-control/internal/db"
+)
+
+func newTestDir(t *testing.T) *Dir {
+	t.Helper()
+	dir, err := NewDir(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDir() = %v", err)
+	}
+	return dir
+}
+
+func readAll(t *testing.T, store Store, id string, offset int64) string {
+	t.Helper()
+	r, err := store.Open(id, offset)
+	if err != nil {
+		t.Fatalf("Open(%s, %d) = %v", id, offset, err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll() = %v", err)
+	}
+	return string(data)
+}
+
+func TestDir(t *testing.T) {
+	store := newTestDir(t)
+	w, err := store.Create("job-1")
+	if err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	if _, err := io.WriteString(w, "hello\n"); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	// output is readable while the job still writes
+	if got := readAll(t, store, "job-1", 0); got != "hello\n" {
+		t.Errorf("output of a running job = %q, want %q", got, "hello\n")
+	}
+	if _, err := io.WriteString(w, "world\n"); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	if got := readAll(t, store, "job-1", 0); got != "hello\nworld\n" {
+		t.Errorf("output = %q, want %q", got, "hello\nworld\n")
+	}
+	// following a job reopens it at the offset read so far
+	if got := readAll(t, store, "job-1", 6); got != "world\n" {
+		t.Errorf("output at offset 6 = %q, want %q", got, "world\n")
+	}
+
+	if err := store.Delete("job-1"); err != nil {
+		t.Fatalf("Delete() = %v", err)
+	}
+	if r, err := store.Open("job-1", 0); err == nil {
+		r.Close()
+		t.Errorf("Open() of deleted output succeeded")
+	}
+	if err := store.Delete("job-1"); err != nil {
+		t.Errorf("Delete() of missing output = %v", err)
+	}
+}
+
+func TestDirInvalidID(t *testing.T) {
+	dir := newTestDir(t)
+	for _, id := range []string{"", "../job", "sub/job"} {
+		if w, err := dir.Create(id); err == nil {
+			w.Close()
+			t.Errorf("Create(%q) succeeded, want the ID to be refused", id)
+		}
+		if r, err := dir.Open(id, 0); err == nil {
+			r.Close()
+			t.Errorf("Open(%q) succeeded, want the ID to be refused", id)
+		}
+		if err := dir.Delete(id); err == nil {
+			t.Errorf("Delete(%q) succeeded, want the ID to be refused", id)
+		}
+	}
+}
+
+// writeOutput stores data as the finished output of job id.
+func writeOutput(t *testing.T, store Store, id, data string) {
+	t.Helper()
+	w, err := store.Create(id)
+	if err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	if _, err := io.WriteString(w, data); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+}
+
+func openOutput(t *testing.T, store Store, id, codec string, offset int64) string {
+	t.Helper()
+	r, err := OpenOutput(store, id, codec, offset)
+	if err != nil {
+		t.Fatalf("OpenOutput(%s, %q, %d) = %v", id, codec, offset, err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll() = %v", err)
+	}
+	return string(data)
+}
+
+func TestCompress(t *testing.T) {
+	data := strings.Repeat("line of output\n", 1000)
+	for _, codec := range []string{config.CompressionZstd, config.CompressionGzip} {
+		t.Run(codec, func(t *testing.T) {
+			store := newTestDir(t)
+			writeOutput(t, store, "job-1", data)
+			size, err := Compress(store, "job-1", codec)
+			if err != nil {
+				t.Fatalf("Compress() = %v", err)
+			}
+			key, _ := compressedKey("job-1", codec)
+			if stored := int64(len(readAll(t, store, key, 0))); size != stored || size >= int64(len(data)) {
+				t.Errorf("Compress() = %d, want the %d compressed bytes stored, fewer than %d", size, stored, len(data))
+			}
+			// the caller deletes the uncompressed output once readers use the copy
+			if err := store.Delete("job-1"); err != nil {
+				t.Fatalf("Delete() = %v", err)
+			}
+			if got := openOutput(t, store, "job-1", codec, 0); got != data {
+				t.Errorf("OpenOutput() returned %d bytes, want the %d bytes compressed", len(got), len(data))
+			}
+			// offsets are positions in the uncompressed output
+			if got := openOutput(t, store, "job-1", codec, 15); got != data[15:] {
+				t.Errorf("OpenOutput() at offset 15 returned %d bytes, want %d", len(got), len(data)-15)
+			}
+			if got := openOutput(t, store, "job-1", codec, int64(len(data))); got != "" {
+				t.Errorf("OpenOutput() at the end = %q, want nothing", got)
+			}
+
+			if err := Delete(store, "job-1"); err != nil {
+				t.Fatalf("Delete() = %v", err)
+			}
+			if r, err := OpenOutput(store, "job-1", codec, 0); err == nil {
+				r.Close()
+				t.Errorf("OpenOutput() after Delete() succeeded")
+			}
+		})
+	}
+}
+
+// TestOpenOutputUncompressed reads output stored before compression was
+// introduced, or with it disabled, which has no codec recorded.
+func TestOpenOutputUncompressed(t *testing.T) {
+	store := newTestDir(t)
+	writeOutput(t, store, "job-1", "hello\nworld\n")
+	if got := openOutput(t, store, "job-1", "", 0); got != "hello\nworld\n" {
+		t.Errorf("OpenOutput() = %q, want the stored output", got)
+	}
+	if got := openOutput(t, store, "job-1", "", 6); got != "world\n" {
+		t.Errorf("OpenOutput() at offset 6 = %q, want %q", got, "world\n")
+	}
+	if r, err := OpenOutput(store, "job-1", "lz4", 0); err == nil {
+		r.Close()
+		t.Errorf("OpenOutput() with an unknown codec succeeded")
+	}
+}
+
+// legacyDB is a memory database with output files left by migration 2.
+type legacyDB struct {
+	db.DB
+	legacy map[string]string
+}
+
+func (l *legacyDB) ListLegacyOutputs() ([]db.LegacyOutput, error) {
+	var outputs []db.LegacyOutput
+	for id, path := range l.legacy {
+		outputs = append(outputs, db.LegacyOutput{ExecutionID: id, Path: path})
+	}
+	return outputs, nil
+}
+
+func (l *legacyDB) DeleteLegacyOutput(id string) error {
+	delete(l.legacy, id)
+	return nil
+}
+
+func TestImportLegacy(t *testing.T) {
+	old := t.TempDir()
+	store := newTestDir(t)
+	database := &legacyDB{DB: db.NewMemory(), legacy: map[string]string{
+		"moved":    filepath.Join(old, "moved.txt"),
+		"in-place": filepath.Join(store.path, "in-place.txt"),
+		"missing":  filepath.Join(old, "missing.txt"),
+	}}
+	for id, path := range database.legacy {
+		if err := database.CreateExecution(db.Execution{ID: id}); err != nil {
+			t.Fatalf("CreateExecution() = %v", err)
+		}
+		if id != "missing" {
+			if err := os.WriteFile(path, []byte(id+"\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	n, err := ImportLegacy(database, store)
+	if err != nil || n != 2 {
+		t.Fatalf("ImportLegacy() = %d, %v, want 2", n, err)
+	}
+	for _, id := range []string{"moved", "in-place"} {
+		if got := readAll(t, store, id, 0); got != id+"\n" {
+			t.Errorf("output of %s = %q, want %q", id, got, id+"\n")
+		}
+		exec, err := database.GetExecution(id)
+		if err != nil || exec.OutputSize != int64(len(id)+1) {
+			t.Errorf("GetExecution(%s) = %+v, %v, want the size of its output", id, exec, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(old, "moved.txt")); !os.IsNotExist(err) {
+		t.Errorf("imported file still exists: %v", err)
+	}
+	if len(database.legacy) != 0 {
+		t.Errorf("legacy output left after import: %v", database.legacy)
+	}
+}
@@ -0,0 +1,133 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/stewyb314/remote-control/internal/config"
+)
+
+// S3 keeps job output as chunk objects named <prefix>/<id>/<offset> in an
+// S3 compatible bucket, so output of many agents can be kept centrally.
+type S3 struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func NewS3(conf config.S3Config) (*S3, error) {
+	client, err := minio.New(conf.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(conf.AccessKey, conf.SecretKey, ""),
+		Secure: conf.UseSSL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client for %s: %v", conf.Endpoint, err)
+	}
+
+	ctx := context.Background()
+	exists, err := client.BucketExists(ctx, conf.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check bucket %s: %v", conf.Bucket, err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, conf.Bucket, minio.MakeBucketOptions{}); err != nil {
+			return nil, fmt.Errorf("failed to create bucket %s: %v", conf.Bucket, err)
+		}
+	}
+
+	return &S3{
+		client: client,
+		bucket: conf.Bucket,
+		prefix: conf.Prefix,
+	}, nil
+}
+
+func (s *S3) Create(id string) (io.WriteCloser, error) {
+	return newChunkWriter(s, id), nil
+}
+
+func (s *S3) Open(id string, offset int64) (io.ReadCloser, error) {
+	return newChunkReader(s, id, offset), nil
+}
+
+func (s *S3) Delete(id string) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	objects := s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: s.dir(id)})
+	for err := range s.client.RemoveObjects(ctx, s.bucket, objects, minio.RemoveObjectsOptions{}) {
+		return fmt.Errorf("failed to remove output of job %s: %v", id, err.Err)
+	}
+	return nil
+}
+
+func (s *S3) Check(ctx context.Context) error {
+	exists, err := s.client.BucketExists(ctx, s.bucket)
+	if err != nil {
+		return fmt.Errorf("failed to check bucket %s: %v", s.bucket, err)
+	}
+	if !exists {
+		return fmt.Errorf("bucket %s does not exist", s.bucket)
+	}
+	return nil
+}
+
+func (s *S3) dir(id string) string {
+	return path.Join(s.prefix, id) + "/"
+}
+
+// key zero pads the offset so that listing returns chunks in order.
+func (s *S3) key(id string, start int64) string {
+	return fmt.Sprintf("%s%020d", s.dir(id), start)
+}
+
+func (s *S3) putChunk(id string, start int64, data []byte) error {
+	_, err := s.client.PutObject(context.Background(), s.bucket, s.key(id, start),
+		bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{ContentType: "application/octet-stream"})
+	if err != nil {
+		return fmt.Errorf("failed to store output of job %s: %v", id, err)
+	}
+	return nil
+}
+
+func (s *S3) getChunks(id string, offset int64, limit int) ([]chunk, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// chunks are never larger than chunkSize, so every chunk that ends after
+	// offset starts after offset-chunkSize
+	opts := minio.ListObjectsOptions{Prefix: s.dir(id)}
+	if offset >= chunkSize {
+		opts.StartAfter = s.key(id, offset-chunkSize)
+	}
+
+	var chunks []chunk
+	for obj := range s.client.ListObjects(ctx, s.bucket, opts) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("failed to list output of job %s: %v", id, obj.Err)
+		}
+		start, err := strconv.ParseInt(path.Base(obj.Key), 10, 64)
+		if err != nil || start+obj.Size <= offset {
+			continue
+		}
+		o, err := s.client.GetObject(ctx, s.bucket, obj.Key, minio.GetObjectOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get output of job %s: %v", id, err)
+		}
+		data, err := io.ReadAll(o)
+		o.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read output of job %s: %v", id, err)
+		}
+		chunks = append(chunks, chunk{start: start, data: data})
+		if len(chunks) == limit {
+			break
+		}
+	}
+	return chunks, nil
+}
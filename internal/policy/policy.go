@@ -0,0 +1,66 @@
+// Package policy decides which commands the agent's jobs may run.
+package policy
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/stewyb314/remote-control/internal/config"
+)
+
+// Policy allows a command when it matches none of the Deny patterns and,
+// if there are Allow patterns, at least one of those. Patterns use
+// filepath.Match syntax. A pattern with a slash matches the command as
+// given, one without matches its base name, so "rm" denies both rm and
+// /bin/rm.
+type Policy struct {
+	Allow []string `yaml:"allow" toml:"allow"`
+	Deny  []string `yaml:"deny" toml:"deny"`
+}
+
+// Load reads a policy from a YAML or TOML file.
+func Load(path string) (*Policy, error) {
+	var p Policy
+	if err := config.DecodeFile(path, &p); err != nil {
+		return nil, err
+	}
+	for _, pattern := range append(p.Allow, p.Deny...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q in %s: %v", pattern, path, err)
+		}
+	}
+	return &p, nil
+}
+
+// Check returns an error when the policy does not allow command. A nil
+// policy allows every command.
+func (p *Policy) Check(command string) error {
+	if p == nil {
+		return nil
+	}
+	if pattern, ok := match(p.Deny, command); ok {
+		return fmt.Errorf("command %s is denied by policy pattern %q", command, pattern)
+	}
+	if len(p.Allow) == 0 {
+		return nil
+	}
+	if _, ok := match(p.Allow, command); !ok {
+		return fmt.Errorf("command %s is not allowed by policy", command)
+	}
+	return nil
+}
+
+// match returns the first pattern matching command.
+func match(patterns []string, command string) (string, bool) {
+	for _, pattern := range patterns {
+		name := command
+		if !strings.Contains(pattern, "/") {
+			name = filepath.Base(command)
+		}
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return pattern, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,81 @@
+package redact
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stewyb314/remote-control/internal/config"
+)
+
+func TestArgs(t *testing.T) {
+	r, err := New(config.RedactConfig{Patterns: []string{`^-p(.+)`, `key-[0-9a-f]+`}})
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	for _, tc := range []struct {
+		name   string
+		args   []string
+		secret []int32
+		want   []string
+	}{
+		{name: "nothing secret", args: []string{"-l", "/tmp"}, want: []string{"-l", "/tmp"}},
+		{name: "password flag", args: []string{"--password", "hunter2", "db"}, want: []string{"--password", Mask, "db"}},
+		{name: "password assignment", args: []string{"--password=hunter2"}, want: []string{"--password=" + Mask}},
+		{name: "environment variable", args: []string{"PGPASSWORD=hunter2", "psql"}, want: []string{"PGPASSWORD=" + Mask, "psql"}},
+		{name: "token flag", args: []string{"-token", "abc", "-api-key=def"}, want: []string{"-token", Mask, "-api-key=" + Mask}},
+		{name: "not a secret flag", args: []string{"--passes", "3", "--user=bob"}, want: []string{"--passes", "3", "--user=bob"}},
+		{name: "URL password", args: []string{"postgres://bob:hunter2@db/app"}, want: []string{"postgres://bob:" + Mask + "@db/app"}},
+		{name: "pattern group", args: []string{"mysql", "-phunter2", "-u", "bob"}, want: []string{"mysql", "-p" + Mask, "-u", "bob"}},
+		{name: "pattern as the last argument", args: []string{"mysql", "-pSECRET"}, want: []string{"mysql", "-p" + Mask}},
+		{name: "pattern match", args: []string{"--header", "auth: key-0a1b"}, want: []string{"--header", "auth: " + Mask}},
+		{name: "secret positions", args: []string{"login", "bob", "hunter2"}, secret: []int32{2}, want: []string{"login", "bob", Mask}},
+		{name: "several positions", args: []string{"a", "b", "c"}, secret: []int32{0, 2}, want: []string{Mask, "b", Mask}},
+		{name: "positions out of range", args: []string{"a"}, secret: []int32{-1, 1}, want: []string{"a"}},
+		{name: "secret position of a flag value", args: []string{"--password", "hunter2"}, secret: []int32{1}, want: []string{"--password", Mask}},
+		{name: "no arguments", args: nil, want: []string{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			args := slices.Clone(tc.args)
+			got := r.Args(args, tc.secret)
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("Args(%q, %v) = %q, want %q", tc.args, tc.secret, got, tc.want)
+			}
+			// the command still gets its arguments unmasked
+			if !slices.Equal(args, tc.args) {
+				t.Errorf("Args() changed its input to %q", args)
+			}
+		})
+	}
+}
+
+func TestNilRedactor(t *testing.T) {
+	var r *Redactor
+	got := r.Args([]string{"--password", "hunter2", "-pSECRET"}, []int32{2})
+	// the built-in rules and positions apply without patterns
+	if want := []string{"--password", Mask, Mask}; !slices.Equal(got, want) {
+		t.Errorf("Args() = %q, want %q", got, want)
+	}
+}
+
+func TestMask(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, s, want string
+	}{
+		{`secret`, "no match", "no match"},
+		{`secret`, "a secret and a secret", "a *** and a ***"},
+		{`user=(\w+) pass=(\w+)`, "user=bob pass=x1", "user=*** pass=***"},
+		{`(a(b))`, "xaby", "x***y"},
+		{`x(y)?`, "xz", "xz"},
+	} {
+		r, err := New(config.RedactConfig{Patterns: []string{tc.pattern}})
+		if err != nil {
+			t.Fatalf("New(%q) = %v", tc.pattern, err)
+		}
+		if got := mask(r.patterns[0], tc.s); got != tc.want {
+			t.Errorf("mask(%q, %q) = %q, want %q", tc.pattern, tc.s, got, tc.want)
+		}
+	}
+	if _, err := New(config.RedactConfig{Patterns: []string{"("}}); err == nil {
+		t.Errorf("New() with an invalid pattern succeeded")
+	}
+}
@@ -0,0 +1,266 @@
+package retention
+
+import (
+	"cmp"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stewyb314/remote-control/internal/config"
+	"github.com/stewyb314/remote-control/internal/db"
+	"github.com/stewyb314/remote-control/internal/output"
+	pb "github.com/stewyb314/remote-control/protos"
+	"gorm.io/gorm"
+)
+
+// terminalStates are the states of jobs that will not write any more
+// output. Only those jobs are ever deleted.
+var terminalStates = []int32{
+	int32(pb.State_COMPLETE),
+	int32(pb.State_STOPPED),
+	int32(pb.State_ERROR),
+}
+
+// Sweeper periodically deletes the oldest finished jobs, their rows and
+// their output, until the history fits the configured limits.
+type Sweeper struct {
+	conf  config.RetentionConfig
+	db    db.DB
+	store output.Store
+	log   *logrus.Entry
+}
+
+func NewSweeper(conf config.RetentionConfig, db db.DB, store output.Store, log *logrus.Entry) *Sweeper {
+	return &Sweeper{
+		conf:  conf,
+		db:    db,
+		store: store,
+		log:   log,
+	}
+}
+
+// Start sweeps every conf.Interval until ctx is done. It does nothing when
+// the interval is not positive.
+func (s *Sweeper) Start(ctx context.Context) {
+	if s.conf.Interval <= 0 {
+		s.log.Infof("Retention sweeper disabled")
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(s.conf.Interval)
+		defer ticker.Stop()
+		for {
+			if _, err := s.Sweep(); err != nil {
+				s.log.Errorf("Retention sweep failed: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Sweep deletes finished jobs, oldest first, while any limit is exceeded
+// and returns the number of deleted jobs. A retried job is deleted with all
+// its attempts once the last one finished, so no attempt is left behind
+// without the first attempt the others are linked to. The steps of a
+// workflow are deleted together with the workflow once it finished, and a
+// one-shot schedule once the job it started is gone.
+func (s *Sweeper) Sweep() (int, error) {
+	executions, err := s.db.ListExecutions(db.ExecutionFilter{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list executions: %v", err)
+	}
+
+	byID := make(map[string]db.Execution, len(executions))
+	for _, exec := range executions {
+		byID[exec.ID] = exec
+	}
+	// jobs are grouped under their first attempt or their workflow, in
+	// the order of the oldest job of each group
+	var groups []string
+	members := make(map[string][]db.Execution)
+	var totalBytes int64
+	remaining := 0
+	for _, exec := range executions {
+		key := groupKey(exec, byID)
+		if _, ok := members[key]; !ok {
+			groups = append(groups, key)
+		}
+		members[key] = append(members[key], exec)
+		if terminal(exec) {
+			totalBytes += exec.OutputSize
+			remaining++
+		}
+	}
+	cutoff := time.Now().Add(-s.conf.MaxAge).Unix()
+
+	deleted, workflows := 0, 0
+	for _, key := range groups {
+		group := members[key]
+		// only terminal jobs are deleted, e.g. not one still being retried
+		if slices.ContainsFunc(group, func(e db.Execution) bool { return !terminal(e) }) {
+			continue
+		}
+		workflowID := group[0].WorkflowID
+		if workflowID != "" && !s.workflowFinished(workflowID) {
+			continue
+		}
+		newest := slices.MaxFunc(group, func(a, b db.Execution) int { return cmp.Compare(a.CreatedAt, b.CreatedAt) })
+		tooOld := s.conf.MaxAge > 0 && newest.CreatedAt < cutoff
+		tooMany := s.conf.MaxJobs > 0 && remaining > s.conf.MaxJobs
+		tooBig := s.conf.MaxOutputBytes > 0 && totalBytes > s.conf.MaxOutputBytes
+		if !tooOld && !tooMany && !tooBig {
+			// the counts are only going down, so only older groups
+			// further on can still be deleted
+			if s.conf.MaxAge <= 0 {
+				break
+			}
+			continue
+		}
+		// the first attempt goes last so a failed sweep leaves no orphans
+		for i := len(group) - 1; i >= 0; i-- {
+			if err := s.delete(group[i]); err != nil {
+				return deleted, err
+			}
+			deleted++
+			remaining--
+			totalBytes -= group[i].OutputSize
+			delete(byID, group[i].ID)
+		}
+		if workflowID != "" {
+			if err := s.db.DeleteWorkflow(workflowID); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return deleted, fmt.Errorf("failed to delete workflow %s: %v", workflowID, err)
+			}
+			workflows++
+		}
+	}
+	schedules, err := s.sweepSchedules(byID)
+	if err != nil {
+		return deleted, err
+	}
+	if deleted > 0 || schedules > 0 {
+		s.log.Infof("Retention sweep deleted %d jobs, %d workflows and %d schedules, %d jobs using %d output bytes remain", deleted, workflows, schedules, remaining, totalBytes)
+	}
+	return deleted, nil
+}
+
+// groupKey returns the group a job is deleted with: its workflow, or else
+// its first attempt.
+func groupKey(exec db.Execution, byID map[string]db.Execution) string {
+	if first, ok := byID[exec.RetryOf]; ok && exec.RetryOf != "" {
+		exec = first
+	}
+	if exec.WorkflowID != "" {
+		return "workflow/" + exec.WorkflowID
+	}
+	return exec.ID
+}
+
+// workflowFinished reports whether a workflow will not start any more
+// steps, also when it is already gone.
+func (s *Sweeper) workflowFinished(id string) bool {
+	workflow, err := s.db.GetWorkflow(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return true
+	}
+	if err != nil {
+		s.log.Warnf("Failed to get workflow %s: %v", id, err)
+		return false
+	}
+	return slices.Contains(terminalStates, workflow.Status)
+}
+
+// sweepSchedules deletes the one-shot schedules that ran and whose job is
+// not in jobs any more, and returns how many it deleted. One that failed to
+// start its job goes once it ran longer than the maximum age ago.
+func (s *Sweeper) sweepSchedules(jobs map[string]db.Execution) (int, error) {
+	schedules, err := s.db.ListSchedules()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list schedules: %v", err)
+	}
+	cutoff := time.Now().Add(-s.conf.MaxAge).Unix()
+	deleted := 0
+	for _, schedule := range schedules {
+		if !schedule.Finished {
+			continue
+		}
+		if schedule.LastExecutionID == "" {
+			if s.conf.MaxAge <= 0 || schedule.LastRunAt >= cutoff {
+				continue
+			}
+		} else if _, ok := jobs[schedule.LastExecutionID]; ok {
+			continue
+		}
+		if err := s.db.DeleteSchedule(schedule.ID); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return deleted, fmt.Errorf("failed to delete schedule %s: %v", schedule.ID, err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// terminal reports whether a job will not write any more output.
+func terminal(exec db.Execution) bool {
+	return slices.Contains(terminalStates, exec.Status)
+}
+
+func (s *Sweeper) delete(exec db.Execution) error {
+	if s.conf.ArchiveDir != "" {
+		if err := s.archive(exec); err != nil {
+			return fmt.Errorf("failed to archive job %s: %v", exec.ID, err)
+		}
+	}
+	if err := output.Delete(s.store, exec.ID); err != nil {
+		return fmt.Errorf("failed to delete output of job %s: %v", exec.ID, err)
+	}
+	if err := s.db.DeleteExecution(exec.ID); err != nil {
+		return fmt.Errorf("failed to delete execution %s: %v", exec.ID, err)
+	}
+	return nil
+}
+
+// archive writes the execution as <id>.json and its output as <id>.txt.gz
+// to the archive directory.
+func (s *Sweeper) archive(exec db.Execution) error {
+	if err := os.MkdirAll(s.conf.ArchiveDir, 0o755); err != nil {
+		return err
+	}
+	meta, err := json.MarshalIndent(exec, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(s.conf.ArchiveDir, exec.ID+".json"), meta, 0o644); err != nil {
+		return err
+	}
+
+	r, err := output.OpenOutput(s.store, exec.ID, exec.Compression, 0)
+	if err != nil {
+		s.log.Warnf("No output to archive for job %s: %v", exec.ID, err)
+		return nil
+	}
+	defer r.Close()
+	f, err := os.Create(filepath.Join(s.conf.ArchiveDir, exec.ID+".txt.gz"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	if _, err := io.Copy(gz, r); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,247 @@
+package retention
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stewyb314/remote-control/internal/config"
+	"github.com/stewyb314/remote-control/internal/db"
+	"github.com/stewyb314/remote-control/internal/output"
+	pb "github.com/stewyb314/remote-control/protos"
+)
+
+func newTestSweeper(t *testing.T, conf config.RetentionConfig) (*Sweeper, db.DB, output.Store) {
+	t.Helper()
+	logger := logrus.New()
+	logger.Out = io.Discard
+	store, err := output.NewDir(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDir() = %v", err)
+	}
+	database := db.NewMemory()
+	return NewSweeper(conf, database, store, logrus.NewEntry(logger)), database, store
+}
+
+// addJob records a job created age ago with size bytes of output.
+func addJob(t *testing.T, database db.DB, store output.Store, exec db.Execution, age time.Duration, size int) {
+	t.Helper()
+	w, err := store.Create(exec.ID)
+	if err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	if _, err := io.WriteString(w, strings.Repeat("x", size)); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	w.Close()
+	exec.CreatedAt = time.Now().Add(-age).Unix()
+	exec.OutputSize = int64(size)
+	if err := database.CreateExecution(exec); err != nil {
+		t.Fatalf("CreateExecution() = %v", err)
+	}
+}
+
+func completed(id string) db.Execution {
+	return db.Execution{ID: id, Status: int32(pb.State_COMPLETE)}
+}
+
+// remainingJobs returns the IDs of the jobs left in the database and fails
+// the test when the output of a deleted job was kept or of a kept one
+// deleted.
+func remainingJobs(t *testing.T, database db.DB, store output.Store, all ...string) []string {
+	t.Helper()
+	executions, err := database.ListExecutions(db.ExecutionFilter{})
+	if err != nil {
+		t.Fatalf("ListExecutions() = %v", err)
+	}
+	var ids []string
+	for _, exec := range executions {
+		ids = append(ids, exec.ID)
+	}
+	sort.Strings(ids)
+	for _, id := range all {
+		r, err := store.Open(id, 0)
+		if err == nil {
+			r.Close()
+		}
+		if kept := slices.Contains(ids, id); kept != (err == nil) {
+			t.Errorf("job %s kept = %v but its output kept = %v", id, kept, err == nil)
+		}
+	}
+	return ids
+}
+
+func TestSweepMaxAge(t *testing.T) {
+	sweeper, database, store := newTestSweeper(t, config.RetentionConfig{MaxAge: time.Hour})
+	addJob(t, database, store, completed("old"), 2*time.Hour, 10)
+	addJob(t, database, store, db.Execution{ID: "old-running", Status: int32(pb.State_RUNNING)}, 2*time.Hour, 10)
+	addJob(t, database, store, completed("new"), time.Minute, 10)
+
+	deleted, err := sweeper.Sweep()
+	if err != nil {
+		t.Fatalf("Sweep() = %v", err)
+	}
+	got := remainingJobs(t, database, store, "old", "old-running", "new")
+	if want := []string{"new", "old-running"}; deleted != 1 || !slices.Equal(got, want) {
+		t.Errorf("Sweep() deleted %d jobs leaving %v, want 1 leaving %v", deleted, got, want)
+	}
+}
+
+func TestSweepMaxJobs(t *testing.T) {
+	sweeper, database, store := newTestSweeper(t, config.RetentionConfig{MaxJobs: 2})
+	for i, id := range []string{"a", "b", "c", "d", "e"} {
+		addJob(t, database, store, completed(id), time.Duration(5-i)*time.Minute, 10)
+	}
+	if _, err := sweeper.Sweep(); err != nil {
+		t.Fatalf("Sweep() = %v", err)
+	}
+	got := remainingJobs(t, database, store, "a", "b", "c", "d", "e")
+	if want := []string{"d", "e"}; !slices.Equal(got, want) {
+		t.Errorf("jobs left = %v, want the newest %v", got, want)
+	}
+}
+
+func TestSweepMaxOutputBytes(t *testing.T) {
+	sweeper, database, store := newTestSweeper(t, config.RetentionConfig{MaxOutputBytes: 250})
+	for i, id := range []string{"a", "b", "c", "d"} {
+		addJob(t, database, store, completed(id), time.Duration(4-i)*time.Minute, 100)
+	}
+	if _, err := sweeper.Sweep(); err != nil {
+		t.Fatalf("Sweep() = %v", err)
+	}
+	got := remainingJobs(t, database, store, "a", "b", "c", "d")
+	if want := []string{"c", "d"}; !slices.Equal(got, want) {
+		t.Errorf("jobs left = %v, want %v using at most 250 bytes", got, want)
+	}
+}
+
+// TestSweepRetries checks that the attempts of a retried job are deleted
+// together with its first attempt and not while one still runs.
+func TestSweepRetries(t *testing.T) {
+	sweeper, database, store := newTestSweeper(t, config.RetentionConfig{MaxJobs: 1})
+	first := completed("first")
+	first.Attempt = 1
+	retry := completed("retry")
+	retry.Attempt, retry.RetryOf = 2, "first"
+	addJob(t, database, store, first, 3*time.Minute, 10)
+	addJob(t, database, store, completed("other"), 2*time.Minute, 10)
+	addJob(t, database, store, retry, time.Minute, 10)
+
+	if _, err := sweeper.Sweep(); err != nil {
+		t.Fatalf("Sweep() = %v", err)
+	}
+	got := remainingJobs(t, database, store, "first", "other", "retry")
+	if want := []string{"other"}; !slices.Equal(got, want) {
+		t.Errorf("jobs left = %v, want %v without attempts of a deleted job", got, want)
+	}
+
+	running := completed("running-first")
+	addJob(t, database, store, running, 4*time.Minute, 10)
+	addJob(t, database, store, db.Execution{ID: "running-retry", Status: int32(pb.State_RUNNING), Attempt: 2, RetryOf: "running-first"}, 3*time.Minute, 10)
+	if _, err := sweeper.Sweep(); err != nil {
+		t.Fatalf("Sweep() = %v", err)
+	}
+	// the older job is kept while its retry runs and the newer one goes instead
+	got = remainingJobs(t, database, store, "other", "running-first", "running-retry")
+	if want := []string{"running-first", "running-retry"}; !slices.Equal(got, want) {
+		t.Errorf("jobs left = %v, want %v while a retry runs", got, want)
+	}
+}
+
+func TestSweepArchive(t *testing.T) {
+	archive := t.TempDir()
+	sweeper, database, store := newTestSweeper(t, config.RetentionConfig{MaxJobs: 1, ArchiveDir: archive})
+	addJob(t, database, store, completed("old"), 2*time.Minute, 10)
+	addJob(t, database, store, completed("new"), time.Minute, 10)
+	if _, err := sweeper.Sweep(); err != nil {
+		t.Fatalf("Sweep() = %v", err)
+	}
+	for _, name := range []string{"old.json", "old.txt.gz"} {
+		if _, err := os.Stat(filepath.Join(archive, name)); err != nil {
+			t.Errorf("archive of the deleted job: %v", err)
+		}
+	}
+}
+
+// TestSweepWorkflows checks that the steps of a workflow are deleted
+// together with the workflow and only once it finished.
+func TestSweepWorkflows(t *testing.T) {
+	sweeper, database, store := newTestSweeper(t, config.RetentionConfig{MaxAge: time.Hour})
+	for _, workflow := range []db.Workflow{
+		{ID: "done", Status: int32(pb.State_COMPLETE)},
+		{ID: "running", Status: int32(pb.State_RUNNING)},
+	} {
+		if err := database.CreateWorkflow(workflow); err != nil {
+			t.Fatalf("CreateWorkflow() = %v", err)
+		}
+	}
+	step := func(id, workflow string) db.Execution {
+		exec := completed(id)
+		exec.WorkflowID = workflow
+		return exec
+	}
+	addJob(t, database, store, step("done-1", "done"), 3*time.Hour, 10)
+	addJob(t, database, store, step("done-2", "done"), 2*time.Hour, 10)
+	addJob(t, database, store, step("running-1", "running"), 3*time.Hour, 10)
+	// a workflow with a step that is not old enough yet is kept whole
+	if err := database.CreateWorkflow(db.Workflow{ID: "recent", Status: int32(pb.State_COMPLETE)}); err != nil {
+		t.Fatalf("CreateWorkflow() = %v", err)
+	}
+	addJob(t, database, store, step("recent-1", "recent"), 3*time.Hour, 10)
+	addJob(t, database, store, step("recent-2", "recent"), time.Minute, 10)
+
+	deleted, err := sweeper.Sweep()
+	if err != nil {
+		t.Fatalf("Sweep() = %v", err)
+	}
+	got := remainingJobs(t, database, store, "done-1", "done-2", "running-1", "recent-1", "recent-2")
+	if want := []string{"recent-1", "recent-2", "running-1"}; deleted != 2 || !slices.Equal(got, want) {
+		t.Errorf("Sweep() deleted %d jobs leaving %v, want 2 leaving %v", deleted, got, want)
+	}
+	for id, kept := range map[string]bool{"done": false, "running": true, "recent": true} {
+		if _, err := database.GetWorkflow(id); (err == nil) != kept {
+			t.Errorf("workflow %s kept = %v, want %v", id, err == nil, kept)
+		}
+	}
+}
+
+// TestSweepSchedules checks that a one-shot schedule that ran is deleted
+// with its job and that others are kept.
+func TestSweepSchedules(t *testing.T) {
+	sweeper, database, store := newTestSweeper(t, config.RetentionConfig{MaxAge: time.Hour})
+	addJob(t, database, store, completed("old"), 2*time.Hour, 10)
+	addJob(t, database, store, completed("new"), time.Minute, 10)
+	for _, schedule := range []db.Schedule{
+		{ID: "ran-old", Finished: true, LastExecutionID: "old"},
+		{ID: "ran-new", Finished: true, LastExecutionID: "new"},
+		{ID: "failed-old", Finished: true, LastRunAt: time.Now().Add(-2 * time.Hour).Unix()},
+		{ID: "failed-new", Finished: true, LastRunAt: time.Now().Unix()},
+		{ID: "cron", Cron: "@hourly", LastExecutionID: "old"},
+	} {
+		if err := database.CreateSchedule(schedule); err != nil {
+			t.Fatalf("CreateSchedule() = %v", err)
+		}
+	}
+
+	if _, err := sweeper.Sweep(); err != nil {
+		t.Fatalf("Sweep() = %v", err)
+	}
+	schedules, err := database.ListSchedules()
+	if err != nil {
+		t.Fatalf("ListSchedules() = %v", err)
+	}
+	var got []string
+	for _, schedule := range schedules {
+		got = append(got, schedule.ID)
+	}
+	sort.Strings(got)
+	if want := []string{"cron", "failed-new", "ran-new"}; !slices.Equal(got, want) {
+		t.Errorf("schedules left = %v, want %v", got, want)
+	}
+}
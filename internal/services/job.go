@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	pb "github.com/stewyb314/remote-control/protos"
+)
+
+// jobState is the lifecycle of a job in the registry. A job only moves
+// forward through the states, any of them but done may be skipped:
+//
+//	pending -> starting -> running -> stopping -> done
+type jobState int
+
+const (
+	// jobPending jobs wait in the queue for a free slot
+	jobPending jobState = iota
+	// jobStarting jobs have left the queue but their process is not
+	// running yet
+	jobStarting
+	// jobRunning jobs have a running process
+	jobRunning
+	// jobStopping jobs were asked to stop and wait for the process to exit
+	jobStopping
+	// jobDone jobs have finished and are about to leave the registry
+	jobDone
+)
+
+var jobStateNames = [...]string{"pending", "starting", "running", "stopping", "done"}
+
+func (s jobState) String() string {
+	return jobStateNames[s]
+}
+
+type job struct {
+	id     string
+	state  jobState
+	ctx    context.Context
+	cancel context.CancelFunc
+	// traceCtx carries the span of the job's lifetime and log, unlike ctx
+	// it is not cancelled when the job stops
+	traceCtx context.Context
+	// log is the entry of the request that started the job with the job's
+	// ID added
+	log *logrus.Entry
+	// seq orders jobs by submission
+	seq      uint64
+	owner    string
+	priority int32
+	command  string
+	args     []string
+	// redacted are the args with their secrets masked, see Jobs.RedactArgs
+	redacted []string
+	output   *limitWriter
+	// req is the request the job was started with, kept for retries
+	req  *pb.StartRequest
+	opts jobOptions
+}
+
+// jobOptions are the settings of jobs started by the agent itself rather
+// than by a Start request.
+type jobOptions struct {
+	// scheduleID is the schedule that starts the job
+	scheduleID string
+	// workflowID and step are the workflow step the job runs
+	workflowID string
+	step       string
+	// timeout stops the job once it ran this long, 0 for no timeout
+	timeout time.Duration
+	// onDone is called once the job's final state is recorded, for a
+	// retried job once its last attempt finished
+	onDone func(JobDone)
+	// attempt and retryOf link a retry to the job's first attempt
+	attempt int32
+	retryOf string
+	// idempotencyKey is recorded with the job, see Jobs.NewJob
+	idempotencyKey string
+	// delay keeps the job out of the queue for a while, e.g. the backoff
+	// before a retry
+	delay time.Duration
+}
+
+// active reports whether the job occupies one of the agent's slots.
+func (jb *job) active() bool {
+	return jb.state > jobPending && jb.state < jobDone
+}
+
+// transition moves the job to state to. The registry lock must be held.
+func (jb *job) transition(to jobState) error {
+	if to <= jb.state {
+		return fmt.Errorf("job %s can not move from %s to %s", jb.id, jb.state, to)
+	}
+	jb.state = to
+	return nil
+}
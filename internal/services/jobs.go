@@ -1,43 +1,98 @@
 package services
 
 import (
-	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"io"
 	"os/exec"
+	"slices"
 	"sync"
+	"time"
 	pb "github.com/stewyb314/remote-control/protos"
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
+	"github.com/stewyb314/remote-control/internal/config"
 	"github.com/stewyb314/remote-control/internal/db"
+	"github.com/stewyb314/remote-control/internal/logging"
+	"github.com/stewyb314/remote-control/internal/metrics"
+	"github.com/stewyb314/remote-control/internal/output"
+	"github.com/stewyb314/remote-control/internal/policy"
+	"github.com/stewyb314/remote-control/internal/redact"
+	"github.com/stewyb314/remote-control/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/datatypes"
 )
 
-type job struct {
-	cancel func()
-}
-
+// Jobs is the registry of the jobs that have not finished yet. It is safe
+// for concurrent use, jobs are only ever added by NewJob and removed by the
+// monitor once their final state has been recorded. Jobs that do not fit
+// the concurrency limits wait in queue until a running job finishes.
 type Jobs struct {
-	jobs map[string]job
+	mu sync.Mutex
+	// conf, policy and redactor can change while the agent runs, all are
+	// guarded by mu
+	conf config.JobsConfig
+	policy *policy.Policy
+	redactor *redact.Redactor
+	// draining refuses new jobs, see Drain
+	draining bool
+	jobs map[string]*job
+	queue []*job
+	seq uint64
 	db db.DB
+	store output.Store
 	log *logrus.Entry
 	doneChan chan JobDone
+	// attempts maps the first attempt of a job that is being retried to
+	// its current attempt
+	attempts map[string]string
+	// keyMu serializes start requests with an idempotency key so two
+	// requests with the same key never both start a job
+	keyMu sync.Mutex
 }
 
 type JobDone struct {
 	id string
 	status int32
 	ExitCode int32
+	OutputSize int64
+	Truncated bool
+	Compression string
+	// duration is how long the process ran, 0 when it never started
+	duration time.Duration
+	// tail is the output kept of a job that overflowed in ring mode, it
+	// replaces the stored output once the job is recorded as finished
+	tail []byte
+}
+
+// countingWriter counts the bytes written to a job's output. exec only
+// writes from a single goroutine when Stdout and Stderr are the same writer.
+type countingWriter struct {
+	io.WriteCloser
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.WriteCloser.Write(p)
+	c.n += int64(n)
+	metrics.OutputBytes.Add(float64(n))
+	return n, err
 }
 
 
 
-func NewJobs(db db.DB, log *logrus.Entry) *Jobs {
+func NewJobs(conf config.JobsConfig, db db.DB, store output.Store, log *logrus.Entry) *Jobs {
 	j := &Jobs{
-		jobs: make(map[string]job),
+		conf: conf,
+		jobs: make(map[string]*job),
+		attempts: make(map[string]string),
 		db: db,
+		store: store,
 		log: log,
 	}
 	j.doneChan = make(chan JobDone)
@@ -45,22 +100,101 @@ func NewJobs(db db.DB, log *logrus.Entry) *Jobs {
 	return j
 }	
 
+// SetConfig replaces the job limits. Running jobs keep the output limit
+// they started with, raised concurrency limits start queued jobs right away.
+func (j *Jobs) SetConfig(conf config.JobsConfig) {
+	j.mu.Lock()
+	j.conf = conf
+	j.mu.Unlock()
+	j.schedule()
+}
+
+// SetPolicy replaces the policy new jobs are checked against, nil allows
+// every command. Jobs that already started are not affected.
+func (j *Jobs) SetPolicy(p *policy.Policy) {
+	j.mu.Lock()
+	j.policy = p
+	j.mu.Unlock()
+}
+
+// logger returns the entry ctx carries, e.g. of the request being
+// handled, or the agent's.
+func (j *Jobs) logger(ctx context.Context) *logrus.Entry {
+	return logging.FromContext(ctx, j.log)
+}
+
+// SetRedactor replaces the redactor that masks the secrets in the arguments
+// of new jobs, nil masks only the built-in ones. Jobs that were already
+// recorded are not affected.
+func (j *Jobs) SetRedactor(r *redact.Redactor) {
+	j.mu.Lock()
+	j.redactor = r
+	j.mu.Unlock()
+}
+
+// RedactArgs returns the arguments of in with its secrets masked, as they
+// are logged and stored.
+func (j *Jobs) RedactArgs(in *pb.StartRequest) []string {
+	j.mu.Lock()
+	r := j.redactor
+	j.mu.Unlock()
+	return r.Args(in.GetArgs(), in.GetSecretArgs())
+}
+
+// ErrAgentRestarted is the error of jobs that were running or queued when
+// the agent stopped.
+const ErrAgentRestarted = "agent restarted"
+
+// Recover marks the jobs a previous run of the agent left RUNNING or
+// PENDING as ERROR, as nothing runs them any more, and returns how many it
+// marked. It is called once on startup, before any job is started.
+func (j *Jobs) Recover() (int, error) {
+	execs, err := j.db.ListExecutions(db.ExecutionFilter{
+		States: []int32{int32(pb.State_RUNNING), int32(pb.State_PENDING)},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list unfinished jobs: %v", err)
+	}
+	for _, exec := range execs {
+		j.log.WithField("job_id", exec.ID).Warnf("Job %s was %s when the agent stopped, marking it failed", exec.ID, pb.State(exec.Status))
+		exec.Status = int32(pb.State_ERROR)
+		exec.Error = ErrAgentRestarted
+		if err := j.db.UpdateExecution(exec); err != nil {
+			return 0, fmt.Errorf("failed to update job %s: %v", exec.ID, err)
+		}
+	}
+	return len(execs), nil
+}
+
+func (j *Jobs) config() config.JobsConfig {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.conf
+}
+
 // monitorJobs listens for job completion signals and updates the database accordingly.
 func (j *Jobs) monitorJobs() {
 	go func() {
 		for done := range j.doneChan {
-			j.log.Infof("Job %s finished with status %d and exit code %d", done.id, done.status, done.ExitCode)
-			delete(j.jobs, done.id)
-			exec, err := j.db.GetExecution(done.id)
-			if err != nil {
-				j.log.Errorf("Failed to get execution for job %s: %v", done.id, err)
-				continue
+			j.mu.Lock()
+			jb := j.jobs[done.id]
+			j.mu.Unlock()
+			ctx := context.Background()
+			if jb != nil {
+				ctx = jb.traceCtx
 			}
-			exec.Status = done.status
-			exec.ExitCode = done.ExitCode
-			if err := j.db.UpdateExecution(*exec); err != nil {
-				j.log.Errorf("Failed to update execution for job %s: %v", done.id, err)
-				continue
+			j.logger(ctx).Infof("Job %s finished with status %d and exit code %d", done.id, done.status, done.ExitCode)
+			// the next attempt exists before this one is recorded as
+			// finished, so the job never looks done in between
+			retried := jb != nil && j.retry(jb, done)
+			j.recordDone(ctx, done)
+			observeDone(done)
+			endSpan(ctx, done)
+			// the job only leaves the registry once its final state is
+			// recorded, so StopJob never sees it in neither place
+			j.remove(done.id)
+			if jb != nil && !retried && jb.opts.onDone != nil {
+				go jb.opts.onDone(done)
 			}
 		}
 		j.log.Infof("Done channel closed, stopping job monitoring")
@@ -68,107 +202,425 @@ func (j *Jobs) monitorJobs() {
 	j.log.Infof("Done Monitoring jobs")
 }
 
-func (j *Jobs) NewJob(command string, args []string) (string, error){
-	id := uuid.New().String()
-	file := "jobs/" + id + ".txt"
-	fw, err  := fileWrite(file)
+// recordDone stores the final state of a job.
+func (j *Jobs) recordDone(ctx context.Context, done JobDone) {
+	database := j.db.WithContext(ctx)
+	exec, err := database.GetExecution(done.id)
 	if err != nil {
-		j.log.Errorf("Failed to create file %s: %v", file, err)
-		return "", fmt.Errorf("failed to create file %s: %v", file, err)
+		j.logger(ctx).Errorf("Failed to get execution for job %s: %v", done.id, err)
+		return
 	}
-	a, err := json.Marshal(args)
+	exec.Status = done.status
+	exec.ExitCode = done.ExitCode
+	exec.OutputSize = done.OutputSize
+	exec.Truncated = done.Truncated
+	exec.Compression = done.Compression
+	if err := database.UpdateExecution(*exec); err != nil {
+		j.logger(ctx).Errorf("Failed to update execution for job %s: %v", done.id, err)
+		return
+	}
+	// readers use the compressed copy from now on
+	if done.Compression != "" {
+		if err := j.store.Delete(done.id); err != nil {
+			j.logger(ctx).Errorf("Failed to delete uncompressed output of job %s: %v", done.id, err)
+		}
+	} else if done.tail != nil {
+		if err := j.replaceOutput(done.id, done.tail); err != nil {
+			j.logger(ctx).Errorf("Failed to keep the last %d output bytes of job %s: %v", len(done.tail), done.id, err)
+		}
+	}
+}
+
+// observeDone records a finished job in the metrics.
+func observeDone(done JobDone) {
+	state := metrics.StateCompleted
+	switch {
+	case done.status == int32(pb.State_STOPPED):
+		state = metrics.StateStopped
+	case done.status == int32(pb.State_ERROR) || done.ExitCode != 0:
+		state = metrics.StateFailed
+	}
+	metrics.JobsFinished.WithLabelValues(state).Inc()
+	if done.duration > 0 {
+		metrics.JobDuration.WithLabelValues(state).Observe(done.duration.Seconds())
+	}
+}
+
+// endSpan ends the span of a job's lifetime with its final state.
+func endSpan(ctx context.Context, done JobDone) {
+	span := trace.SpanFromContext(ctx)
+	state := pb.State(done.status)
+	span.SetAttributes(attribute.String("job.state", state.String()), attribute.Int("job.exit_code", int(done.ExitCode)))
+	if state == pb.State_ERROR || done.ExitCode != 0 {
+		span.SetStatus(codes.Error, fmt.Sprintf("job finished in state %s with exit code %d", state, done.ExitCode))
+	}
+	span.End()
+}
+
+// setState moves a registered job to state to.
+func (j *Jobs) setState(id string, to jobState) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	jb, ok := j.jobs[id]
+	if !ok {
+		return fmt.Errorf("no job found with ID %s", id)
+	}
+	return jb.transition(to)
+}
+
+// remove takes a finished job out of the registry and starts queued jobs
+// in the slot it frees. It returns the removed job.
+func (j *Jobs) remove(id string) *job {
+	j.mu.Lock()
+	jb, ok := j.jobs[id]
+	if ok {
+		if err := jb.transition(jobDone); err != nil {
+			j.log.Errorf("Failed to finish job: %v", err)
+		}
+		jb.cancel()
+		delete(j.jobs, id)
+	}
+	j.mu.Unlock()
+	j.schedule()
+	return jb
+}
+
+// NewJob queues a new job and starts it right away when the concurrency
+// limits allow it. A request whose idempotency key was used by the same
+// owner within the idempotency window returns the job of that request.
+func (j *Jobs) NewJob(ctx context.Context, in *pb.StartRequest) (string, error){
+	ctx, span := tracing.Tracer().Start(ctx, "Jobs.NewJob", trace.WithAttributes(attribute.String("job.command", in.Command)))
+	defer span.End()
+	window := j.config().IdempotencyWindow
+	if in.IdempotencyKey == "" || window <= 0 {
+		return j.newJob(ctx, in, jobOptions{})
+	}
+	j.keyMu.Lock()
+	defer j.keyMu.Unlock()
+	execs, err := j.db.WithContext(ctx).ListExecutions(db.ExecutionFilter{
+		IdempotencyKey: in.IdempotencyKey,
+		CreatedAfter: time.Now().Add(-window).Unix(),
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal args: %v", err)
+		return "", fmt.Errorf("failed to look up idempotency key: %v", err)
 	}
-	ctx, cancel  := context.WithCancel(context.Background())
-	
-	newJob := job{
-		cancel: cancel,
+	for _, exec := range execs {
+		if exec.Owner == in.Owner {
+			j.logger(ctx).Infof("Start request with idempotency key %s already started job %s", in.IdempotencyKey, exec.ID)
+			return exec.ID, nil
+		}
 	}
+	return j.newJob(ctx, in, jobOptions{idempotencyKey: in.IdempotencyKey})
+}
+
+// checkNoSecrets returns an error when in has arguments that are secret or
+// that the agent masks. Schedules and workflows keep the requests they start
+// jobs with in the database, so they must not contain secrets.
+func (j *Jobs) checkNoSecrets(in *pb.StartRequest) error {
+	if len(in.SecretArgs) > 0 || !slices.Equal(j.RedactArgs(in), in.Args) {
+		return errors.New("the command has secret arguments, which would be stored in the database")
+	}
+	return nil
+}
+
+// validateSecretArgs checks that the secret arguments of in exist.
+func validateSecretArgs(in *pb.StartRequest) error {
+	for _, i := range in.SecretArgs {
+		if i < 0 || int(i) >= len(in.Args) {
+			return fmt.Errorf("invalid secret argument %d, the command has %d arguments", i, len(in.Args))
+		}
+	}
+	return nil
+}
 
+// newJob queues a new job with the agent's own settings in opts. The span
+// of the job's lifetime is linked to the one in ctx, e.g. of the request
+// that started it.
+func (j *Jobs) newJob(ctx context.Context, in *pb.StartRequest, opts jobOptions) (string, error) {
+	if err := validateRetry(in.Retry); err != nil {
+		return "", err
+	}
+	if err := validateSecretArgs(in); err != nil {
+		return "", err
+	}
+	j.mu.Lock()
+	conf, p, draining := j.conf, j.policy, j.draining
+	j.mu.Unlock()
+	// retries finish what was accepted before the agent started draining
+	if draining && opts.retryOf == "" {
+		return "", ErrDraining
+	}
+	if err := p.Check(in.Command); err != nil {
+		return "", err
+	}
+	command, args := in.Command, in.Args
+	// only the job's process gets the secrets, the database and the log
+	// get them masked
+	redacted := j.RedactArgs(in)
+	id := uuid.New().String()
+	// everything logged about the job has its ID and the fields of the
+	// request that started it
+	log := j.logger(ctx).WithField("job_id", id)
+	if opts.scheduleID != "" {
+		log = log.WithField("schedule_id", opts.scheduleID)
+	}
+	if opts.workflowID != "" {
+		log = log.WithField("workflow_id", opts.workflowID)
+	}
+	a, err := json.Marshal(redacted)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal args: %v", err)
+	}
+	fw, err := j.store.Create(id)
+	if err != nil {
+		log.Errorf("Failed to create output for job %s: %v", id, err)
+		return "", fmt.Errorf("failed to create output for job %s: %v", id, err)
+	}
+	jobCtx, cancel  := context.WithCancel(context.Background())
 
+	attempt := max(opts.attempt, 1)
 	cmd := db.Execution{
 		Command: command,
 		Args:    datatypes.JSON(a),
 		ID:     id,
-		Status: int32(pb.State_RUNNING),
-		Output: file,
+		Status: int32(pb.State_PENDING),
+		Owner: in.Owner,
+		Priority: in.Priority,
+		ScheduleID: opts.scheduleID,
+		WorkflowID: opts.workflowID,
+		Step: opts.step,
+		Attempt: attempt,
+		RetryOf: opts.retryOf,
+		IdempotencyKey: opts.idempotencyKey,
 	}
-	j.log.Infof("Creating new job %s with command %+v", id, cmd)
+	log.WithFields(logrus.Fields{
+		"command": command,
+		"args": redacted,
+		"owner": in.Owner,
+		"attempt": attempt,
+	}).Infof("Creating new job %s", id)
 
-	if err := j.db.CreateExecution(cmd); err != nil {
-		j.log.Errorf("Failed to create execution: %v", err)
+	if err := j.db.WithContext(ctx).CreateExecution(cmd); err != nil {
+		log.Errorf("Failed to create execution: %v", err)
+		cancel()
+		// no job row refers to the output, so nothing would delete it
+		fw.Close()
+		if err := j.store.Delete(id); err != nil {
+			log.Errorf("Failed to delete output of job %s: %v", id, err)
+		}
 		return "", fmt.Errorf("failed to create execution: %v", err)
 	}
-	j.jobs[id] = newJob
-	j.startJob(ctx, command, args, fw, id)
+
+	// the job outlives the request, so its span starts a trace of its own
+	_, span := tracing.Tracer().Start(context.Background(), "job",
+		trace.WithNewRoot(),
+		trace.WithLinks(trace.LinkFromContext(ctx)),
+		trace.WithAttributes(
+			attribute.String("job.id", id),
+			attribute.String("job.command", command),
+			attribute.String("job.owner", in.Owner),
+			attribute.Int("job.attempt", int(attempt)),
+		))
+	traceCtx := logging.NewContext(trace.ContextWithSpan(context.Background(), span), log)
+	limit, mode := outputLimit(conf, in)
+	jb := &job{
+		id: id,
+		state: jobPending,
+		ctx: jobCtx,
+		cancel: cancel,
+		traceCtx: traceCtx,
+		log: log,
+		owner: in.Owner,
+		priority: in.Priority,
+		command: command,
+		args: args,
+		redacted: redacted,
+		req: in,
+		opts: opts,
+		output: &limitWriter{
+			out:   &countingWriter{WriteCloser: fw},
+			limit: limit,
+			mode:  mode,
+			kill: func() {
+				if err := j.StopJob(traceCtx, id); err != nil {
+					log.Errorf("Failed to stop job %s after exceeding its output limit: %v", id, err)
+				}
+			},
+		},
+	}
+	j.mu.Lock()
+	j.seq++
+	jb.seq = j.seq
+	j.jobs[id] = jb
+	if opts.delay <= 0 {
+		j.queue = append(j.queue, jb)
+	}
+	j.mu.Unlock()
+
+	if opts.delay > 0 {
+		time.AfterFunc(opts.delay, func() {
+			j.mu.Lock()
+			// a stop takes the job out of pending while it waits
+			if jb.state == jobPending {
+				j.queue = append(j.queue, jb)
+			}
+			j.mu.Unlock()
+			j.schedule()
+		})
+	}
+	j.schedule()
 	return id, nil
 }
 
-func (j *Jobs) StopJob(id string) error {
-	exec, err := j.db.GetExecution(id)
+// StopJob asks a job to stop. A queued job is taken out of the queue and
+// never started. Stopping a job that is already stopping, completed or
+// stopped is not an error. The stop is logged with the entry ctx carries,
+// e.g. of the Stop request.
+func (j *Jobs) StopJob(ctx context.Context, id string) error {
+	j.mu.Lock()
+	// stopping a retried job stops its current attempt
+	if current, ok := j.attempts[id]; ok {
+		id = current
+	}
+	jb, ok := j.jobs[id]
+	queued := false
+	if ok && jb.state != jobStopping {
+		queued = jb.state == jobPending
+		if queued {
+			j.dequeue(jb)
+		}
+		if err := jb.transition(jobStopping); err != nil {
+			j.mu.Unlock()
+			return err
+		}
+		jb.cancel()
+		trace.SpanFromContext(jb.traceCtx).AddEvent("stopping")
+		logging.FromContext(ctx, jb.log).WithField("job_id", id).Infof("Job %s stopping", id)
+	}
+	j.mu.Unlock()
+	if queued {
+		go j.finishJob(jb.output, JobDone{status: int32(pb.State_STOPPED), ExitCode: 0, id: id})
+	}
+	if ok {
+		return nil
+	}
+
+	exec, err := j.db.WithContext(ctx).GetExecution(id)
 	if err != nil {
 		return fmt.Errorf("failed to get execution for job ID %s: %v", id, err)
 	}
 	if exec.Status == int32(pb.State_COMPLETE) || exec.Status == int32(pb.State_STOPPED) {
 		return nil
 	}
-	job, ok := j.jobs[id]
-	if !ok {
-		return fmt.Errorf("no job found with ID %s", id)
-	}
-	job.cancel()
-	delete(j.jobs, id)
-	j.log.Infof("Job %s stopped", id)
-	return nil
+	return fmt.Errorf("no job found with ID %s", id)
 }
 
-// startJob starts the job in a goroutine and handles its output.
-// It writes the output to an io.Writer (in this case, a file).
-// 
-func (j *Jobs) startJob(ctx context.Context, cmd string, args[]string, output *bufio.Writer, id string) {
-	
-	j.log.Infof("Starting job %s with args %v", cmd, args)
-	finished := make(chan struct{})
-
-	execCmd := exec.CommandContext(ctx, cmd, args...)
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {	
-		defer output.Flush()
-
-		execCmd.Stdout = output
-		execCmd.Stderr =  output
-		err := execCmd.Start()	
-		wg.Done()
-		if err != nil {
-			j.doneChan <- JobDone{status: int32(pb.State_ERROR), ExitCode: -1, id: id}
-			return
-		}
-			select {
-			case <-ctx.Done():
-				if err := execCmd.Process.Kill(); err != nil {
-					j.doneChan <- JobDone{status: int32(pb.State_ERROR), ExitCode: -1, id: id}
-				} else {
-					j.doneChan <- JobDone{status: int32(pb.State_STOPPED), ExitCode: 0, id: id}
-				}
-			case <-finished:
-				j.doneChan <- JobDone{status: int32(pb.State_COMPLETE), ExitCode: int32(execCmd.ProcessState.ExitCode()), id: id }
+// startJob starts the job's process and a goroutine that waits for it.
+// The output is closed before the job is reported done so readers see all
+// of it. Cancelling the job's context kills the process and the job ends up
+// STOPPED.
+func (j *Jobs) startJob(jb *job) {
+	ctx, id, output, log := jb.ctx, jb.id, jb.output, jb.log
+	log.WithFields(logrus.Fields{
+		"command": jb.command,
+		"args": jb.redacted,
+	}).Infof("Starting job %s", id)
+
+	trace.SpanFromContext(jb.traceCtx).AddEvent("starting")
+	if err := j.setStatus(jb.traceCtx, id, pb.State_RUNNING); err != nil {
+		log.Errorf("Failed to mark job %s running: %v", id, err)
+	}
+	execCmd := exec.CommandContext(ctx, jb.command, jb.args...)
+	execCmd.Stdout = output
+	execCmd.Stderr = output
+	killProcessGroup(execCmd)
+	if err := execCmd.Start(); err != nil {
+		done := JobDone{status: int32(pb.State_ERROR), ExitCode: -1, id: id}
+		if ctx.Err() != nil {
+			done.status = int32(pb.State_STOPPED)
+		} else {
+			log.Errorf("Failed to start job %s: %v", id, err)
+		}
+		go j.finishJob(output, done)
+		return
+	}
+	started := time.Now()
+	metrics.JobsStarted.Inc()
+	// a stop may already have moved the job to stopping
+	if err := j.setState(id, jobRunning); err != nil {
+		log.Debugf("Job %s started: %v", id, err)
+	}
+	var timeout *time.Timer
+	if jb.opts.timeout > 0 {
+		timeout = time.AfterFunc(jb.opts.timeout, func() {
+			log.Warnf("Job %s timed out after %s", id, jb.opts.timeout)
+			if err := j.StopJob(jb.traceCtx, id); err != nil {
+				log.Errorf("Failed to stop job %s after its timeout: %v", id, err)
 			}
-	}()
-	// ensure that the execCmd.Start() has been called before we wait for it
-	wg.Wait()
-	go func ()  {
-		defer close(finished)
-		execCmd.Wait()		
-	}()
+		})
+	}
 
+	go func() {
+		err := execCmd.Wait()
+		if timeout != nil {
+			timeout.Stop()
+		}
+		done := JobDone{status: int32(pb.State_COMPLETE), ExitCode: int32(execCmd.ProcessState.ExitCode()), id: id}
+		if ctx.Err() != nil {
+			done = JobDone{status: int32(pb.State_STOPPED), ExitCode: 0, id: id}
+		} else if err != nil && !errors.As(err, new(*exec.ExitError)) {
+			log.Errorf("Failed to wait for job %s: %v", id, err)
+		}
+		done.duration = time.Since(started)
+		j.finishJob(output, done)
+	}()
 }
 
-func fileWrite(file string) (*bufio.Writer, error){
-	f, err := os.Create(file)
+// setStatus records the state of a job that has not finished.
+func (j *Jobs) setStatus(ctx context.Context, id string, state pb.State) error {
+	database := j.db.WithContext(ctx)
+	exec, err := database.GetExecution(id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create file %s: %v", file, err)
+		return err
+	}
+	exec.Status = int32(state)
+	return database.UpdateExecution(*exec)
+}
+
+// finishJob closes the job's output and reports it done.
+func (j *Jobs) finishJob(out *limitWriter, done JobDone) {
+	if err := out.Close(); err != nil {
+		j.log.Errorf("Failed to close output for job %s: %v", done.id, err)
 	}
-	return bufio.NewWriter(f), nil
-}
\ No newline at end of file
+	done.OutputSize = out.out.n
+	done.Truncated = out.truncated
+	if out.ring != nil {
+		tail, err := j.keptTail(done.id, out)
+		if err != nil {
+			j.log.Errorf("Failed to keep the last %d output bytes of job %s: %v", out.limit, done.id, err)
+		} else {
+			done.tail = tail
+			done.OutputSize = int64(len(tail))
+		}
+	}
+	if out.truncated {
+		j.log.Warnf("Output of job %s exceeded its limit of %d bytes", done.id, out.limit)
+	}
+	compression := j.config().OutputCompression
+	if compression != config.CompressionNone && done.OutputSize > 0 {
+		var size int64
+		var err error
+		if done.tail != nil {
+			size, err = output.CompressFrom(j.store, done.id, compression, bytes.NewReader(done.tail))
+		} else {
+			size, err = output.Compress(j.store, done.id, compression)
+		}
+		if err != nil {
+			j.log.Errorf("Failed to compress output of job %s: %v", done.id, err)
+		} else {
+			done.Compression = compression
+			done.OutputSize = size
+		}
+	}
+	j.doneChan <- done
+}
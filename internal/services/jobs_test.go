@@ -0,0 +1,944 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+	"github.com/stewyb314/remote-control/internal/config"
+	"github.com/stewyb314/remote-control/internal/db"
+	"github.com/stewyb314/remote-control/internal/logging"
+	"github.com/stewyb314/remote-control/internal/output"
+	"github.com/stewyb314/remote-control/internal/policy"
+	"github.com/stewyb314/remote-control/internal/redact"
+	pb "github.com/stewyb314/remote-control/protos"
+	"google.golang.org/protobuf/encoding/protojson"
+	"gorm.io/datatypes"
+)
+
+const concurrentJobs = 200
+
+func newTestJobs(t *testing.T, conf config.JobsConfig) (*Jobs, db.DB) {
+	t.Helper()
+	logger := logrus.New()
+	logger.Out = io.Discard
+	store, err := output.NewDir(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDir() = %v", err)
+	}
+	database := db.NewMemory()
+	conf.OutputCompression = config.CompressionNone
+	return NewJobs(conf, database, store, logrus.NewEntry(logger)), database
+}
+
+// waitForState polls until the job is in state or fails the test.
+func waitForState(t *testing.T, database db.DB, id string, state pb.State) {
+	t.Helper()
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		exec, err := database.GetExecution(id)
+		if err != nil {
+			t.Fatalf("GetExecution(%s) = %v", id, err)
+		}
+		if exec.Status == int32(state) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not reach state %s", id, state)
+}
+
+func startJobs(t *testing.T, jobs *Jobs, n int, in *pb.StartRequest) []string {
+	t.Helper()
+	ids := make([]string, n)
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id, err := jobs.NewJob(context.Background(), in)
+			if err != nil {
+				errs <- err
+				return
+			}
+			ids[i] = id
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("NewJob() = %v", err)
+	}
+	return ids
+}
+
+func TestJobsConcurrentComplete(t *testing.T) {
+	jobs, database := newTestJobs(t, config.JobsConfig{})
+	ids := startJobs(t, jobs, concurrentJobs, &pb.StartRequest{Command: "true"})
+	for _, id := range ids {
+		waitForState(t, database, id, pb.State_COMPLETE)
+	}
+}
+
+func TestJobsConcurrentStop(t *testing.T) {
+	jobs, database := newTestJobs(t, config.JobsConfig{})
+	ids := startJobs(t, jobs, concurrentJobs, &pb.StartRequest{Command: "sleep", Args: []string{"30"}})
+
+	// stop every job twice from different goroutines, the second stop
+	// races with the first and must not fail
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*len(ids))
+	for _, id := range ids {
+		for range 2 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := jobs.StopJob(context.Background(), id); err != nil {
+					errs <- fmt.Errorf("StopJob(%s) = %v", id, err)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	for _, id := range ids {
+		waitForState(t, database, id, pb.State_STOPPED)
+	}
+}
+
+func TestJobsStopFinished(t *testing.T) {
+	jobs, database := newTestJobs(t, config.JobsConfig{})
+	id, err := jobs.NewJob(context.Background(), &pb.StartRequest{Command: "true"})
+	if err != nil {
+		t.Fatalf("NewJob() = %v", err)
+	}
+	waitForState(t, database, id, pb.State_COMPLETE)
+	if err := jobs.StopJob(context.Background(), id); err != nil {
+		t.Errorf("StopJob() of a completed job = %v", err)
+	}
+	if err := jobs.StopJob(context.Background(), "no-such-job"); err == nil {
+		t.Errorf("StopJob() of an unknown job succeeded")
+	}
+}
+
+func TestJobsStartError(t *testing.T) {
+	jobs, database := newTestJobs(t, config.JobsConfig{})
+	id, err := jobs.NewJob(context.Background(), &pb.StartRequest{Command: "/no/such/command"})
+	if err != nil {
+		t.Fatalf("NewJob() = %v", err)
+	}
+	waitForState(t, database, id, pb.State_ERROR)
+}
+
+// failingInsertDB is a database that cannot record new jobs.
+type failingInsertDB struct {
+	db.DB
+}
+
+func (failingInsertDB) CreateExecution(db.Execution) error {
+	return errors.New("disk full")
+}
+
+func (d failingInsertDB) WithContext(ctx context.Context) db.DB {
+	return d
+}
+
+// TestJobsCreateExecutionError checks that the output of a job that could
+// not be recorded is not left behind.
+func TestJobsCreateExecutionError(t *testing.T) {
+	logger := logrus.New()
+	logger.Out = io.Discard
+	dir := t.TempDir()
+	store, err := output.NewDir(dir)
+	if err != nil {
+		t.Fatalf("NewDir() = %v", err)
+	}
+	jobs := NewJobs(config.JobsConfig{}, failingInsertDB{db.NewMemory()}, store, logrus.NewEntry(logger))
+	if _, err := jobs.NewJob(context.Background(), &pb.StartRequest{Command: "echo"}); err == nil {
+		t.Fatalf("NewJob() succeeded without recording the job")
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir() = %v", err)
+	}
+	if len(files) != 0 {
+		t.Errorf("output left for a job that was never recorded: %v", files)
+	}
+}
+
+func TestJobsQueue(t *testing.T) {
+	jobs, database := newTestJobs(t, config.JobsConfig{MaxJobs: 2, QueueOrder: config.QueuePriority})
+	sleep := func(priority int32) *pb.StartRequest {
+		return &pb.StartRequest{Command: "sleep", Args: []string{"30"}, Priority: priority}
+	}
+	var ids []string
+	for _, priority := range []int32{0, 0, 1, 5, 1} {
+		id, err := jobs.NewJob(context.Background(), sleep(priority))
+		if err != nil {
+			t.Fatalf("NewJob() = %v", err)
+		}
+		ids = append(ids, id)
+	}
+	waitForState(t, database, ids[0], pb.State_RUNNING)
+	waitForState(t, database, ids[1], pb.State_RUNNING)
+
+	// priority 5 first, then the two priority 1 jobs in submission order
+	for id, want := range map[string]int{ids[0]: 0, ids[3]: 1, ids[2]: 2, ids[4]: 3} {
+		if got := jobs.QueuePosition(id); got != want {
+			t.Errorf("QueuePosition(%s) = %d, want %d", id, got, want)
+		}
+	}
+	exec, err := database.GetExecution(ids[2])
+	if err != nil || exec.Status != int32(pb.State_PENDING) {
+		t.Fatalf("queued job status = %+v, %v, want PENDING", exec, err)
+	}
+
+	// a stopped queued job never starts
+	if err := jobs.StopJob(context.Background(), ids[2]); err != nil {
+		t.Fatalf("StopJob() of a queued job = %v", err)
+	}
+	waitForState(t, database, ids[2], pb.State_STOPPED)
+	if got := jobs.QueuePosition(ids[4]); got != 2 {
+		t.Errorf("QueuePosition() after stop = %d, want 2", got)
+	}
+
+	// a finished job frees its slot for the highest priority job
+	if err := jobs.StopJob(context.Background(), ids[0]); err != nil {
+		t.Fatalf("StopJob() = %v", err)
+	}
+	waitForState(t, database, ids[3], pb.State_RUNNING)
+	if got := jobs.QueuePosition(ids[4]); got != 1 {
+		t.Errorf("QueuePosition() after a slot freed = %d, want 1", got)
+	}
+	for _, id := range ids {
+		jobs.StopJob(context.Background(), id)
+	}
+}
+
+func TestJobsPerOwnerLimit(t *testing.T) {
+	jobs, database := newTestJobs(t, config.JobsConfig{MaxJobsPerOwner: 1})
+	start := func(owner string) string {
+		id, err := jobs.NewJob(context.Background(), &pb.StartRequest{Command: "sleep", Args: []string{"30"}, Owner: owner})
+		if err != nil {
+			t.Fatalf("NewJob() = %v", err)
+		}
+		return id
+	}
+	alice1, alice2, bob := start("alice"), start("alice"), start("bob")
+	waitForState(t, database, alice1, pb.State_RUNNING)
+	waitForState(t, database, bob, pb.State_RUNNING)
+	if got := jobs.QueuePosition(alice2); got != 1 {
+		t.Errorf("QueuePosition() of the second job of an owner = %d, want 1", got)
+	}
+	if err := jobs.StopJob(context.Background(), alice1); err != nil {
+		t.Fatalf("StopJob() = %v", err)
+	}
+	waitForState(t, database, alice2, pb.State_RUNNING)
+	jobs.StopJob(context.Background(), alice2)
+	jobs.StopJob(context.Background(), bob)
+}
+
+// TestJobsSetConfig checks that raising the concurrency limit of a running
+// agent starts queued jobs without touching running ones.
+func TestJobsSetConfig(t *testing.T) {
+	jobs, database := newTestJobs(t, config.JobsConfig{MaxJobs: 1})
+	in := &pb.StartRequest{Command: "sleep", Args: []string{"30"}}
+	var ids []string
+	for range 2 {
+		id, err := jobs.NewJob(context.Background(), in)
+		if err != nil {
+			t.Fatalf("NewJob() = %v", err)
+		}
+		ids = append(ids, id)
+	}
+	waitForState(t, database, ids[0], pb.State_RUNNING)
+	if got := jobs.QueuePosition(ids[1]); got != 1 {
+		t.Fatalf("QueuePosition() = %d, want 1", got)
+	}
+	jobs.SetConfig(config.JobsConfig{MaxJobs: 2, OutputCompression: config.CompressionNone})
+	waitForState(t, database, ids[1], pb.State_RUNNING)
+	waitForState(t, database, ids[0], pb.State_RUNNING)
+	for _, id := range ids {
+		jobs.StopJob(context.Background(), id)
+	}
+}
+
+func TestJobsPolicy(t *testing.T) {
+	jobs, _ := newTestJobs(t, config.JobsConfig{})
+	jobs.SetPolicy(&policy.Policy{Allow: []string{"echo", "/bin/*"}, Deny: []string{"/bin/rm"}})
+	for _, tc := range []struct {
+		command string
+		allowed bool
+	}{
+		{"echo", true},
+		{"/usr/bin/echo", true},
+		{"/bin/true", true},
+		{"/bin/rm", false},
+		{"rm", false},
+		{"sleep", false},
+	} {
+		_, err := jobs.NewJob(context.Background(), &pb.StartRequest{Command: tc.command})
+		if (err == nil) != tc.allowed {
+			t.Errorf("NewJob(%s) = %v, want allowed %v", tc.command, err, tc.allowed)
+		}
+	}
+	jobs.SetPolicy(nil)
+	if _, err := jobs.NewJob(context.Background(), &pb.StartRequest{Command: "sleep", Args: []string{"0"}}); err != nil {
+		t.Errorf("NewJob() without a policy = %v", err)
+	}
+}
+
+// TestJobsShutdown checks that draining refuses new jobs, that jobs which
+// finish within the grace period complete and that the ones left are
+// stopped and recorded.
+func TestJobsShutdown(t *testing.T) {
+	jobs, database := newTestJobs(t, config.JobsConfig{MaxJobs: 1})
+	quick, err := jobs.NewJob(context.Background(), &pb.StartRequest{Command: "sleep", Args: []string{"0.2"}})
+	if err != nil {
+		t.Fatalf("NewJob() = %v", err)
+	}
+	slow, err := jobs.NewJob(context.Background(), &pb.StartRequest{Command: "sleep", Args: []string{"60"}})
+	if err != nil {
+		t.Fatalf("NewJob() = %v", err)
+	}
+	jobs.Drain()
+	if _, err := jobs.NewJob(context.Background(), &pb.StartRequest{Command: "true"}); !errors.Is(err, ErrDraining) {
+		t.Errorf("NewJob() while draining = %v, want %v", err, ErrDraining)
+	}
+	if running, pending := jobs.Counts(); running != 1 || pending != 1 {
+		t.Errorf("Counts() = %d, %d, want 1, 1", running, pending)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	jobs.Shutdown(ctx)
+	if running, pending := jobs.Counts(); running != 0 || pending != 0 {
+		t.Errorf("Counts() after Shutdown = %d, %d, want 0, 0", running, pending)
+	}
+	for id, state := range map[string]pb.State{quick: pb.State_COMPLETE, slow: pb.State_STOPPED} {
+		exec, err := database.GetExecution(id)
+		if err != nil {
+			t.Fatalf("GetExecution(%s) = %v", id, err)
+		}
+		if exec.Status != int32(state) {
+			t.Errorf("state of %s = %v, want %v", id, pb.State(exec.Status), state)
+		}
+	}
+}
+
+// TestJobSpan checks that a job's lifetime is a trace of its own linked to
+// the request that started it.
+func TestJobSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	jobs, database := newTestJobs(t, config.JobsConfig{})
+	ctx, request := provider.Tracer("test").Start(context.Background(), "Start")
+	id, err := jobs.NewJob(ctx, &pb.StartRequest{Command: "false"})
+	request.End()
+	if err != nil {
+		t.Fatalf("NewJob() = %v", err)
+	}
+	waitForState(t, database, id, pb.State_COMPLETE)
+
+	var span sdktrace.ReadOnlySpan
+	for deadline := time.Now().Add(5 * time.Second); span == nil && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		for _, s := range recorder.Ended() {
+			if s.Name() == "job" {
+				span = s
+			}
+		}
+	}
+	if span == nil {
+		t.Fatalf("no span of the job's lifetime ended")
+	}
+	if span.Parent().IsValid() || span.SpanContext().TraceID() == request.SpanContext().TraceID() {
+		t.Errorf("job span is part of the request's trace, want a trace of its own")
+	}
+	if links := span.Links(); len(links) != 1 || links[0].SpanContext.TraceID() != request.SpanContext().TraceID() {
+		t.Errorf("job span links = %v, want a span of the request's trace", links)
+	}
+	if span.Status().Code != codes.Error {
+		t.Errorf("status of the failed job's span = %v, want error", span.Status())
+	}
+}
+
+// TestJobLog checks that everything logged about a job has the fields of
+// the request that started it and no secrets from its arguments.
+func TestJobLog(t *testing.T) {
+	jobs, database := newTestJobs(t, config.JobsConfig{})
+	logger, hook := logtest.NewNullLogger()
+	ctx := logging.NewContext(context.Background(), logrus.NewEntry(logger).WithField("request_id", "req-1"))
+	id, err := jobs.NewJob(ctx, &pb.StartRequest{Command: "true", Args: []string{"--password", "hunter2", "TOKEN=hunter2"}})
+	if err != nil {
+		t.Fatalf("NewJob() = %v", err)
+	}
+	waitForState(t, database, id, pb.State_COMPLETE)
+
+	var finished bool
+	for deadline := time.Now().Add(5 * time.Second); !finished && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		for _, entry := range hook.AllEntries() {
+			finished = finished || strings.Contains(entry.Message, "finished")
+		}
+	}
+	entries := hook.AllEntries()
+	if !finished {
+		t.Fatalf("the job's end was not logged with the request's entry, got %d entries", len(entries))
+	}
+	for _, entry := range entries {
+		if entry.Data["request_id"] != "req-1" || entry.Data["job_id"] != id {
+			t.Errorf("entry %q has fields %v, want the request ID and job ID", entry.Message, entry.Data)
+		}
+		if line, _ := entry.String(); strings.Contains(line, "hunter2") {
+			t.Errorf("entry %s has a secret", line)
+		}
+	}
+}
+
+// TestScheduleRunOnce checks that a one-shot schedule whose time has passed
+// starts its job right away, is linked to it and does not run again.
+func TestScheduleRunOnce(t *testing.T) {
+	jobs, database := newTestJobs(t, config.JobsConfig{})
+	scheduler := NewScheduler(jobs, database, jobs.log)
+	if err := scheduler.Start(); err != nil {
+		t.Fatalf("Start() = %v", err)
+	}
+	defer scheduler.Stop()
+
+	schedule, err := scheduler.Add(&pb.ScheduleRequest{
+		Start: &pb.StartRequest{Command: "true"},
+		RunAt: time.Now().Add(-time.Minute).Unix(),
+	})
+	if err != nil {
+		t.Fatalf("Add() = %v", err)
+	}
+	var got *db.Schedule
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		got, err = database.GetSchedule(schedule.ID)
+		if err != nil {
+			t.Fatalf("GetSchedule() = %v", err)
+		}
+		if got.Finished {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !got.Finished || got.LastExecutionID == "" {
+		t.Fatalf("schedule = %+v, want a finished schedule with a job", got)
+	}
+	waitForState(t, database, got.LastExecutionID, pb.State_COMPLETE)
+	exec, err := database.GetExecution(got.LastExecutionID)
+	if err != nil {
+		t.Fatalf("GetExecution() = %v", err)
+	}
+	if exec.ScheduleID != schedule.ID {
+		t.Errorf("ScheduleID = %q, want %q", exec.ScheduleID, schedule.ID)
+	}
+	if next := scheduler.NextRun(*got); next != 0 {
+		t.Errorf("NextRun() = %d, want 0", next)
+	}
+
+	if _, err := scheduler.Add(&pb.ScheduleRequest{Start: &pb.StartRequest{Command: "true"}, Cron: "not cron"}); err == nil {
+		t.Errorf("Add() with an invalid cron expression succeeded")
+	}
+}
+
+// waitForWorkflow polls until the workflow finished and returns its status.
+func waitForWorkflow(t *testing.T, workflows *Workflows, id string) *pb.WorkflowStatusResponse {
+	t.Helper()
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		status, err := workflows.Status(id)
+		if err != nil {
+			t.Fatalf("Status(%s) = %v", id, err)
+		}
+		if status.State != pb.State_RUNNING {
+			return status
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("workflow %s did not finish", id)
+	return nil
+}
+
+func TestWorkflow(t *testing.T) {
+	jobs, database := newTestJobs(t, config.JobsConfig{})
+	workflows := NewWorkflows(jobs, database, jobs.log)
+	step := func(name, command string, deps ...string) *pb.WorkflowStep {
+		return &pb.WorkflowStep{Name: name, Start: &pb.StartRequest{Command: command}, DependsOn: deps}
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		id, err := workflows.Start(&pb.WorkflowRequest{Steps: []*pb.WorkflowStep{
+			step("a", "true"), step("b", "true", "a"), step("c", "true", "a", "b"),
+		}})
+		if err != nil {
+			t.Fatalf("Start() = %v", err)
+		}
+		status := waitForWorkflow(t, workflows, id)
+		if status.State != pb.State_COMPLETE {
+			t.Errorf("state = %s, want %s", status.State, pb.State_COMPLETE)
+		}
+		for _, s := range status.Steps {
+			if s.State != pb.State_COMPLETE || s.Id == "" {
+				t.Errorf("step %s = %+v, want completed", s.Name, s)
+			}
+		}
+	})
+
+	t.Run("Failure", func(t *testing.T) {
+		cleanup := step("cleanup", "true", "fail")
+		cleanup.Always = true
+		ignored := step("ignored", "false")
+		ignored.ContinueOnError = true
+		id, err := workflows.Start(&pb.WorkflowRequest{Steps: []*pb.WorkflowStep{
+			step("fail", "false"), step("skipped", "true", "fail"), cleanup,
+			ignored, step("after", "true", "ignored"),
+		}})
+		if err != nil {
+			t.Fatalf("Start() = %v", err)
+		}
+		status := waitForWorkflow(t, workflows, id)
+		if status.State != pb.State_ERROR {
+			t.Errorf("state = %s, want %s", status.State, pb.State_ERROR)
+		}
+		want := map[string]bool{"fail": true, "skipped": false, "cleanup": true, "ignored": true, "after": true}
+		for _, s := range status.Steps {
+			if ran := !s.Skipped; ran != want[s.Name] {
+				t.Errorf("step %s ran = %t, want %t", s.Name, ran, want[s.Name])
+			}
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		sleep := step("sleep", "sleep")
+		sleep.Start.Args = []string{"30"}
+		sleep.TimeoutSeconds = 1
+		id, err := workflows.Start(&pb.WorkflowRequest{Steps: []*pb.WorkflowStep{sleep}})
+		if err != nil {
+			t.Fatalf("Start() = %v", err)
+		}
+		status := waitForWorkflow(t, workflows, id)
+		if status.State != pb.State_ERROR || status.Steps[0].State != pb.State_STOPPED {
+			t.Errorf("status = %+v, want a stopped step", status)
+		}
+	})
+
+	t.Run("Stop", func(t *testing.T) {
+		sleep := step("sleep", "sleep")
+		sleep.Start.Args = []string{"30"}
+		id, err := workflows.Start(&pb.WorkflowRequest{Steps: []*pb.WorkflowStep{sleep, step("next", "true", "sleep")}})
+		if err != nil {
+			t.Fatalf("Start() = %v", err)
+		}
+		if err := workflows.Stop(id); err != nil {
+			t.Fatalf("Stop() = %v", err)
+		}
+		status := waitForWorkflow(t, workflows, id)
+		if status.State != pb.State_STOPPED || !status.Steps[1].Skipped {
+			t.Errorf("status = %+v, want stopped with the second step skipped", status)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for name, steps := range map[string][]*pb.WorkflowStep{
+			"empty":     nil,
+			"duplicate": {step("a", "true"), step("a", "true")},
+			"unknown":   {step("a", "true", "b")},
+			"cycle":     {step("a", "true", "c"), step("b", "true", "a"), step("c", "true", "b")},
+			"command":   {step("a", "")},
+		} {
+			if _, err := workflows.Start(&pb.WorkflowRequest{Steps: steps}); err == nil {
+				t.Errorf("Start() of %s workflow succeeded", name)
+			}
+		}
+	})
+}
+
+// TestWorkflowRecover checks that workflows left RUNNING by a previous run
+// of the agent are finished from their step executions on startup.
+func TestWorkflowRecover(t *testing.T) {
+	jobs, database := newTestJobs(t, config.JobsConfig{})
+	step := func(name string, deps ...string) *pb.WorkflowStep {
+		return &pb.WorkflowStep{Name: name, Start: &pb.StartRequest{Command: "true"}, DependsOn: deps}
+	}
+	// addWorkflow records a workflow of steps a, b and c, each depending on
+	// the one before, whose steps got to the given states
+	addWorkflow := func(state pb.State, steps ...pb.State) string {
+		req, err := protojson.Marshal(&pb.WorkflowRequest{Steps: []*pb.WorkflowStep{step("a"), step("b", "a"), step("c", "b")}})
+		if err != nil {
+			t.Fatalf("Marshal() = %v", err)
+		}
+		id := uuid.New().String()
+		if err := database.CreateWorkflow(db.Workflow{ID: id, Status: int32(state), Request: datatypes.JSON(req)}); err != nil {
+			t.Fatalf("CreateWorkflow() = %v", err)
+		}
+		for i, s := range steps {
+			exec := db.Execution{ID: uuid.New().String(), Status: int32(s), WorkflowID: id, Step: string(rune('a' + i)), Attempt: 1}
+			if err := database.CreateExecution(exec); err != nil {
+				t.Fatalf("CreateExecution() = %v", err)
+			}
+		}
+		return id
+	}
+	done := addWorkflow(pb.State_RUNNING, pb.State_COMPLETE, pb.State_COMPLETE, pb.State_COMPLETE)
+	interrupted := addWorkflow(pb.State_RUNNING, pb.State_COMPLETE, pb.State_RUNNING)
+	finished := addWorkflow(pb.State_STOPPED, pb.State_COMPLETE, pb.State_STOPPED)
+
+	if _, err := jobs.Recover(); err != nil {
+		t.Fatalf("Jobs.Recover() = %v", err)
+	}
+	workflows := NewWorkflows(jobs, database, jobs.log)
+	if err := workflows.Recover(); err != nil {
+		t.Fatalf("Recover() = %v", err)
+	}
+	for id, want := range map[string]struct {
+		state pb.State
+		steps []pb.State
+	}{
+		done:        {pb.State_COMPLETE, []pb.State{pb.State_COMPLETE, pb.State_COMPLETE, pb.State_COMPLETE}},
+		interrupted: {pb.State_ERROR, []pb.State{pb.State_COMPLETE, pb.State_ERROR, pb.State_UNKNOWN}},
+		finished:    {pb.State_STOPPED, []pb.State{pb.State_COMPLETE, pb.State_STOPPED, pb.State_UNKNOWN}},
+	} {
+		status, err := workflows.Status(id)
+		if err != nil {
+			t.Fatalf("Status() = %v", err)
+		}
+		if status.State != want.state {
+			t.Errorf("state of workflow %s = %s, want %s", id, status.State, want.state)
+		}
+		for i, s := range status.Steps {
+			if s.State != want.steps[i] {
+				t.Errorf("step %s of workflow %s = %s, want %s", s.Name, id, s.State, want.steps[i])
+			}
+		}
+	}
+	// recovering never starts the steps that did not run
+	execs, err := database.ListExecutions(db.ExecutionFilter{})
+	if err != nil {
+		t.Fatalf("ListExecutions() = %v", err)
+	}
+	if len(execs) != 7 {
+		t.Errorf("got %d jobs after Recover(), want the 7 recorded before", len(execs))
+	}
+}
+
+func TestRetry(t *testing.T) {
+	jobs, database := newTestJobs(t, config.JobsConfig{})
+
+	t.Run("Exhausted", func(t *testing.T) {
+		id, err := jobs.NewJob(context.Background(), &pb.StartRequest{Command: "false", Retry: &pb.RetryPolicy{MaxAttempts: 3, BackoffMs: 10}})
+		if err != nil {
+			t.Fatalf("NewJob() = %v", err)
+		}
+		var attempts []db.Execution
+		deadline := time.Now().Add(30 * time.Second)
+		for time.Now().Before(deadline) {
+			attempts, err = database.ListExecutions(db.ExecutionFilter{RetryOf: id})
+			if err != nil {
+				t.Fatalf("ListExecutions() = %v", err)
+			}
+			if len(attempts) == 2 {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if len(attempts) != 2 {
+			t.Fatalf("got %d retries, want 2", len(attempts))
+		}
+		for _, attempt := range attempts {
+			waitForState(t, database, attempt.ID, pb.State_COMPLETE)
+		}
+		time.Sleep(100 * time.Millisecond)
+		if attempts, _ := database.ListExecutions(db.ExecutionFilter{RetryOf: id}); len(attempts) != 2 {
+			t.Errorf("got %d retries after the last attempt, want 2", len(attempts))
+		}
+	})
+
+	t.Run("NotRetryable", func(t *testing.T) {
+		id, err := jobs.NewJob(context.Background(), &pb.StartRequest{Command: "false", Retry: &pb.RetryPolicy{MaxAttempts: 3, RetryableExitCodes: []int32{75}}})
+		if err != nil {
+			t.Fatalf("NewJob() = %v", err)
+		}
+		waitForState(t, database, id, pb.State_COMPLETE)
+		time.Sleep(100 * time.Millisecond)
+		if attempts, _ := database.ListExecutions(db.ExecutionFilter{RetryOf: id}); len(attempts) != 0 {
+			t.Errorf("exit code 1 was retried %d times, want 0", len(attempts))
+		}
+	})
+
+	t.Run("Stop", func(t *testing.T) {
+		id, err := jobs.NewJob(context.Background(), &pb.StartRequest{Command: "false", Retry: &pb.RetryPolicy{MaxAttempts: 3, BackoffMs: 60000}})
+		if err != nil {
+			t.Fatalf("NewJob() = %v", err)
+		}
+		var attempts []db.Execution
+		deadline := time.Now().Add(30 * time.Second)
+		for time.Now().Before(deadline) && len(attempts) == 0 {
+			attempts, _ = database.ListExecutions(db.ExecutionFilter{RetryOf: id})
+			time.Sleep(10 * time.Millisecond)
+		}
+		if len(attempts) != 1 {
+			t.Fatalf("got %d retries, want 1 waiting for its backoff", len(attempts))
+		}
+		if err := jobs.StopJob(context.Background(), id); err != nil {
+			t.Fatalf("StopJob() = %v", err)
+		}
+		waitForState(t, database, attempts[0].ID, pb.State_STOPPED)
+	})
+
+	t.Run("Backoff", func(t *testing.T) {
+		retry := &pb.RetryPolicy{BackoffMs: 100, MaxBackoffMs: 300, BackoffPolicy: pb.BackoffPolicy_BACKOFF_EXPONENTIAL}
+		for attempt, want := range []time.Duration{100, 200, 300, 300} {
+			if got := backoff(retry, int32(attempt+1)); got != want*time.Millisecond {
+				t.Errorf("backoff(%d) = %s, want %s", attempt+1, got, want*time.Millisecond)
+			}
+		}
+		retry.BackoffPolicy = pb.BackoffPolicy_BACKOFF_FIXED
+		if got := backoff(retry, 3); got != 100*time.Millisecond {
+			t.Errorf("fixed backoff(3) = %s, want 100ms", got)
+		}
+	})
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	jobs, _ := newTestJobs(t, config.JobsConfig{IdempotencyWindow: time.Hour})
+	in := &pb.StartRequest{Command: "true", Owner: "alice", IdempotencyKey: "key"}
+	ids := startJobs(t, jobs, 20, in)
+	for _, id := range ids {
+		if id != ids[0] {
+			t.Fatalf("NewJob() with the same key returned %s and %s", ids[0], id)
+		}
+	}
+
+	other, err := jobs.NewJob(context.Background(), &pb.StartRequest{Command: "true", Owner: "bob", IdempotencyKey: "key"})
+	if err != nil {
+		t.Fatalf("NewJob() = %v", err)
+	}
+	if other == ids[0] {
+		t.Errorf("NewJob() of another owner returned the job of the key's owner")
+	}
+	unkeyed, err := jobs.NewJob(context.Background(), &pb.StartRequest{Command: "true", Owner: "alice"})
+	if err != nil {
+		t.Fatalf("NewJob() = %v", err)
+	}
+	if unkeyed == ids[0] {
+		t.Errorf("NewJob() without a key returned an existing job")
+	}
+}
+
+// TestSecretArgs checks that the process gets its arguments as they are
+// while the database only has them with the secrets masked.
+func TestSecretArgs(t *testing.T) {
+	jobs, database := newTestJobs(t, config.JobsConfig{})
+	redactor, err := redact.New(config.RedactConfig{Patterns: []string{`^-p(.+)`}})
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	jobs.SetRedactor(redactor)
+	if _, err := jobs.NewJob(context.Background(), &pb.StartRequest{Command: "echo", Args: []string{"x"}, SecretArgs: []int32{1}}); err == nil {
+		t.Errorf("NewJob() with a secret argument that does not exist succeeded")
+	}
+
+	id, err := jobs.NewJob(context.Background(), &pb.StartRequest{
+		Command:    "echo",
+		Args:       []string{"-pswordfish", "visible", "hunter2"},
+		SecretArgs: []int32{2},
+	})
+	if err != nil {
+		t.Fatalf("NewJob() = %v", err)
+	}
+	waitForState(t, database, id, pb.State_COMPLETE)
+	exec, err := database.GetExecution(id)
+	if err != nil {
+		t.Fatalf("GetExecution() = %v", err)
+	}
+	if got, want := string(exec.Args), `["-p***","visible","***"]`; got != want {
+		t.Errorf("stored args = %s, want %s", got, want)
+	}
+	r, err := output.OpenOutput(jobs.store, id, exec.Compression, 0)
+	if err != nil {
+		t.Fatalf("OpenOutput() = %v", err)
+	}
+	defer r.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll() = %v", err)
+	}
+	if got, want := string(out), "-pswordfish visible hunter2\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestRingBuffer(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{"Partial", []string{"ab", "c"}, "abc"},
+		{"Full", []string{"ab", "cd"}, "abcd"},
+		{"Wrap", []string{"abc", "de"}, "bcde"},
+		{"WrapAtBoundary", []string{"abcd", "efgh"}, "efgh"},
+		{"WrapByteByByte", []string{"a", "b", "c", "d", "e", "f"}, "cdef"},
+		{"LargeWrite", []string{"ab", "abcdefghij"}, "ghij"},
+		{"WrapAfterLargeWrite", []string{"abc", "defgh", "ij"}, "ghij"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newRingBuffer(4)
+			for _, w := range tc.writes {
+				r.Write([]byte(w))
+				if len(r.buf) > r.size {
+					t.Fatalf("buffer grew to %d bytes, want at most %d", len(r.buf), r.size)
+				}
+			}
+			if got := string(r.Bytes()); got != tc.want {
+				t.Errorf("Bytes() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestOutputLimit(t *testing.T) {
+	// seq 1 n prints the numbers 1 to n, one per line
+	seq := func(n int) string {
+		var b strings.Builder
+		for i := 1; i <= n; i++ {
+			fmt.Fprintf(&b, "%d\n", i)
+		}
+		return b.String()
+	}
+	for _, tc := range []struct {
+		name        string
+		n           int
+		mode        pb.OutputLimitMode
+		compression string
+		state       pb.State
+		want        string
+	}{
+		{"Under", 10, pb.OutputLimitMode_LIMIT_RING, config.CompressionNone, pb.State_COMPLETE, seq(10)},
+		{"Kill", 10000, pb.OutputLimitMode_LIMIT_KILL, config.CompressionNone, pb.State_STOPPED, seq(10000)[:100]},
+		// 37 numbers are 102 bytes, the ring only holds the last 2
+		{"RingJustOver", 37, pb.OutputLimitMode_LIMIT_RING, config.CompressionNone, pb.State_COMPLETE, seq(37)[2:]},
+		{"Ring", 10000, pb.OutputLimitMode_LIMIT_RING, config.CompressionNone, pb.State_COMPLETE, seq(10000)[len(seq(10000))-100:]},
+		{"RingCompressed", 10000, pb.OutputLimitMode_LIMIT_RING, config.CompressionZstd, pb.State_COMPLETE, seq(10000)[len(seq(10000))-100:]},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			jobs, database := newTestJobs(t, config.JobsConfig{})
+			jobs.SetConfig(config.JobsConfig{OutputCompression: tc.compression})
+			// the job keeps running after its output so kill mode has to stop it
+			script := fmt.Sprintf("seq 1 %d; [ %s = LIMIT_KILL ] && sleep 30; true", tc.n, tc.mode)
+			id, err := jobs.NewJob(context.Background(), &pb.StartRequest{
+				Command:         "sh",
+				Args:            []string{"-c", script},
+				OutputLimit:     100,
+				OutputLimitMode: tc.mode,
+			})
+			if err != nil {
+				t.Fatalf("NewJob() = %v", err)
+			}
+			waitForState(t, database, id, tc.state)
+			exec, err := database.GetExecution(id)
+			if err != nil {
+				t.Fatalf("GetExecution() = %v", err)
+			}
+			if truncated := tc.want != seq(tc.n); exec.Truncated != truncated || exec.OutputSize == 0 {
+				t.Errorf("Truncated = %v with output size %d, want %v", exec.Truncated, exec.OutputSize, truncated)
+			}
+			r, err := output.OpenOutput(jobs.store, id, exec.Compression, 0)
+			if err != nil {
+				t.Fatalf("OpenOutput() = %v", err)
+			}
+			defer r.Close()
+			out, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("ReadAll() = %v", err)
+			}
+			if string(out) != tc.want {
+				t.Errorf("output = %q, want %q", out, tc.want)
+			}
+		})
+	}
+}
+
+// TestSecretArgsNotStored checks that schedules and workflows, which keep
+// their requests in the database, refuse commands with secrets.
+func TestSecretArgsNotStored(t *testing.T) {
+	jobs, database := newTestJobs(t, config.JobsConfig{})
+	redactor, err := redact.New(config.RedactConfig{Patterns: []string{`^-p(.+)`}})
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	jobs.SetRedactor(redactor)
+	scheduler := NewScheduler(jobs, database, jobs.log)
+	workflows := NewWorkflows(jobs, database, jobs.log)
+
+	for name, start := range map[string]*pb.StartRequest{
+		"marked secret": {Command: "mysql", Args: []string{"hunter2"}, SecretArgs: []int32{0}},
+		"secret flag":   {Command: "mysql", Args: []string{"--password", "hunter2"}},
+		"redacted":      {Command: "mysql", Args: []string{"-phunter2"}},
+	} {
+		if _, err := scheduler.Add(&pb.ScheduleRequest{Cron: "@hourly", Start: start}); err == nil {
+			t.Errorf("Add() of a schedule with a %s argument succeeded", name)
+		}
+		steps := []*pb.WorkflowStep{{Name: "plain", Start: &pb.StartRequest{Command: "true"}}, {Name: "secret", Start: start}}
+		if _, err := workflows.Start(&pb.WorkflowRequest{Steps: steps}); err == nil {
+			t.Errorf("Start() of a workflow with a %s argument succeeded", name)
+		}
+	}
+	if _, err := scheduler.Add(&pb.ScheduleRequest{Cron: "@hourly", Start: &pb.StartRequest{Command: "mysql", Args: []string{"-u", "admin"}}}); err != nil {
+		t.Errorf("Add() of a schedule without secrets = %v", err)
+	}
+
+	schedules, err := database.ListSchedules()
+	if err != nil {
+		t.Fatalf("ListSchedules() = %v", err)
+	}
+	if len(schedules) != 1 {
+		t.Errorf("got %d schedules, want only the one without secrets", len(schedules))
+	}
+	for _, schedule := range schedules {
+		if strings.Contains(string(schedule.Request), "hunter2") {
+			t.Errorf("schedule %s stored the secret: %s", schedule.ID, schedule.Request)
+		}
+	}
+	for _, state := range []pb.State{pb.State_RUNNING, pb.State_COMPLETE, pb.State_ERROR} {
+		stored, err := database.ListWorkflows(int32(state))
+		if err != nil {
+			t.Fatalf("ListWorkflows() = %v", err)
+		}
+		for _, workflow := range stored {
+			if strings.Contains(string(workflow.Request), "hunter2") {
+				t.Errorf("workflow %s stored the secret: %s", workflow.ID, workflow.Request)
+			}
+		}
+	}
+	execs, err := database.ListExecutions(db.ExecutionFilter{})
+	if err != nil {
+		t.Fatalf("ListExecutions() = %v", err)
+	}
+	if len(execs) != 0 {
+		t.Errorf("refused workflows started %d jobs", len(execs))
+	}
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/stewyb314/remote-control/internal/config"
+	pb "github.com/stewyb314/remote-control/protos"
+)
+
+// limitWriter enforces a job's output limit. The first limit bytes are
+// stored as they are written. After that the job is either killed, or the
+// rest of the output goes to a ring buffer and only the last limit bytes
+// are kept once the job finishes.
+type limitWriter struct {
+	out       *countingWriter
+	limit     int64
+	mode      pb.OutputLimitMode
+	kill      func()
+	written   int64
+	truncated bool
+	ring      *ringBuffer
+}
+
+// outputLimit returns the limit and mode for a job. The agent's limit is
+// the default and an upper bound for the requested one.
+func outputLimit(conf config.JobsConfig, in *pb.StartRequest) (int64, pb.OutputLimitMode) {
+	limit := conf.OutputLimit
+	if in.OutputLimit > 0 && (limit <= 0 || in.OutputLimit < limit) {
+		limit = in.OutputLimit
+	}
+	mode := in.OutputLimitMode
+	if mode == pb.OutputLimitMode_LIMIT_DEFAULT {
+		mode = pb.OutputLimitMode_LIMIT_RING
+		if conf.OutputLimitMode == config.OutputLimitKill {
+			mode = pb.OutputLimitMode_LIMIT_KILL
+		}
+	}
+	return limit, mode
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if l.limit <= 0 {
+		return l.out.Write(p)
+	}
+	if room := l.limit - l.written; room > 0 {
+		k := min(int64(len(p)), room)
+		if _, err := l.out.Write(p[:k]); err != nil {
+			return 0, err
+		}
+		l.written += k
+		p = p[k:]
+	}
+	if len(p) == 0 {
+		return n, nil
+	}
+
+	if !l.truncated {
+		l.truncated = true
+		if l.mode == pb.OutputLimitMode_LIMIT_KILL {
+			l.kill()
+		} else {
+			l.ring = newRingBuffer(int(l.limit))
+		}
+	}
+	// output past the limit is dropped in kill mode rather than returning
+	// an error, which would make the job fail on a broken pipe instead
+	if l.ring != nil {
+		l.ring.Write(p)
+	}
+	l.written += int64(len(p))
+	return n, nil
+}
+
+func (l *limitWriter) Close() error {
+	return l.out.Close()
+}
+
+// ringBuffer keeps the last size bytes written to it. It only grows as
+// output arrives, a job just over its limit does not hold a buffer of the
+// full limit.
+type ringBuffer struct {
+	buf  []byte
+	size int
+	// next is the position of the oldest byte once buf holds size bytes
+	next int
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{size: size}
+}
+
+func (r *ringBuffer) Write(p []byte) {
+	if len(p) >= r.size {
+		r.buf = append(r.buf[:0], p[len(p)-r.size:]...)
+		r.next = 0
+		return
+	}
+	if room := r.size - len(r.buf); room > 0 {
+		k := min(room, len(p))
+		r.buf = append(r.buf, p[:k]...)
+		p = p[k:]
+	}
+	for len(p) > 0 {
+		n := copy(r.buf[r.next:], p)
+		p = p[n:]
+		r.next = (r.next + n) % r.size
+	}
+}
+
+// Bytes returns the buffered bytes, oldest first.
+func (r *ringBuffer) Bytes() []byte {
+	return append(r.buf[r.next:len(r.buf):len(r.buf)], r.buf[:r.next]...)
+}
+
+// keptTail returns the last limit bytes of the output of a job that
+// overflowed in ring mode. The stored output holds the first limit bytes,
+// the ring the most recent ones.
+func (j *Jobs) keptTail(id string, output *limitWriter) ([]byte, error) {
+	tail := output.ring.Bytes()
+	missing := output.limit - int64(len(tail))
+	if missing <= 0 {
+		return tail, nil
+	}
+	r, err := j.store.Open(id, output.limit-missing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open output: %v", err)
+	}
+	defer r.Close()
+	head, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read output: %v", err)
+	}
+	return append(head, tail...), nil
+}
+
+// replaceOutput stores data as the output of a job. It is only called once
+// the job is recorded as finished, readers following it while it ran have
+// stopped at the first limit bytes by then.
+func (j *Jobs) replaceOutput(id string, data []byte) error {
+	if err := j.store.Delete(id); err != nil {
+		return fmt.Errorf("failed to delete output: %v", err)
+	}
+	w, err := j.store.Create(id)
+	if err != nil {
+		return fmt.Errorf("failed to create output: %v", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return fmt.Errorf("failed to write output: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to close output: %v", err)
+	}
+	return nil
+}
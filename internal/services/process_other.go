@@ -0,0 +1,9 @@
+//go:build !unix
+
+package services
+
+import "os/exec"
+
+// killProcessGroup is a no-op where process groups are not supported,
+// stopping a command only kills the command itself.
+func killProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"slices"
+	"sort"
+
+	"github.com/stewyb314/remote-control/internal/config"
+)
+
+// schedule starts queued jobs for as long as the concurrency limits allow.
+func (j *Jobs) schedule() {
+	for {
+		j.mu.Lock()
+		jb := j.nextJob()
+		if jb == nil {
+			j.mu.Unlock()
+			return
+		}
+		j.dequeue(jb)
+		if err := jb.transition(jobStarting); err != nil {
+			j.log.Errorf("Failed to start queued job: %v", err)
+		}
+		j.mu.Unlock()
+		j.startJob(jb)
+	}
+}
+
+// nextJob returns the queued job to start next, or nil when the queue is
+// empty or no slot is free for any queued job. j.mu must be held.
+func (j *Jobs) nextJob() *job {
+	running := 0
+	perOwner := make(map[string]int)
+	for _, jb := range j.jobs {
+		if jb.active() {
+			running++
+			perOwner[jb.owner]++
+		}
+	}
+	if j.conf.MaxJobs > 0 && running >= j.conf.MaxJobs {
+		return nil
+	}
+	for _, jb := range j.orderedQueue() {
+		if j.conf.MaxJobsPerOwner <= 0 || perOwner[jb.owner] < j.conf.MaxJobsPerOwner {
+			return jb
+		}
+	}
+	return nil
+}
+
+// orderedQueue returns the queued jobs in the order they are started in,
+// by submission or by descending priority. j.mu must be held.
+func (j *Jobs) orderedQueue() []*job {
+	queue := slices.Clone(j.queue)
+	if j.conf.QueueOrder == config.QueuePriority {
+		// the queue is in submission order, a stable sort keeps jobs of
+		// the same priority first in, first out
+		sort.SliceStable(queue, func(a, b int) bool {
+			return queue[a].priority > queue[b].priority
+		})
+	}
+	return queue
+}
+
+// dequeue takes a job out of the queue. j.mu must be held.
+func (j *Jobs) dequeue(jb *job) {
+	j.queue = slices.DeleteFunc(j.queue, func(q *job) bool { return q == jb })
+}
+
+// QueueLength returns the number of jobs waiting for a free slot.
+func (j *Jobs) QueueLength() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return len(j.queue)
+}
+
+// QueuePosition returns the position of a job in the queue starting at 1,
+// or 0 when the job is not queued.
+func (j *Jobs) QueuePosition(id string) int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for i, jb := range j.orderedQueue() {
+		if jb.id == id {
+			return i + 1
+		}
+	}
+	return 0
+}
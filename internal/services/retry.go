@@ -0,0 +1,110 @@
+package services
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	pb "github.com/stewyb314/remote-control/protos"
+)
+
+// maxAttempts caps the attempts a start request can ask for
+const maxAttempts = 100
+
+func validateRetry(retry *pb.RetryPolicy) error {
+	if retry == nil {
+		return nil
+	}
+	if retry.MaxAttempts < 0 || retry.MaxAttempts > maxAttempts {
+		return fmt.Errorf("max attempts must be between 0 and %d", maxAttempts)
+	}
+	if retry.BackoffMs < 0 || retry.MaxBackoffMs < 0 {
+		return fmt.Errorf("backoff must not be negative")
+	}
+	return nil
+}
+
+// retryable reports whether an attempt that finished with done is retried
+// under retry. Only commands that ran to completion with a retryable exit
+// code are, commands that were stopped or failed to start are not.
+func retryable(retry *pb.RetryPolicy, attempt int32, done JobDone) bool {
+	if retry == nil || attempt >= retry.MaxAttempts {
+		return false
+	}
+	if done.status != int32(pb.State_COMPLETE) || done.ExitCode == 0 {
+		return false
+	}
+	return len(retry.RetryableExitCodes) == 0 || slices.Contains(retry.RetryableExitCodes, done.ExitCode)
+}
+
+// backoff returns how long to wait before retrying a job after attempt.
+func backoff(retry *pb.RetryPolicy, attempt int32) time.Duration {
+	wait := time.Duration(retry.BackoffMs) * time.Millisecond
+	limit := time.Duration(retry.MaxBackoffMs) * time.Millisecond
+	if retry.BackoffPolicy == pb.BackoffPolicy_BACKOFF_EXPONENTIAL {
+		for i := int32(1); i < attempt; i++ {
+			wait *= 2
+			if limit > 0 && wait >= limit {
+				break
+			}
+		}
+	}
+	if limit > 0 && wait > limit {
+		wait = limit
+	}
+	return wait
+}
+
+// retry queues the next attempt of a job whose attempt finished with done,
+// if its retry policy asks for one. It reports whether it did.
+func (j *Jobs) retry(jb *job, done JobDone) bool {
+	attempt := max(jb.opts.attempt, 1)
+	if !retryable(jb.req.Retry, attempt, done) {
+		j.finishAttempts(jb)
+		return false
+	}
+	// the job was stopped after its process exited on its own
+	if jb.ctx.Err() != nil {
+		j.finishAttempts(jb)
+		return false
+	}
+	first := jb.id
+	if jb.opts.retryOf != "" {
+		first = jb.opts.retryOf
+	}
+	opts := jb.opts
+	opts.attempt = attempt + 1
+	opts.retryOf = first
+	// the key maps to the first attempt only
+	opts.idempotencyKey = ""
+	opts.delay = backoff(jb.req.Retry, attempt)
+	jb.log.Infof("Job %s failed with exit code %d, retrying attempt %d of %d in %s", first, done.ExitCode, opts.attempt, jb.req.Retry.MaxAttempts, opts.delay)
+	// the next attempt's span is linked to this one's
+	id, err := j.newJob(jb.traceCtx, jb.req, opts)
+	if err != nil {
+		jb.log.Errorf("Failed to retry job %s: %v", first, err)
+		j.finishAttempts(jb)
+		return false
+	}
+	j.mu.Lock()
+	j.attempts[first] = id
+	stopped := jb.ctx.Err() != nil
+	j.mu.Unlock()
+	// a stop that raced with the retry targeted the finished attempt
+	if stopped {
+		if err := j.StopJob(jb.traceCtx, id); err != nil {
+			jb.log.Errorf("Failed to stop job %s: %v", id, err)
+		}
+	}
+	return true
+}
+
+// finishAttempts forgets the attempts of a job whose last attempt finished.
+func (j *Jobs) finishAttempts(jb *job) {
+	if jb.opts.retryOf == "" {
+		return
+	}
+	j.mu.Lock()
+	delete(j.attempts, jb.opts.retryOf)
+	j.mu.Unlock()
+}
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+	"github.com/sirupsen/logrus"
+	"github.com/stewyb314/remote-control/internal/db"
+	pb "github.com/stewyb314/remote-control/protos"
+	"google.golang.org/protobuf/encoding/protojson"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Scheduler starts jobs from the schedules kept in the database, either on
+// every match of a cron expression or once at a given time. Schedules
+// survive restarts, a one-shot schedule whose time passed while the agent
+// was down runs as soon as the scheduler starts.
+type Scheduler struct {
+	jobs *Jobs
+	db   db.DB
+	log  *logrus.Entry
+	cron *cron.Cron
+
+	mu      sync.Mutex
+	entries map[string]cron.EntryID
+	timers  map[string]*time.Timer
+}
+
+func NewScheduler(jobs *Jobs, db db.DB, log *logrus.Entry) *Scheduler {
+	return &Scheduler{
+		jobs:    jobs,
+		db:      db,
+		log:     log,
+		cron:    cron.New(),
+		entries: make(map[string]cron.EntryID),
+		timers:  make(map[string]*time.Timer),
+	}
+}
+
+// Start registers the stored schedules that have not finished and starts
+// running them.
+func (s *Scheduler) Start() error {
+	schedules, err := s.db.ListSchedules()
+	if err != nil {
+		return fmt.Errorf("failed to list schedules: %v", err)
+	}
+	for _, schedule := range schedules {
+		if schedule.Finished {
+			continue
+		}
+		if err := s.register(schedule); err != nil {
+			s.log.Errorf("Failed to register schedule %s: %v", schedule.ID, err)
+		}
+	}
+	s.cron.Start()
+	return nil
+}
+
+// Stop stops starting new jobs. Jobs already started keep running.
+func (s *Scheduler) Stop() {
+	s.cron.Stop()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, timer := range s.timers {
+		timer.Stop()
+		delete(s.timers, id)
+	}
+}
+
+// Add stores a new schedule and registers it.
+func (s *Scheduler) Add(in *pb.ScheduleRequest) (*db.Schedule, error) {
+	if in.Start == nil || in.Start.Command == "" {
+		return nil, fmt.Errorf("schedule needs a command")
+	}
+	if err := s.jobs.checkNoSecrets(in.Start); err != nil {
+		return nil, fmt.Errorf("invalid schedule: %v", err)
+	}
+	if (in.Cron == "") == (in.RunAt == 0) {
+		return nil, fmt.Errorf("schedule needs either a cron expression or a run time")
+	}
+	if in.Cron != "" {
+		if _, err := cron.ParseStandard(in.Cron); err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %v", in.Cron, err)
+		}
+	}
+	req, err := protojson.Marshal(in.Start)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal start request: %v", err)
+	}
+	schedule := db.Schedule{
+		ID:      uuid.New().String(),
+		Cron:    in.Cron,
+		RunAt:   in.RunAt,
+		Request: datatypes.JSON(req),
+	}
+	if err := s.db.CreateSchedule(schedule); err != nil {
+		return nil, fmt.Errorf("failed to create schedule: %v", err)
+	}
+	if err := s.register(schedule); err != nil {
+		if err := s.db.DeleteSchedule(schedule.ID); err != nil {
+			s.log.Errorf("Failed to delete schedule %s: %v", schedule.ID, err)
+		}
+		return nil, err
+	}
+	s.log.Infof("Created schedule %s for %s", schedule.ID, in.Start.Command)
+	return &schedule, nil
+}
+
+// List returns all schedules, including finished one-shot schedules.
+func (s *Scheduler) List() ([]*pb.ScheduleInfo, error) {
+	schedules, err := s.db.ListSchedules()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list schedules: %v", err)
+	}
+	infos := make([]*pb.ScheduleInfo, 0, len(schedules))
+	for _, schedule := range schedules {
+		var req pb.StartRequest
+		if err := protojson.Unmarshal(schedule.Request, &req); err != nil {
+			s.log.Errorf("Failed to unmarshal request of schedule %s: %v", schedule.ID, err)
+		}
+		infos = append(infos, &pb.ScheduleInfo{
+			Id:      schedule.ID,
+			Cmd:     req.Command,
+			Args:    s.jobs.RedactArgs(&req),
+			Cron:    schedule.Cron,
+			RunAt:   schedule.RunAt,
+			NextRun: s.NextRun(schedule),
+			LastRun: schedule.LastRunAt,
+			LastId:  schedule.LastExecutionID,
+		})
+	}
+	return infos, nil
+}
+
+// Delete unregisters a schedule and removes it from the database. Jobs it
+// already started are kept.
+func (s *Scheduler) Delete(id string) error {
+	s.unregister(id)
+	if err := s.db.DeleteSchedule(id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("no schedule found with ID %s", id)
+		}
+		return fmt.Errorf("failed to delete schedule %s: %v", id, err)
+	}
+	s.log.Infof("Deleted schedule %s", id)
+	return nil
+}
+
+// NextRun returns the unix time the schedule runs next, 0 if it will not
+// run again.
+func (s *Scheduler) NextRun(schedule db.Schedule) int64 {
+	if schedule.Finished {
+		return 0
+	}
+	if schedule.Cron == "" {
+		return max(schedule.RunAt, time.Now().Unix())
+	}
+	spec, err := cron.ParseStandard(schedule.Cron)
+	if err != nil {
+		return 0
+	}
+	return spec.Next(time.Now()).Unix()
+}
+
+func (s *Scheduler) register(schedule db.Schedule) error {
+	id := schedule.ID
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if schedule.Cron == "" {
+		wait := time.Until(time.Unix(schedule.RunAt, 0))
+		s.timers[id] = time.AfterFunc(wait, func() { s.fire(id) })
+		return nil
+	}
+	entry, err := s.cron.AddFunc(schedule.Cron, func() { s.fire(id) })
+	if err != nil {
+		return fmt.Errorf("invalid cron expression %q: %v", schedule.Cron, err)
+	}
+	s.entries[id] = entry
+	return nil
+}
+
+func (s *Scheduler) unregister(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry, ok := s.entries[id]; ok {
+		s.cron.Remove(entry)
+		delete(s.entries, id)
+	}
+	if timer, ok := s.timers[id]; ok {
+		timer.Stop()
+		delete(s.timers, id)
+	}
+}
+
+// fire starts a job for the schedule id and records the run.
+func (s *Scheduler) fire(id string) {
+	schedule, err := s.db.GetSchedule(id)
+	if err != nil {
+		// deleted while it was firing
+		s.log.Errorf("Failed to get schedule %s: %v", id, err)
+		s.unregister(id)
+		return
+	}
+	var req pb.StartRequest
+	if err := protojson.Unmarshal(schedule.Request, &req); err != nil {
+		s.log.Errorf("Failed to unmarshal request of schedule %s: %v", id, err)
+		return
+	}
+	jobID, err := s.jobs.newJob(context.Background(), &req, jobOptions{scheduleID: id})
+	if err != nil {
+		s.log.Errorf("Failed to start job for schedule %s: %v", id, err)
+	} else {
+		s.log.Infof("Schedule %s started job %s", id, jobID)
+		schedule.LastExecutionID = jobID
+	}
+	schedule.LastRunAt = time.Now().Unix()
+	if schedule.Cron == "" {
+		schedule.Finished = true
+		s.unregister(id)
+	}
+	if err := s.db.UpdateSchedule(*schedule); err != nil {
+		s.log.Errorf("Failed to update schedule %s: %v", id, err)
+	}
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrDraining is returned for jobs started while the agent drains.
+var ErrDraining = errors.New("the agent is draining and does not accept new jobs")
+
+const (
+	// shutdownPollInterval is how often Shutdown checks for running jobs
+	shutdownPollInterval = 100 * time.Millisecond
+	// stopTimeout bounds the wait for stopped jobs to be recorded
+	stopTimeout = 30 * time.Second
+)
+
+// Drain makes the registry refuse new jobs with ErrDraining. Jobs that
+// were already accepted, queued ones and retries included, keep running.
+func (j *Jobs) Drain() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if !j.draining {
+		j.log.Infof("Draining, new jobs are refused")
+	}
+	j.draining = true
+}
+
+// Draining reports whether the registry refuses new jobs.
+func (j *Jobs) Draining() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.draining
+}
+
+// Counts returns the number of running jobs and of jobs waiting to start.
+func (j *Jobs) Counts() (running, pending int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, jb := range j.jobs {
+		if jb.active() {
+			running++
+		} else {
+			pending++
+		}
+	}
+	return running, pending
+}
+
+// Shutdown drains the registry and waits for the jobs to finish until ctx
+// is done. The jobs left are stopped then. It returns once the final state
+// of every job is recorded and its output closed.
+func (j *Jobs) Shutdown(ctx context.Context) {
+	j.Drain()
+	if j.wait(ctx) {
+		return
+	}
+	running, pending := j.Counts()
+	j.log.Warnf("Stopping %d running and %d pending jobs left after the shutdown grace period", running, pending)
+	j.mu.Lock()
+	ids := make([]string, 0, len(j.jobs))
+	for id := range j.jobs {
+		ids = append(ids, id)
+	}
+	j.mu.Unlock()
+	for _, id := range ids {
+		if err := j.StopJob(context.Background(), id); err != nil {
+			j.log.Errorf("Failed to stop job %s: %v", id, err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), stopTimeout)
+	defer cancel()
+	if !j.wait(ctx) {
+		running, pending := j.Counts()
+		j.log.Errorf("%d running and %d pending jobs did not stop in time", running, pending)
+	}
+}
+
+// wait polls until no job is left or ctx is done and reports whether all
+// jobs finished.
+func (j *Jobs) wait(ctx context.Context) bool {
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		j.mu.Lock()
+		n := len(j.jobs)
+		j.mu.Unlock()
+		if n == 0 {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+}
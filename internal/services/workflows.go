@@ -0,0 +1,408 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stewyb314/remote-control/internal/db"
+	pb "github.com/stewyb314/remote-control/protos"
+	"google.golang.org/protobuf/encoding/protojson"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Workflows runs workflows, sets of steps that each start a job once the
+// steps they depend on finished. A step runs when all its dependencies
+// succeeded, or once they finished at all when it is marked always, and is
+// skipped otherwise. The workflow record is RUNNING until every step
+// finished or was skipped and then rolls up the result of its steps.
+type Workflows struct {
+	jobs *Jobs
+	db   db.DB
+	log  *logrus.Entry
+
+	mu   sync.Mutex
+	runs map[string]*workflowRun
+}
+
+// workflowRun is a workflow with steps left to run.
+type workflowRun struct {
+	id      string
+	steps   []*pb.WorkflowStep
+	results []stepResult
+	stopped bool
+	// interrupted is set for a workflow the agent was running when it
+	// exited, its steps that did not start are skipped
+	interrupted bool
+}
+
+type stepResult struct {
+	started bool
+	// jobID is the job of a started step, empty if it failed to start
+	jobID   string
+	done    bool
+	ok      bool
+	skipped bool
+}
+
+func NewWorkflows(jobs *Jobs, db db.DB, log *logrus.Entry) *Workflows {
+	return &Workflows{
+		jobs: jobs,
+		db:   db,
+		log:  log,
+		runs: make(map[string]*workflowRun),
+	}
+}
+
+// Start checks the workflow, records it and starts the steps without
+// dependencies.
+func (w *Workflows) Start(in *pb.WorkflowRequest) (string, error) {
+	if err := validateWorkflow(in); err != nil {
+		return "", fmt.Errorf("invalid workflow: %v", err)
+	}
+	for _, step := range in.Steps {
+		if err := w.jobs.checkNoSecrets(step.Start); err != nil {
+			return "", fmt.Errorf("invalid workflow: step %s: %v", step.Name, err)
+		}
+	}
+	req, err := protojson.Marshal(in)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal workflow request: %v", err)
+	}
+	workflow := db.Workflow{
+		ID:      uuid.New().String(),
+		Name:    in.Name,
+		Status:  int32(pb.State_RUNNING),
+		Request: datatypes.JSON(req),
+	}
+	if err := w.db.CreateWorkflow(workflow); err != nil {
+		return "", fmt.Errorf("failed to create workflow: %v", err)
+	}
+	run := &workflowRun{
+		id:      workflow.ID,
+		steps:   in.Steps,
+		results: make([]stepResult, len(in.Steps)),
+	}
+	w.log.Infof("Starting workflow %s %q with %d steps", run.id, in.Name, len(in.Steps))
+	w.mu.Lock()
+	w.runs[run.id] = run
+	w.advance(run)
+	w.mu.Unlock()
+	return run.id, nil
+}
+
+// Recover finishes the workflows a previous run of the agent left RUNNING.
+// Their steps no longer run: a step that was still running has been
+// marked failed by Jobs.Recover and steps that had not started are skipped,
+// so each workflow rolls up the result of the steps that did run. It is
+// called once on startup after Jobs.Recover, before any workflow is
+// started.
+func (w *Workflows) Recover() error {
+	workflows, err := w.db.ListWorkflows(int32(pb.State_RUNNING))
+	if err != nil {
+		return fmt.Errorf("failed to list running workflows: %v", err)
+	}
+	for _, workflow := range workflows {
+		if err := w.recover(workflow); err != nil {
+			return fmt.Errorf("failed to recover workflow %s: %v", workflow.ID, err)
+		}
+	}
+	return nil
+}
+
+// recover rebuilds the run of a workflow from its step executions and
+// finishes it.
+func (w *Workflows) recover(workflow db.Workflow) error {
+	var req pb.WorkflowRequest
+	if err := protojson.Unmarshal(workflow.Request, &req); err != nil {
+		w.log.Errorf("Failed to unmarshal request of workflow %s, marking it failed: %v", workflow.ID, err)
+		workflow.Status = int32(pb.State_ERROR)
+		return w.db.UpdateWorkflow(workflow)
+	}
+	execs, err := w.db.ListExecutions(db.ExecutionFilter{WorkflowID: workflow.ID})
+	if err != nil {
+		return fmt.Errorf("failed to list steps: %v", err)
+	}
+	byStep := make(map[string]db.Execution, len(execs))
+	for _, exec := range execs {
+		// a retried step is decided by its last attempt
+		if last, ok := byStep[exec.Step]; !ok || exec.Attempt > last.Attempt {
+			byStep[exec.Step] = exec
+		}
+	}
+
+	run := &workflowRun{
+		id:          workflow.ID,
+		steps:       req.Steps,
+		results:     make([]stepResult, len(req.Steps)),
+		interrupted: true,
+	}
+	for i, step := range req.Steps {
+		exec, ok := byStep[step.Name]
+		if !ok {
+			continue
+		}
+		run.results[i] = stepResult{
+			started: true,
+			jobID:   exec.ID,
+			done:    true,
+			ok:      (exec.Status == int32(pb.State_COMPLETE) && exec.ExitCode == 0) || step.ContinueOnError,
+		}
+	}
+	w.log.Infof("Recovering workflow %s %q interrupted by a restart", workflow.ID, workflow.Name)
+	w.mu.Lock()
+	w.advance(run)
+	w.mu.Unlock()
+	return nil
+}
+
+// Stop stops the running steps of a workflow and skips those that did not
+// start yet. Stopping a finished workflow is not an error.
+func (w *Workflows) Stop(id string) error {
+	w.mu.Lock()
+	run, ok := w.runs[id]
+	var running []string
+	if ok {
+		run.stopped = true
+		for _, result := range run.results {
+			if result.started && !result.done && result.jobID != "" {
+				running = append(running, result.jobID)
+			}
+		}
+		w.advance(run)
+	}
+	w.mu.Unlock()
+	if !ok {
+		if _, err := w.db.GetWorkflow(id); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("no workflow found with ID %s", id)
+			}
+			return fmt.Errorf("failed to get workflow %s: %v", id, err)
+		}
+		return nil
+	}
+	w.log.Infof("Stopping workflow %s", id)
+	for _, jobID := range running {
+		// the step may have failed on its own in the meantime
+		if err := w.jobs.StopJob(context.Background(), jobID); err != nil {
+			w.log.Warnf("Failed to stop job %s of workflow %s: %v", jobID, id, err)
+		}
+	}
+	return nil
+}
+
+// Status returns the state of a workflow and each of its steps.
+func (w *Workflows) Status(id string) (*pb.WorkflowStatusResponse, error) {
+	workflow, err := w.db.GetWorkflow(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("no workflow found with ID %s", id)
+		}
+		return nil, fmt.Errorf("failed to get workflow %s: %v", id, err)
+	}
+	var req pb.WorkflowRequest
+	if err := protojson.Unmarshal(workflow.Request, &req); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal request of workflow %s: %v", id, err)
+	}
+	execs, err := w.db.ListExecutions(db.ExecutionFilter{WorkflowID: id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list steps of workflow %s: %v", id, err)
+	}
+	byStep := make(map[string]db.Execution, len(execs))
+	for _, exec := range execs {
+		// a retried step reports its last attempt
+		if last, ok := byStep[exec.Step]; !ok || exec.Attempt > last.Attempt {
+			byStep[exec.Step] = exec
+		}
+	}
+	finished := workflow.Status != int32(pb.State_RUNNING)
+	resp := &pb.WorkflowStatusResponse{
+		Id:    workflow.ID,
+		Name:  workflow.Name,
+		State: pb.State(workflow.Status),
+	}
+	for _, step := range req.Steps {
+		status := &pb.WorkflowStepStatus{Name: step.Name, State: pb.State_PENDING}
+		if exec, ok := byStep[step.Name]; ok {
+			status.Id = exec.ID
+			status.State = pb.State(exec.Status)
+			status.Exit = exec.ExitCode
+		} else if finished {
+			status.State = pb.State_UNKNOWN
+			status.Skipped = true
+		}
+		resp.Steps = append(resp.Steps, status)
+	}
+	return resp, nil
+}
+
+// advance starts or skips every step whose dependencies finished and
+// records the workflow's result once all steps are done. w.mu must be held.
+func (w *Workflows) advance(run *workflowRun) {
+	index := make(map[string]int, len(run.steps))
+	for i, step := range run.steps {
+		index[step.Name] = i
+	}
+	for changed := true; changed; {
+		changed = false
+		for i, step := range run.steps {
+			result := &run.results[i]
+			if result.started || result.skipped {
+				continue
+			}
+			ready, ok := true, true
+			for _, dep := range step.DependsOn {
+				d := run.results[index[dep]]
+				if !d.done && !d.skipped {
+					ready = false
+					break
+				}
+				ok = ok && d.ok
+			}
+			if !ready {
+				continue
+			}
+			changed = true
+			if run.stopped || run.interrupted || (!ok && !step.Always) {
+				w.log.Infof("Workflow %s skips step %s", run.id, step.Name)
+				result.skipped = true
+				continue
+			}
+			result.started = true
+			if err := w.startStep(run, i); err != nil {
+				w.log.Errorf("Failed to start step %s of workflow %s: %v", step.Name, run.id, err)
+				result.done = true
+				result.ok = step.ContinueOnError
+			}
+		}
+	}
+	for _, result := range run.results {
+		if !result.done && !result.skipped {
+			return
+		}
+	}
+	w.finish(run)
+}
+
+// startStep starts the job of step i. w.mu must be held.
+func (w *Workflows) startStep(run *workflowRun, i int) error {
+	step := run.steps[i]
+	jobID, err := w.jobs.newJob(context.Background(), step.Start, jobOptions{
+		workflowID: run.id,
+		step:       step.Name,
+		timeout:    time.Duration(step.TimeoutSeconds) * time.Second,
+		onDone:     func(done JobDone) { w.stepDone(run, i, done) },
+	})
+	if err != nil {
+		return err
+	}
+	w.log.Infof("Workflow %s started step %s as job %s", run.id, step.Name, jobID)
+	run.results[i].jobID = jobID
+	return nil
+}
+
+// stepDone records the result of step i and moves the workflow on.
+func (w *Workflows) stepDone(run *workflowRun, i int, done JobDone) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	result := &run.results[i]
+	result.done = true
+	result.ok = (done.status == int32(pb.State_COMPLETE) && done.ExitCode == 0) || run.steps[i].ContinueOnError
+	w.advance(run)
+}
+
+// finish records the rolled up state of a workflow whose steps are all
+// done. w.mu must be held.
+func (w *Workflows) finish(run *workflowRun) {
+	failed := false
+	for _, result := range run.results {
+		if result.skipped || !result.ok {
+			failed = true
+		}
+	}
+	state := pb.State_COMPLETE
+	if failed && run.stopped {
+		state = pb.State_STOPPED
+	} else if failed {
+		state = pb.State_ERROR
+	}
+	delete(w.runs, run.id)
+	w.log.Infof("Workflow %s finished with status %s", run.id, state)
+	workflow, err := w.db.GetWorkflow(run.id)
+	if err != nil {
+		w.log.Errorf("Failed to get workflow %s: %v", run.id, err)
+		return
+	}
+	workflow.Status = int32(state)
+	if err := w.db.UpdateWorkflow(*workflow); err != nil {
+		w.log.Errorf("Failed to update workflow %s: %v", run.id, err)
+	}
+}
+
+// validateWorkflow checks that the steps have unique names and commands and
+// that their dependencies exist and do not form a cycle.
+func validateWorkflow(in *pb.WorkflowRequest) error {
+	if len(in.Steps) == 0 {
+		return fmt.Errorf("workflow has no steps")
+	}
+	deps := make(map[string][]string, len(in.Steps))
+	for _, step := range in.Steps {
+		if step.Name == "" {
+			return fmt.Errorf("step without a name")
+		}
+		if _, ok := deps[step.Name]; ok {
+			return fmt.Errorf("duplicate step %s", step.Name)
+		}
+		if step.Start == nil || step.Start.Command == "" {
+			return fmt.Errorf("step %s has no command", step.Name)
+		}
+		if step.TimeoutSeconds < 0 {
+			return fmt.Errorf("step %s has a negative timeout", step.Name)
+		}
+		deps[step.Name] = step.DependsOn
+	}
+	for _, step := range in.Steps {
+		for _, dep := range step.DependsOn {
+			if _, ok := deps[dep]; !ok {
+				return fmt.Errorf("step %s depends on unknown step %s", step.Name, dep)
+			}
+		}
+	}
+
+	// depth first search, a step reached again while visiting its own
+	// dependencies is part of a cycle
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	marks := make(map[string]int, len(deps))
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch marks[name] {
+		case visiting:
+			return fmt.Errorf("step %s depends on itself", name)
+		case visited:
+			return nil
+		}
+		marks[name] = visiting
+		for _, dep := range deps[name] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		marks[name] = visited
+		return nil
+	}
+	for _, step := range in.Steps {
+		if err := visit(step.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+// Package version holds the version the agent and client were built as.
+package version
+
+import "runtime/debug"
+
+// Version is set when building a release, e.g. with
+// -ldflags "-X github.com/stewyb314/remote-control/internal/version.Version=v1.2.0"
+var Version = ""
+
+// String returns Version, or else the module version or VCS revision the
+// binary was built from.
+func String() string {
+	if Version != "" {
+		return Version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	revision, modified := "", false
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.modified":
+			modified = s.Value == "true"
+		}
+	}
+	if revision == "" {
+		return "devel"
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified {
+		revision += "-dirty"
+	}
+	return "devel-" + revision
+}
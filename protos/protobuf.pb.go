@@ -21,6 +21,106 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+type BackoffPolicy int32
+
+const (
+	// Wait backoff_ms before every retry
+	BackoffPolicy_BACKOFF_FIXED BackoffPolicy = 0
+	// Double the wait with every retry
+	BackoffPolicy_BACKOFF_EXPONENTIAL BackoffPolicy = 1
+)
+
+// Enum value maps for BackoffPolicy.
+var (
+	BackoffPolicy_name = map[int32]string{
+		0: "BACKOFF_FIXED",
+		1: "BACKOFF_EXPONENTIAL",
+	}
+	BackoffPolicy_value = map[string]int32{
+		"BACKOFF_FIXED":       0,
+		"BACKOFF_EXPONENTIAL": 1,
+	}
+)
+
+func (x BackoffPolicy) Enum() *BackoffPolicy {
+	p := new(BackoffPolicy)
+	*p = x
+	return p
+}
+
+func (x BackoffPolicy) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (BackoffPolicy) Descriptor() protoreflect.EnumDescriptor {
+	return file_protos_protobuf_proto_enumTypes[0].Descriptor()
+}
+
+func (BackoffPolicy) Type() protoreflect.EnumType {
+	return &file_protos_protobuf_proto_enumTypes[0]
+}
+
+func (x BackoffPolicy) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use BackoffPolicy.Descriptor instead.
+func (BackoffPolicy) EnumDescriptor() ([]byte, []int) {
+	return file_protos_protobuf_proto_rawDescGZIP(), []int{0}
+}
+
+type OutputLimitMode int32
+
+const (
+	// Use the agent's configured mode
+	OutputLimitMode_LIMIT_DEFAULT OutputLimitMode = 0
+	// Kill the command when it exceeds the limit
+	OutputLimitMode_LIMIT_KILL OutputLimitMode = 1
+	// Keep running and only keep the last output_limit bytes
+	OutputLimitMode_LIMIT_RING OutputLimitMode = 2
+)
+
+// Enum value maps for OutputLimitMode.
+var (
+	OutputLimitMode_name = map[int32]string{
+		0: "LIMIT_DEFAULT",
+		1: "LIMIT_KILL",
+		2: "LIMIT_RING",
+	}
+	OutputLimitMode_value = map[string]int32{
+		"LIMIT_DEFAULT": 0,
+		"LIMIT_KILL":    1,
+		"LIMIT_RING":    2,
+	}
+)
+
+func (x OutputLimitMode) Enum() *OutputLimitMode {
+	p := new(OutputLimitMode)
+	*p = x
+	return p
+}
+
+func (x OutputLimitMode) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (OutputLimitMode) Descriptor() protoreflect.EnumDescriptor {
+	return file_protos_protobuf_proto_enumTypes[1].Descriptor()
+}
+
+func (OutputLimitMode) Type() protoreflect.EnumType {
+	return &file_protos_protobuf_proto_enumTypes[1]
+}
+
+func (x OutputLimitMode) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use OutputLimitMode.Descriptor instead.
+func (OutputLimitMode) EnumDescriptor() ([]byte, []int) {
+	return file_protos_protobuf_proto_rawDescGZIP(), []int{1}
+}
+
 type State int32
 
 const (
@@ -69,11 +169,11 @@ func (x State) String() string {
 }
 
 func (State) Descriptor() protoreflect.EnumDescriptor {
-	return file_protos_protobuf_proto_enumTypes[0].Descriptor()
+	return file_protos_protobuf_proto_enumTypes[2].Descriptor()
 }
 
 func (State) Type() protoreflect.EnumType {
-	return &file_protos_protobuf_proto_enumTypes[0]
+	return &file_protos_protobuf_proto_enumTypes[2]
 }
 
 func (x State) Number() protoreflect.EnumNumber {
@@ -82,7 +182,7 @@ func (x State) Number() protoreflect.EnumNumber {
 
 // Deprecated: Use State.Descriptor instead.
 func (State) EnumDescriptor() ([]byte, []int) {
-	return file_protos_protobuf_proto_rawDescGZIP(), []int{0}
+	return file_protos_protobuf_proto_rawDescGZIP(), []int{2}
 }
 
 type StartRequest struct {
@@ -90,7 +190,25 @@ type StartRequest struct {
 	// command to execute
 	Command string `protobuf:"bytes,1,opt,name=command,proto3" json:"command,omitempty"`
 	// arguments to the command
-	Args          []string `protobuf:"bytes,2,rep,name=args,proto3" json:"args,omitempty"` //
+	Args []string `protobuf:"bytes,2,rep,name=args,proto3" json:"args,omitempty"` //
+	// maximum number of output bytes to keep, 0 uses the agent's limit
+	OutputLimit int64 `protobuf:"varint,3,opt,name=output_limit,json=outputLimit,proto3" json:"output_limit,omitempty"`
+	// what to do when the output exceeds the limit
+	OutputLimitMode OutputLimitMode `protobuf:"varint,4,opt,name=output_limit_mode,json=outputLimitMode,proto3,enum=cmd.OutputLimitMode" json:"output_limit_mode,omitempty"`
+	// user the command runs on behalf of, used for per-user limits
+	Owner string `protobuf:"bytes,5,opt,name=owner,proto3" json:"owner,omitempty"`
+	// queued commands with a higher priority start first when the agent
+	// orders its queue by priority
+	Priority int32 `protobuf:"varint,6,opt,name=priority,proto3" json:"priority,omitempty"`
+	// how to retry the command when it fails
+	Retry *RetryPolicy `protobuf:"bytes,7,opt,name=retry,proto3" json:"retry,omitempty"`
+	// unique key of the request, starting a command with the key of a
+	// recent request returns that request's command instead
+	IdempotencyKey string `protobuf:"bytes,8,opt,name=idempotency_key,json=idempotencyKey,proto3" json:"idempotency_key,omitempty"`
+	// positions in args, starting at 0, of secrets such as passwords. The
+	// command gets them as they are but the agent masks them wherever it
+	// logs, stores or returns the arguments.
+	SecretArgs    []int32 `protobuf:"varint,9,rep,packed,name=secret_args,json=secretArgs,proto3" json:"secret_args,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -139,6 +257,136 @@ func (x *StartRequest) GetArgs() []string {
 	return nil
 }
 
+func (x *StartRequest) GetOutputLimit() int64 {
+	if x != nil {
+		return x.OutputLimit
+	}
+	return 0
+}
+
+func (x *StartRequest) GetOutputLimitMode() OutputLimitMode {
+	if x != nil {
+		return x.OutputLimitMode
+	}
+	return OutputLimitMode_LIMIT_DEFAULT
+}
+
+func (x *StartRequest) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *StartRequest) GetPriority() int32 {
+	if x != nil {
+		return x.Priority
+	}
+	return 0
+}
+
+func (x *StartRequest) GetRetry() *RetryPolicy {
+	if x != nil {
+		return x.Retry
+	}
+	return nil
+}
+
+func (x *StartRequest) GetIdempotencyKey() string {
+	if x != nil {
+		return x.IdempotencyKey
+	}
+	return ""
+}
+
+func (x *StartRequest) GetSecretArgs() []int32 {
+	if x != nil {
+		return x.SecretArgs
+	}
+	return nil
+}
+
+type RetryPolicy struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// number of times the command is run at most, 0 or 1 never retries
+	MaxAttempts int32 `protobuf:"varint,1,opt,name=max_attempts,json=maxAttempts,proto3" json:"max_attempts,omitempty"`
+	// milliseconds to wait before the first retry
+	BackoffMs int64 `protobuf:"varint,2,opt,name=backoff_ms,json=backoffMs,proto3" json:"backoff_ms,omitempty"`
+	// how the wait grows with every retry
+	BackoffPolicy BackoffPolicy `protobuf:"varint,3,opt,name=backoff_policy,json=backoffPolicy,proto3,enum=cmd.BackoffPolicy" json:"backoff_policy,omitempty"`
+	// cap of the wait in milliseconds, 0 for no cap
+	MaxBackoffMs int64 `protobuf:"varint,4,opt,name=max_backoff_ms,json=maxBackoffMs,proto3" json:"max_backoff_ms,omitempty"`
+	// exit codes that are retried, any non-zero exit code when empty
+	RetryableExitCodes []int32 `protobuf:"varint,5,rep,packed,name=retryable_exit_codes,json=retryableExitCodes,proto3" json:"retryable_exit_codes,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *RetryPolicy) Reset() {
+	*x = RetryPolicy{}
+	mi := &file_protos_protobuf_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RetryPolicy) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RetryPolicy) ProtoMessage() {}
+
+func (x *RetryPolicy) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_protobuf_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RetryPolicy.ProtoReflect.Descriptor instead.
+func (*RetryPolicy) Descriptor() ([]byte, []int) {
+	return file_protos_protobuf_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *RetryPolicy) GetMaxAttempts() int32 {
+	if x != nil {
+		return x.MaxAttempts
+	}
+	return 0
+}
+
+func (x *RetryPolicy) GetBackoffMs() int64 {
+	if x != nil {
+		return x.BackoffMs
+	}
+	return 0
+}
+
+func (x *RetryPolicy) GetBackoffPolicy() BackoffPolicy {
+	if x != nil {
+		return x.BackoffPolicy
+	}
+	return BackoffPolicy_BACKOFF_FIXED
+}
+
+func (x *RetryPolicy) GetMaxBackoffMs() int64 {
+	if x != nil {
+		return x.MaxBackoffMs
+	}
+	return 0
+}
+
+func (x *RetryPolicy) GetRetryableExitCodes() []int32 {
+	if x != nil {
+		return x.RetryableExitCodes
+	}
+	return nil
+}
+
 type StartResponse struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
 	// return the command ID of started command
@@ -149,7 +397,7 @@ type StartResponse struct {
 
 func (x *StartResponse) Reset() {
 	*x = StartResponse{}
-	mi := &file_protos_protobuf_proto_msgTypes[1]
+	mi := &file_protos_protobuf_proto_msgTypes[2]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -161,7 +409,7 @@ func (x *StartResponse) String() string {
 func (*StartResponse) ProtoMessage() {}
 
 func (x *StartResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_protos_protobuf_proto_msgTypes[1]
+	mi := &file_protos_protobuf_proto_msgTypes[2]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -174,7 +422,7 @@ func (x *StartResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use StartResponse.ProtoReflect.Descriptor instead.
 func (*StartResponse) Descriptor() ([]byte, []int) {
-	return file_protos_protobuf_proto_rawDescGZIP(), []int{1}
+	return file_protos_protobuf_proto_rawDescGZIP(), []int{2}
 }
 
 func (x *StartResponse) GetId() string {
@@ -194,7 +442,7 @@ type OutputRequest struct {
 
 func (x *OutputRequest) Reset() {
 	*x = OutputRequest{}
-	mi := &file_protos_protobuf_proto_msgTypes[2]
+	mi := &file_protos_protobuf_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -206,7 +454,7 @@ func (x *OutputRequest) String() string {
 func (*OutputRequest) ProtoMessage() {}
 
 func (x *OutputRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_protos_protobuf_proto_msgTypes[2]
+	mi := &file_protos_protobuf_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -219,7 +467,7 @@ func (x *OutputRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use OutputRequest.ProtoReflect.Descriptor instead.
 func (*OutputRequest) Descriptor() ([]byte, []int) {
-	return file_protos_protobuf_proto_rawDescGZIP(), []int{2}
+	return file_protos_protobuf_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *OutputRequest) GetId() string {
@@ -239,7 +487,7 @@ type OutputResponse struct {
 
 func (x *OutputResponse) Reset() {
 	*x = OutputResponse{}
-	mi := &file_protos_protobuf_proto_msgTypes[3]
+	mi := &file_protos_protobuf_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -251,7 +499,7 @@ func (x *OutputResponse) String() string {
 func (*OutputResponse) ProtoMessage() {}
 
 func (x *OutputResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_protos_protobuf_proto_msgTypes[3]
+	mi := &file_protos_protobuf_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -264,7 +512,7 @@ func (x *OutputResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use OutputResponse.ProtoReflect.Descriptor instead.
 func (*OutputResponse) Descriptor() ([]byte, []int) {
-	return file_protos_protobuf_proto_rawDescGZIP(), []int{3}
+	return file_protos_protobuf_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *OutputResponse) GetOutput() []byte {
@@ -284,7 +532,7 @@ type StatusRequest struct {
 
 func (x *StatusRequest) Reset() {
 	*x = StatusRequest{}
-	mi := &file_protos_protobuf_proto_msgTypes[4]
+	mi := &file_protos_protobuf_proto_msgTypes[5]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -296,7 +544,7 @@ func (x *StatusRequest) String() string {
 func (*StatusRequest) ProtoMessage() {}
 
 func (x *StatusRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_protos_protobuf_proto_msgTypes[4]
+	mi := &file_protos_protobuf_proto_msgTypes[5]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -309,7 +557,7 @@ func (x *StatusRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use StatusRequest.ProtoReflect.Descriptor instead.
 func (*StatusRequest) Descriptor() ([]byte, []int) {
-	return file_protos_protobuf_proto_rawDescGZIP(), []int{4}
+	return file_protos_protobuf_proto_rawDescGZIP(), []int{5}
 }
 
 func (x *StatusRequest) GetId() string {
@@ -330,14 +578,29 @@ type StatusResponse struct {
 	// current state of the command
 	State State `protobuf:"varint,4,opt,name=state,proto3,enum=cmd.State" json:"state,omitempty"`
 	// exit status of the command
-	Exit          int32 `protobuf:"varint,6,opt,name=exit,proto3" json:"exit,omitempty"`
+	Exit int32 `protobuf:"varint,6,opt,name=exit,proto3" json:"exit,omitempty"`
+	// the output exceeded the output limit and was cut
+	Truncated bool `protobuf:"varint,7,opt,name=truncated,proto3" json:"truncated,omitempty"`
+	// position in the agent's queue of PENDING commands, starting at 1
+	QueuePosition int32 `protobuf:"varint,8,opt,name=queue_position,json=queuePosition,proto3" json:"queue_position,omitempty"`
+	// ID of the schedule that started the command
+	ScheduleId string `protobuf:"bytes,9,opt,name=schedule_id,json=scheduleId,proto3" json:"schedule_id,omitempty"`
+	// ID of the workflow the command is a step of
+	WorkflowId string `protobuf:"bytes,10,opt,name=workflow_id,json=workflowId,proto3" json:"workflow_id,omitempty"`
+	// attempt the state and exit status are of, starting at 1
+	Attempt int32 `protobuf:"varint,11,opt,name=attempt,proto3" json:"attempt,omitempty"`
+	// IDs of the command's attempts, the first is the command's own ID
+	AttemptIds []string `protobuf:"bytes,12,rep,name=attempt_ids,json=attemptIds,proto3" json:"attempt_ids,omitempty"`
+	// why the command is in ERROR, when the agent knows, e.g. "agent
+	// restarted" for a command that was running when the agent stopped
+	Error         string `protobuf:"bytes,13,opt,name=error,proto3" json:"error,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *StatusResponse) Reset() {
 	*x = StatusResponse{}
-	mi := &file_protos_protobuf_proto_msgTypes[5]
+	mi := &file_protos_protobuf_proto_msgTypes[6]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -349,7 +612,7 @@ func (x *StatusResponse) String() string {
 func (*StatusResponse) ProtoMessage() {}
 
 func (x *StatusResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_protos_protobuf_proto_msgTypes[5]
+	mi := &file_protos_protobuf_proto_msgTypes[6]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -362,7 +625,7 @@ func (x *StatusResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use StatusResponse.ProtoReflect.Descriptor instead.
 func (*StatusResponse) Descriptor() ([]byte, []int) {
-	return file_protos_protobuf_proto_rawDescGZIP(), []int{5}
+	return file_protos_protobuf_proto_rawDescGZIP(), []int{6}
 }
 
 func (x *StatusResponse) GetId() string {
@@ -400,6 +663,55 @@ func (x *StatusResponse) GetExit() int32 {
 	return 0
 }
 
+func (x *StatusResponse) GetTruncated() bool {
+	if x != nil {
+		return x.Truncated
+	}
+	return false
+}
+
+func (x *StatusResponse) GetQueuePosition() int32 {
+	if x != nil {
+		return x.QueuePosition
+	}
+	return 0
+}
+
+func (x *StatusResponse) GetScheduleId() string {
+	if x != nil {
+		return x.ScheduleId
+	}
+	return ""
+}
+
+func (x *StatusResponse) GetWorkflowId() string {
+	if x != nil {
+		return x.WorkflowId
+	}
+	return ""
+}
+
+func (x *StatusResponse) GetAttempt() int32 {
+	if x != nil {
+		return x.Attempt
+	}
+	return 0
+}
+
+func (x *StatusResponse) GetAttemptIds() []string {
+	if x != nil {
+		return x.AttemptIds
+	}
+	return nil
+}
+
+func (x *StatusResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
 type StopRequest struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
 	// ID of the command to stop
@@ -410,7 +722,7 @@ type StopRequest struct {
 
 func (x *StopRequest) Reset() {
 	*x = StopRequest{}
-	mi := &file_protos_protobuf_proto_msgTypes[6]
+	mi := &file_protos_protobuf_proto_msgTypes[7]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -422,7 +734,7 @@ func (x *StopRequest) String() string {
 func (*StopRequest) ProtoMessage() {}
 
 func (x *StopRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_protos_protobuf_proto_msgTypes[6]
+	mi := &file_protos_protobuf_proto_msgTypes[7]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -435,7 +747,7 @@ func (x *StopRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use StopRequest.ProtoReflect.Descriptor instead.
 func (*StopRequest) Descriptor() ([]byte, []int) {
-	return file_protos_protobuf_proto_rawDescGZIP(), []int{6}
+	return file_protos_protobuf_proto_rawDescGZIP(), []int{7}
 }
 
 func (x *StopRequest) GetId() string {
@@ -455,7 +767,7 @@ type StopResponse struct {
 
 func (x *StopResponse) Reset() {
 	*x = StopResponse{}
-	mi := &file_protos_protobuf_proto_msgTypes[7]
+	mi := &file_protos_protobuf_proto_msgTypes[8]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -467,7 +779,7 @@ func (x *StopResponse) String() string {
 func (*StopResponse) ProtoMessage() {}
 
 func (x *StopResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_protos_protobuf_proto_msgTypes[7]
+	mi := &file_protos_protobuf_proto_msgTypes[8]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -480,7 +792,7 @@ func (x *StopResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use StopResponse.ProtoReflect.Descriptor instead.
 func (*StopResponse) Descriptor() ([]byte, []int) {
-	return file_protos_protobuf_proto_rawDescGZIP(), []int{7}
+	return file_protos_protobuf_proto_rawDescGZIP(), []int{8}
 }
 
 func (x *StopResponse) GetId() string {
@@ -490,45 +802,1557 @@ func (x *StopResponse) GetId() string {
 	return ""
 }
 
-var File_protos_protobuf_proto protoreflect.FileDescriptor
+type ScheduleRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// the command to start on every run
+	Start *StartRequest `protobuf:"bytes,1,opt,name=start,proto3" json:"start,omitempty"`
+	// cron expression, e.g. "*/5 * * * *" or "@hourly"
+	Cron string `protobuf:"bytes,2,opt,name=cron,proto3" json:"cron,omitempty"`
+	// unix time to run the command once, instead of cron
+	RunAt         int64 `protobuf:"varint,3,opt,name=run_at,json=runAt,proto3" json:"run_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
 
-const file_protos_protobuf_proto_rawDesc = "" +
-	"\n" +
-	"\x15protos/protobuf.proto\x12\x03cmd\"<\n" +
-	"\fStartRequest\x12\x18\n" +
-	"\acommand\x18\x01 \x01(\tR\acommand\x12\x12\n" +
-	"\x04args\x18\x02 \x03(\tR\x04args\"\x1f\n" +
-	"\rStartResponse\x12\x0e\n" +
-	"\x02id\x18\x01 \x01(\tR\x02id\"\x1f\n" +
-	"\rOutputRequest\x12\x0e\n" +
-	"\x02id\x18\x01 \x01(\tR\x02id\"(\n" +
-	"\x0eOutputResponse\x12\x16\n" +
-	"\x06output\x18\x01 \x01(\fR\x06output\"\x1f\n" +
-	"\rStatusRequest\x12\x0e\n" +
-	"\x02id\x18\x01 \x01(\tR\x02id\"|\n" +
-	"\x0eStatusResponse\x12\x0e\n" +
-	"\x02id\x18\x01 \x01(\tR\x02id\x12\x10\n" +
-	"\x03cmd\x18\x02 \x01(\tR\x03cmd\x12\x12\n" +
-	"\x04args\x18\x03 \x03(\tR\x04args\x12 \n" +
-	"\x05state\x18\x04 \x01(\x0e2\n" +
-	".cmd.StateR\x05state\x12\x12\n" +
-	"\x04exit\x18\x06 \x01(\x05R\x04exit\"\x1d\n" +
-	"\vStopRequest\x12\x0e\n" +
-	"\x02id\x18\x01 \x01(\tR\x02id\"\x1e\n" +
-	"\fStopResponse\x12\x0e\n" +
-	"\x02id\x18\x01 \x01(\tR\x02id*T\n" +
+func (x *ScheduleRequest) Reset() {
+	*x = ScheduleRequest{}
+	mi := &file_protos_protobuf_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ScheduleRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ScheduleRequest) ProtoMessage() {}
+
+func (x *ScheduleRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_protobuf_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ScheduleRequest.ProtoReflect.Descriptor instead.
+func (*ScheduleRequest) Descriptor() ([]byte, []int) {
+	return file_protos_protobuf_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ScheduleRequest) GetStart() *StartRequest {
+	if x != nil {
+		return x.Start
+	}
+	return nil
+}
+
+func (x *ScheduleRequest) GetCron() string {
+	if x != nil {
+		return x.Cron
+	}
+	return ""
+}
+
+func (x *ScheduleRequest) GetRunAt() int64 {
+	if x != nil {
+		return x.RunAt
+	}
+	return 0
+}
+
+type ScheduleResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// ID of the new schedule
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// unix time of the next run
+	NextRun       int64 `protobuf:"varint,2,opt,name=next_run,json=nextRun,proto3" json:"next_run,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ScheduleResponse) Reset() {
+	*x = ScheduleResponse{}
+	mi := &file_protos_protobuf_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ScheduleResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ScheduleResponse) ProtoMessage() {}
+
+func (x *ScheduleResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_protobuf_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ScheduleResponse.ProtoReflect.Descriptor instead.
+func (*ScheduleResponse) Descriptor() ([]byte, []int) {
+	return file_protos_protobuf_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ScheduleResponse) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *ScheduleResponse) GetNextRun() int64 {
+	if x != nil {
+		return x.NextRun
+	}
+	return 0
+}
+
+type ScheduleInfo struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// schedule ID
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// command which is executed
+	Cmd string `protobuf:"bytes,2,opt,name=cmd,proto3" json:"cmd,omitempty"`
+	// args to the command
+	Args []string `protobuf:"bytes,3,rep,name=args,proto3" json:"args,omitempty"`
+	// cron expression, empty for one-shot schedules
+	Cron string `protobuf:"bytes,4,opt,name=cron,proto3" json:"cron,omitempty"`
+	// unix time of a one-shot schedule
+	RunAt int64 `protobuf:"varint,5,opt,name=run_at,json=runAt,proto3" json:"run_at,omitempty"`
+	// unix time of the next run, 0 when the schedule will not run again
+	NextRun int64 `protobuf:"varint,6,opt,name=next_run,json=nextRun,proto3" json:"next_run,omitempty"`
+	// unix time of the last run, 0 when it never ran
+	LastRun int64 `protobuf:"varint,7,opt,name=last_run,json=lastRun,proto3" json:"last_run,omitempty"`
+	// ID of the command started by the last run
+	LastId        string `protobuf:"bytes,8,opt,name=last_id,json=lastId,proto3" json:"last_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ScheduleInfo) Reset() {
+	*x = ScheduleInfo{}
+	mi := &file_protos_protobuf_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ScheduleInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ScheduleInfo) ProtoMessage() {}
+
+func (x *ScheduleInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_protobuf_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ScheduleInfo.ProtoReflect.Descriptor instead.
+func (*ScheduleInfo) Descriptor() ([]byte, []int) {
+	return file_protos_protobuf_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *ScheduleInfo) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *ScheduleInfo) GetCmd() string {
+	if x != nil {
+		return x.Cmd
+	}
+	return ""
+}
+
+func (x *ScheduleInfo) GetArgs() []string {
+	if x != nil {
+		return x.Args
+	}
+	return nil
+}
+
+func (x *ScheduleInfo) GetCron() string {
+	if x != nil {
+		return x.Cron
+	}
+	return ""
+}
+
+func (x *ScheduleInfo) GetRunAt() int64 {
+	if x != nil {
+		return x.RunAt
+	}
+	return 0
+}
+
+func (x *ScheduleInfo) GetNextRun() int64 {
+	if x != nil {
+		return x.NextRun
+	}
+	return 0
+}
+
+func (x *ScheduleInfo) GetLastRun() int64 {
+	if x != nil {
+		return x.LastRun
+	}
+	return 0
+}
+
+func (x *ScheduleInfo) GetLastId() string {
+	if x != nil {
+		return x.LastId
+	}
+	return ""
+}
+
+type ListSchedulesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListSchedulesRequest) Reset() {
+	*x = ListSchedulesRequest{}
+	mi := &file_protos_protobuf_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListSchedulesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListSchedulesRequest) ProtoMessage() {}
+
+func (x *ListSchedulesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_protobuf_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListSchedulesRequest.ProtoReflect.Descriptor instead.
+func (*ListSchedulesRequest) Descriptor() ([]byte, []int) {
+	return file_protos_protobuf_proto_rawDescGZIP(), []int{12}
+}
+
+type ListSchedulesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Schedules     []*ScheduleInfo        `protobuf:"bytes,1,rep,name=schedules,proto3" json:"schedules,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListSchedulesResponse) Reset() {
+	*x = ListSchedulesResponse{}
+	mi := &file_protos_protobuf_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListSchedulesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListSchedulesResponse) ProtoMessage() {}
+
+func (x *ListSchedulesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_protobuf_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListSchedulesResponse.ProtoReflect.Descriptor instead.
+func (*ListSchedulesResponse) Descriptor() ([]byte, []int) {
+	return file_protos_protobuf_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *ListSchedulesResponse) GetSchedules() []*ScheduleInfo {
+	if x != nil {
+		return x.Schedules
+	}
+	return nil
+}
+
+type ListJobsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// only list commands in one of these states, all when empty
+	States []State `protobuf:"varint,1,rep,packed,name=states,proto3,enum=cmd.State" json:"states,omitempty"`
+	// only list the commands of this owner, all when empty
+	Owner string `protobuf:"bytes,2,opt,name=owner,proto3" json:"owner,omitempty"`
+	// maximum number of commands to list, 0 uses the agent's default
+	Limit         int32 `protobuf:"varint,3,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListJobsRequest) Reset() {
+	*x = ListJobsRequest{}
+	mi := &file_protos_protobuf_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListJobsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListJobsRequest) ProtoMessage() {}
+
+func (x *ListJobsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_protobuf_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListJobsRequest.ProtoReflect.Descriptor instead.
+func (*ListJobsRequest) Descriptor() ([]byte, []int) {
+	return file_protos_protobuf_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *ListJobsRequest) GetStates() []State {
+	if x != nil {
+		return x.States
+	}
+	return nil
+}
+
+func (x *ListJobsRequest) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *ListJobsRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type JobInfo struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// command ID
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// command which is executed
+	Cmd string `protobuf:"bytes,2,opt,name=cmd,proto3" json:"cmd,omitempty"`
+	// args to the command
+	Args []string `protobuf:"bytes,3,rep,name=args,proto3" json:"args,omitempty"`
+	// state of the command
+	State State `protobuf:"varint,4,opt,name=state,proto3,enum=cmd.State" json:"state,omitempty"`
+	// exit code of a finished command
+	Exit int32 `protobuf:"varint,5,opt,name=exit,proto3" json:"exit,omitempty"`
+	// user the command runs on behalf of
+	Owner string `protobuf:"bytes,6,opt,name=owner,proto3" json:"owner,omitempty"`
+	// unix time the command was started
+	CreatedAt     int64 `protobuf:"varint,7,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *JobInfo) Reset() {
+	*x = JobInfo{}
+	mi := &file_protos_protobuf_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *JobInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JobInfo) ProtoMessage() {}
+
+func (x *JobInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_protobuf_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JobInfo.ProtoReflect.Descriptor instead.
+func (*JobInfo) Descriptor() ([]byte, []int) {
+	return file_protos_protobuf_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *JobInfo) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *JobInfo) GetCmd() string {
+	if x != nil {
+		return x.Cmd
+	}
+	return ""
+}
+
+func (x *JobInfo) GetArgs() []string {
+	if x != nil {
+		return x.Args
+	}
+	return nil
+}
+
+func (x *JobInfo) GetState() State {
+	if x != nil {
+		return x.State
+	}
+	return State_UNKNOWN
+}
+
+func (x *JobInfo) GetExit() int32 {
+	if x != nil {
+		return x.Exit
+	}
+	return 0
+}
+
+func (x *JobInfo) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *JobInfo) GetCreatedAt() int64 {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return 0
+}
+
+type ListJobsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Jobs          []*JobInfo             `protobuf:"bytes,1,rep,name=jobs,proto3" json:"jobs,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListJobsResponse) Reset() {
+	*x = ListJobsResponse{}
+	mi := &file_protos_protobuf_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListJobsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListJobsResponse) ProtoMessage() {}
+
+func (x *ListJobsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_protobuf_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListJobsResponse.ProtoReflect.Descriptor instead.
+func (*ListJobsResponse) Descriptor() ([]byte, []int) {
+	return file_protos_protobuf_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *ListJobsResponse) GetJobs() []*JobInfo {
+	if x != nil {
+		return x.Jobs
+	}
+	return nil
+}
+
+type DrainRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DrainRequest) Reset() {
+	*x = DrainRequest{}
+	mi := &file_protos_protobuf_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DrainRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DrainRequest) ProtoMessage() {}
+
+func (x *DrainRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_protobuf_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DrainRequest.ProtoReflect.Descriptor instead.
+func (*DrainRequest) Descriptor() ([]byte, []int) {
+	return file_protos_protobuf_proto_rawDescGZIP(), []int{17}
+}
+
+type DrainResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// number of commands still running
+	Running int32 `protobuf:"varint,1,opt,name=running,proto3" json:"running,omitempty"`
+	// number of commands waiting to start, queued or waiting for a retry
+	Pending       int32 `protobuf:"varint,2,opt,name=pending,proto3" json:"pending,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DrainResponse) Reset() {
+	*x = DrainResponse{}
+	mi := &file_protos_protobuf_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DrainResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DrainResponse) ProtoMessage() {}
+
+func (x *DrainResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_protobuf_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DrainResponse.ProtoReflect.Descriptor instead.
+func (*DrainResponse) Descriptor() ([]byte, []int) {
+	return file_protos_protobuf_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *DrainResponse) GetRunning() int32 {
+	if x != nil {
+		return x.Running
+	}
+	return 0
+}
+
+func (x *DrainResponse) GetPending() int32 {
+	if x != nil {
+		return x.Pending
+	}
+	return 0
+}
+
+type HealthRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HealthRequest) Reset() {
+	*x = HealthRequest{}
+	mi := &file_protos_protobuf_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HealthRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HealthRequest) ProtoMessage() {}
+
+func (x *HealthRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_protobuf_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HealthRequest.ProtoReflect.Descriptor instead.
+func (*HealthRequest) Descriptor() ([]byte, []int) {
+	return file_protos_protobuf_proto_rawDescGZIP(), []int{19}
+}
+
+type BackendStatus struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// backend checked: database or output
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// whether the backend works
+	Ok bool `protobuf:"varint,2,opt,name=ok,proto3" json:"ok,omitempty"`
+	// why the check failed
+	Error string `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	// time the check took in milliseconds
+	LatencyMs     int64 `protobuf:"varint,4,opt,name=latency_ms,json=latencyMs,proto3" json:"latency_ms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BackendStatus) Reset() {
+	*x = BackendStatus{}
+	mi := &file_protos_protobuf_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BackendStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BackendStatus) ProtoMessage() {}
+
+func (x *BackendStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_protobuf_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BackendStatus.ProtoReflect.Descriptor instead.
+func (*BackendStatus) Descriptor() ([]byte, []int) {
+	return file_protos_protobuf_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *BackendStatus) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *BackendStatus) GetOk() bool {
+	if x != nil {
+		return x.Ok
+	}
+	return false
+}
+
+func (x *BackendStatus) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *BackendStatus) GetLatencyMs() int64 {
+	if x != nil {
+		return x.LatencyMs
+	}
+	return 0
+}
+
+type HealthResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// version of the agent
+	Version string `protobuf:"bytes,1,opt,name=version,proto3" json:"version,omitempty"`
+	// seconds since the agent started
+	UptimeSeconds int64 `protobuf:"varint,2,opt,name=uptime_seconds,json=uptimeSeconds,proto3" json:"uptime_seconds,omitempty"`
+	// number of commands running
+	Running int32 `protobuf:"varint,3,opt,name=running,proto3" json:"running,omitempty"`
+	// number of commands waiting to start
+	Pending int32 `protobuf:"varint,4,opt,name=pending,proto3" json:"pending,omitempty"`
+	// whether the agent refuses new commands
+	Draining bool `protobuf:"varint,5,opt,name=draining,proto3" json:"draining,omitempty"`
+	// whether the agent accepts new commands, all backends work and it is
+	// not draining
+	Ready         bool             `protobuf:"varint,6,opt,name=ready,proto3" json:"ready,omitempty"`
+	Backends      []*BackendStatus `protobuf:"bytes,7,rep,name=backends,proto3" json:"backends,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HealthResponse) Reset() {
+	*x = HealthResponse{}
+	mi := &file_protos_protobuf_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HealthResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HealthResponse) ProtoMessage() {}
+
+func (x *HealthResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_protobuf_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HealthResponse.ProtoReflect.Descriptor instead.
+func (*HealthResponse) Descriptor() ([]byte, []int) {
+	return file_protos_protobuf_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *HealthResponse) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *HealthResponse) GetUptimeSeconds() int64 {
+	if x != nil {
+		return x.UptimeSeconds
+	}
+	return 0
+}
+
+func (x *HealthResponse) GetRunning() int32 {
+	if x != nil {
+		return x.Running
+	}
+	return 0
+}
+
+func (x *HealthResponse) GetPending() int32 {
+	if x != nil {
+		return x.Pending
+	}
+	return 0
+}
+
+func (x *HealthResponse) GetDraining() bool {
+	if x != nil {
+		return x.Draining
+	}
+	return false
+}
+
+func (x *HealthResponse) GetReady() bool {
+	if x != nil {
+		return x.Ready
+	}
+	return false
+}
+
+func (x *HealthResponse) GetBackends() []*BackendStatus {
+	if x != nil {
+		return x.Backends
+	}
+	return nil
+}
+
+type DeleteScheduleRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// ID of the schedule to delete
+	Id            string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteScheduleRequest) Reset() {
+	*x = DeleteScheduleRequest{}
+	mi := &file_protos_protobuf_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteScheduleRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteScheduleRequest) ProtoMessage() {}
+
+func (x *DeleteScheduleRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_protobuf_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteScheduleRequest.ProtoReflect.Descriptor instead.
+func (*DeleteScheduleRequest) Descriptor() ([]byte, []int) {
+	return file_protos_protobuf_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *DeleteScheduleRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type DeleteScheduleResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// ID of the schedule deleted
+	Id            string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteScheduleResponse) Reset() {
+	*x = DeleteScheduleResponse{}
+	mi := &file_protos_protobuf_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteScheduleResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteScheduleResponse) ProtoMessage() {}
+
+func (x *DeleteScheduleResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_protobuf_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteScheduleResponse.ProtoReflect.Descriptor instead.
+func (*DeleteScheduleResponse) Descriptor() ([]byte, []int) {
+	return file_protos_protobuf_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *DeleteScheduleResponse) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type WorkflowStep struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// name of the step, unique within the workflow
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// the command the step runs
+	Start *StartRequest `protobuf:"bytes,2,opt,name=start,proto3" json:"start,omitempty"`
+	// names of the steps that must succeed before this step runs
+	DependsOn []string `protobuf:"bytes,3,rep,name=depends_on,json=dependsOn,proto3" json:"depends_on,omitempty"`
+	// run once the dependencies finished, even if they failed
+	Always bool `protobuf:"varint,4,opt,name=always,proto3" json:"always,omitempty"`
+	// seconds after which the step is stopped, 0 for no timeout
+	TimeoutSeconds int64 `protobuf:"varint,5,opt,name=timeout_seconds,json=timeoutSeconds,proto3" json:"timeout_seconds,omitempty"`
+	// a failure of this step does not fail the workflow and counts as
+	// success for the steps depending on it
+	ContinueOnError bool `protobuf:"varint,6,opt,name=continue_on_error,json=continueOnError,proto3" json:"continue_on_error,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *WorkflowStep) Reset() {
+	*x = WorkflowStep{}
+	mi := &file_protos_protobuf_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WorkflowStep) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WorkflowStep) ProtoMessage() {}
+
+func (x *WorkflowStep) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_protobuf_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WorkflowStep.ProtoReflect.Descriptor instead.
+func (*WorkflowStep) Descriptor() ([]byte, []int) {
+	return file_protos_protobuf_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *WorkflowStep) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *WorkflowStep) GetStart() *StartRequest {
+	if x != nil {
+		return x.Start
+	}
+	return nil
+}
+
+func (x *WorkflowStep) GetDependsOn() []string {
+	if x != nil {
+		return x.DependsOn
+	}
+	return nil
+}
+
+func (x *WorkflowStep) GetAlways() bool {
+	if x != nil {
+		return x.Always
+	}
+	return false
+}
+
+func (x *WorkflowStep) GetTimeoutSeconds() int64 {
+	if x != nil {
+		return x.TimeoutSeconds
+	}
+	return 0
+}
+
+func (x *WorkflowStep) GetContinueOnError() bool {
+	if x != nil {
+		return x.ContinueOnError
+	}
+	return false
+}
+
+type WorkflowRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// name of the workflow, e.g. the runbook it encodes
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// steps of the workflow, they must not depend on each other in a cycle
+	Steps         []*WorkflowStep `protobuf:"bytes,2,rep,name=steps,proto3" json:"steps,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WorkflowRequest) Reset() {
+	*x = WorkflowRequest{}
+	mi := &file_protos_protobuf_proto_msgTypes[25]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WorkflowRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WorkflowRequest) ProtoMessage() {}
+
+func (x *WorkflowRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_protobuf_proto_msgTypes[25]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WorkflowRequest.ProtoReflect.Descriptor instead.
+func (*WorkflowRequest) Descriptor() ([]byte, []int) {
+	return file_protos_protobuf_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *WorkflowRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *WorkflowRequest) GetSteps() []*WorkflowStep {
+	if x != nil {
+		return x.Steps
+	}
+	return nil
+}
+
+type WorkflowResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// ID of the started workflow
+	Id            string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WorkflowResponse) Reset() {
+	*x = WorkflowResponse{}
+	mi := &file_protos_protobuf_proto_msgTypes[26]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WorkflowResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WorkflowResponse) ProtoMessage() {}
+
+func (x *WorkflowResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_protobuf_proto_msgTypes[26]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WorkflowResponse.ProtoReflect.Descriptor instead.
+func (*WorkflowResponse) Descriptor() ([]byte, []int) {
+	return file_protos_protobuf_proto_rawDescGZIP(), []int{26}
+}
+
+func (x *WorkflowResponse) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type WorkflowStatusRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// ID of the workflow to status
+	Id            string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WorkflowStatusRequest) Reset() {
+	*x = WorkflowStatusRequest{}
+	mi := &file_protos_protobuf_proto_msgTypes[27]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WorkflowStatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WorkflowStatusRequest) ProtoMessage() {}
+
+func (x *WorkflowStatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_protobuf_proto_msgTypes[27]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WorkflowStatusRequest.ProtoReflect.Descriptor instead.
+func (*WorkflowStatusRequest) Descriptor() ([]byte, []int) {
+	return file_protos_protobuf_proto_rawDescGZIP(), []int{27}
+}
+
+func (x *WorkflowStatusRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type WorkflowStepStatus struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// name of the step
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// ID of the command the step started, empty if it did not start
+	Id string `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+	// current state of the step's command
+	State State `protobuf:"varint,3,opt,name=state,proto3,enum=cmd.State" json:"state,omitempty"`
+	// exit status of the step's command
+	Exit int32 `protobuf:"varint,4,opt,name=exit,proto3" json:"exit,omitempty"`
+	// the step did not run because a dependency failed or the workflow
+	// was stopped
+	Skipped       bool `protobuf:"varint,5,opt,name=skipped,proto3" json:"skipped,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WorkflowStepStatus) Reset() {
+	*x = WorkflowStepStatus{}
+	mi := &file_protos_protobuf_proto_msgTypes[28]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WorkflowStepStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WorkflowStepStatus) ProtoMessage() {}
+
+func (x *WorkflowStepStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_protobuf_proto_msgTypes[28]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WorkflowStepStatus.ProtoReflect.Descriptor instead.
+func (*WorkflowStepStatus) Descriptor() ([]byte, []int) {
+	return file_protos_protobuf_proto_rawDescGZIP(), []int{28}
+}
+
+func (x *WorkflowStepStatus) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *WorkflowStepStatus) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *WorkflowStepStatus) GetState() State {
+	if x != nil {
+		return x.State
+	}
+	return State_UNKNOWN
+}
+
+func (x *WorkflowStepStatus) GetExit() int32 {
+	if x != nil {
+		return x.Exit
+	}
+	return 0
+}
+
+func (x *WorkflowStepStatus) GetSkipped() bool {
+	if x != nil {
+		return x.Skipped
+	}
+	return false
+}
+
+type WorkflowStatusResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// workflow ID
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// name of the workflow
+	Name string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	// RUNNING until all steps finished, then COMPLETE when all steps
+	// succeeded, STOPPED when it was stopped and ERROR when a step failed
+	State         State                 `protobuf:"varint,3,opt,name=state,proto3,enum=cmd.State" json:"state,omitempty"`
+	Steps         []*WorkflowStepStatus `protobuf:"bytes,4,rep,name=steps,proto3" json:"steps,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WorkflowStatusResponse) Reset() {
+	*x = WorkflowStatusResponse{}
+	mi := &file_protos_protobuf_proto_msgTypes[29]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WorkflowStatusResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WorkflowStatusResponse) ProtoMessage() {}
+
+func (x *WorkflowStatusResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_protobuf_proto_msgTypes[29]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WorkflowStatusResponse.ProtoReflect.Descriptor instead.
+func (*WorkflowStatusResponse) Descriptor() ([]byte, []int) {
+	return file_protos_protobuf_proto_rawDescGZIP(), []int{29}
+}
+
+func (x *WorkflowStatusResponse) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *WorkflowStatusResponse) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *WorkflowStatusResponse) GetState() State {
+	if x != nil {
+		return x.State
+	}
+	return State_UNKNOWN
+}
+
+func (x *WorkflowStatusResponse) GetSteps() []*WorkflowStepStatus {
+	if x != nil {
+		return x.Steps
+	}
+	return nil
+}
+
+type StopWorkflowRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// ID of the workflow to stop
+	Id            string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StopWorkflowRequest) Reset() {
+	*x = StopWorkflowRequest{}
+	mi := &file_protos_protobuf_proto_msgTypes[30]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StopWorkflowRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StopWorkflowRequest) ProtoMessage() {}
+
+func (x *StopWorkflowRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_protobuf_proto_msgTypes[30]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StopWorkflowRequest.ProtoReflect.Descriptor instead.
+func (*StopWorkflowRequest) Descriptor() ([]byte, []int) {
+	return file_protos_protobuf_proto_rawDescGZIP(), []int{30}
+}
+
+func (x *StopWorkflowRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type StopWorkflowResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// ID of the workflow stopped
+	Id            string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StopWorkflowResponse) Reset() {
+	*x = StopWorkflowResponse{}
+	mi := &file_protos_protobuf_proto_msgTypes[31]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StopWorkflowResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StopWorkflowResponse) ProtoMessage() {}
+
+func (x *StopWorkflowResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_protobuf_proto_msgTypes[31]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StopWorkflowResponse.ProtoReflect.Descriptor instead.
+func (*StopWorkflowResponse) Descriptor() ([]byte, []int) {
+	return file_protos_protobuf_proto_rawDescGZIP(), []int{31}
+}
+
+func (x *StopWorkflowResponse) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+var File_protos_protobuf_proto protoreflect.FileDescriptor
+
+const file_protos_protobuf_proto_rawDesc = "" +
+	"\n" +
+	"\x15protos/protobuf.proto\x12\x03cmd\"\xc5\x02\n" +
+	"\fStartRequest\x12\x18\n" +
+	"\acommand\x18\x01 \x01(\tR\acommand\x12\x12\n" +
+	"\x04args\x18\x02 \x03(\tR\x04args\x12!\n" +
+	"\foutput_limit\x18\x03 \x01(\x03R\voutputLimit\x12@\n" +
+	"\x11output_limit_mode\x18\x04 \x01(\x0e2\x14.cmd.OutputLimitModeR\x0foutputLimitMode\x12\x14\n" +
+	"\x05owner\x18\x05 \x01(\tR\x05owner\x12\x1a\n" +
+	"\bpriority\x18\x06 \x01(\x05R\bpriority\x12&\n" +
+	"\x05retry\x18\a \x01(\v2\x10.cmd.RetryPolicyR\x05retry\x12'\n" +
+	"\x0fidempotency_key\x18\b \x01(\tR\x0eidempotencyKey\x12\x1f\n" +
+	"\vsecret_args\x18\t \x03(\x05R\n" +
+	"secretArgs\"\xe2\x01\n" +
+	"\vRetryPolicy\x12!\n" +
+	"\fmax_attempts\x18\x01 \x01(\x05R\vmaxAttempts\x12\x1d\n" +
+	"\n" +
+	"backoff_ms\x18\x02 \x01(\x03R\tbackoffMs\x129\n" +
+	"\x0ebackoff_policy\x18\x03 \x01(\x0e2\x12.cmd.BackoffPolicyR\rbackoffPolicy\x12$\n" +
+	"\x0emax_backoff_ms\x18\x04 \x01(\x03R\fmaxBackoffMs\x120\n" +
+	"\x14retryable_exit_codes\x18\x05 \x03(\x05R\x12retryableExitCodes\"\x1f\n" +
+	"\rStartResponse\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\x1f\n" +
+	"\rOutputRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"(\n" +
+	"\x0eOutputResponse\x12\x16\n" +
+	"\x06output\x18\x01 \x01(\fR\x06output\"\x1f\n" +
+	"\rStatusRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\xd4\x02\n" +
+	"\x0eStatusResponse\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x10\n" +
+	"\x03cmd\x18\x02 \x01(\tR\x03cmd\x12\x12\n" +
+	"\x04args\x18\x03 \x03(\tR\x04args\x12 \n" +
+	"\x05state\x18\x04 \x01(\x0e2\n" +
+	".cmd.StateR\x05state\x12\x12\n" +
+	"\x04exit\x18\x06 \x01(\x05R\x04exit\x12\x1c\n" +
+	"\ttruncated\x18\a \x01(\bR\ttruncated\x12%\n" +
+	"\x0equeue_position\x18\b \x01(\x05R\rqueuePosition\x12\x1f\n" +
+	"\vschedule_id\x18\t \x01(\tR\n" +
+	"scheduleId\x12\x1f\n" +
+	"\vworkflow_id\x18\n" +
+	" \x01(\tR\n" +
+	"workflowId\x12\x18\n" +
+	"\aattempt\x18\v \x01(\x05R\aattempt\x12\x1f\n" +
+	"\vattempt_ids\x18\f \x03(\tR\n" +
+	"attemptIds\x12\x14\n" +
+	"\x05error\x18\r \x01(\tR\x05error\"\x1d\n" +
+	"\vStopRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\x1e\n" +
+	"\fStopResponse\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"e\n" +
+	"\x0fScheduleRequest\x12'\n" +
+	"\x05start\x18\x01 \x01(\v2\x11.cmd.StartRequestR\x05start\x12\x12\n" +
+	"\x04cron\x18\x02 \x01(\tR\x04cron\x12\x15\n" +
+	"\x06run_at\x18\x03 \x01(\x03R\x05runAt\"=\n" +
+	"\x10ScheduleResponse\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x19\n" +
+	"\bnext_run\x18\x02 \x01(\x03R\anextRun\"\xbe\x01\n" +
+	"\fScheduleInfo\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x10\n" +
+	"\x03cmd\x18\x02 \x01(\tR\x03cmd\x12\x12\n" +
+	"\x04args\x18\x03 \x03(\tR\x04args\x12\x12\n" +
+	"\x04cron\x18\x04 \x01(\tR\x04cron\x12\x15\n" +
+	"\x06run_at\x18\x05 \x01(\x03R\x05runAt\x12\x19\n" +
+	"\bnext_run\x18\x06 \x01(\x03R\anextRun\x12\x19\n" +
+	"\blast_run\x18\a \x01(\x03R\alastRun\x12\x17\n" +
+	"\alast_id\x18\b \x01(\tR\x06lastId\"\x16\n" +
+	"\x14ListSchedulesRequest\"H\n" +
+	"\x15ListSchedulesResponse\x12/\n" +
+	"\tschedules\x18\x01 \x03(\v2\x11.cmd.ScheduleInfoR\tschedules\"a\n" +
+	"\x0fListJobsRequest\x12\"\n" +
+	"\x06states\x18\x01 \x03(\x0e2\n" +
+	".cmd.StateR\x06states\x12\x14\n" +
+	"\x05owner\x18\x02 \x01(\tR\x05owner\x12\x14\n" +
+	"\x05limit\x18\x03 \x01(\x05R\x05limit\"\xaa\x01\n" +
+	"\aJobInfo\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x10\n" +
+	"\x03cmd\x18\x02 \x01(\tR\x03cmd\x12\x12\n" +
+	"\x04args\x18\x03 \x03(\tR\x04args\x12 \n" +
+	"\x05state\x18\x04 \x01(\x0e2\n" +
+	".cmd.StateR\x05state\x12\x12\n" +
+	"\x04exit\x18\x05 \x01(\x05R\x04exit\x12\x14\n" +
+	"\x05owner\x18\x06 \x01(\tR\x05owner\x12\x1d\n" +
+	"\n" +
+	"created_at\x18\a \x01(\x03R\tcreatedAt\"4\n" +
+	"\x10ListJobsResponse\x12 \n" +
+	"\x04jobs\x18\x01 \x03(\v2\f.cmd.JobInfoR\x04jobs\"\x0e\n" +
+	"\fDrainRequest\"C\n" +
+	"\rDrainResponse\x12\x18\n" +
+	"\arunning\x18\x01 \x01(\x05R\arunning\x12\x18\n" +
+	"\apending\x18\x02 \x01(\x05R\apending\"\x0f\n" +
+	"\rHealthRequest\"h\n" +
+	"\rBackendStatus\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x0e\n" +
+	"\x02ok\x18\x02 \x01(\bR\x02ok\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\x12\x1d\n" +
+	"\n" +
+	"latency_ms\x18\x04 \x01(\x03R\tlatencyMs\"\xe7\x01\n" +
+	"\x0eHealthResponse\x12\x18\n" +
+	"\aversion\x18\x01 \x01(\tR\aversion\x12%\n" +
+	"\x0euptime_seconds\x18\x02 \x01(\x03R\ruptimeSeconds\x12\x18\n" +
+	"\arunning\x18\x03 \x01(\x05R\arunning\x12\x18\n" +
+	"\apending\x18\x04 \x01(\x05R\apending\x12\x1a\n" +
+	"\bdraining\x18\x05 \x01(\bR\bdraining\x12\x14\n" +
+	"\x05ready\x18\x06 \x01(\bR\x05ready\x12.\n" +
+	"\bbackends\x18\a \x03(\v2\x12.cmd.BackendStatusR\bbackends\"'\n" +
+	"\x15DeleteScheduleRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"(\n" +
+	"\x16DeleteScheduleResponse\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\xd7\x01\n" +
+	"\fWorkflowStep\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12'\n" +
+	"\x05start\x18\x02 \x01(\v2\x11.cmd.StartRequestR\x05start\x12\x1d\n" +
+	"\n" +
+	"depends_on\x18\x03 \x03(\tR\tdependsOn\x12\x16\n" +
+	"\x06always\x18\x04 \x01(\bR\x06always\x12'\n" +
+	"\x0ftimeout_seconds\x18\x05 \x01(\x03R\x0etimeoutSeconds\x12*\n" +
+	"\x11continue_on_error\x18\x06 \x01(\bR\x0fcontinueOnError\"N\n" +
+	"\x0fWorkflowRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12'\n" +
+	"\x05steps\x18\x02 \x03(\v2\x11.cmd.WorkflowStepR\x05steps\"\"\n" +
+	"\x10WorkflowResponse\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"'\n" +
+	"\x15WorkflowStatusRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\x88\x01\n" +
+	"\x12WorkflowStepStatus\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\tR\x02id\x12 \n" +
+	"\x05state\x18\x03 \x01(\x0e2\n" +
+	".cmd.StateR\x05state\x12\x12\n" +
+	"\x04exit\x18\x04 \x01(\x05R\x04exit\x12\x18\n" +
+	"\askipped\x18\x05 \x01(\bR\askipped\"\x8d\x01\n" +
+	"\x16WorkflowStatusResponse\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12 \n" +
+	"\x05state\x18\x03 \x01(\x0e2\n" +
+	".cmd.StateR\x05state\x12-\n" +
+	"\x05steps\x18\x04 \x03(\v2\x17.cmd.WorkflowStepStatusR\x05steps\"%\n" +
+	"\x13StopWorkflowRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"&\n" +
+	"\x14StopWorkflowResponse\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id*;\n" +
+	"\rBackoffPolicy\x12\x11\n" +
+	"\rBACKOFF_FIXED\x10\x00\x12\x17\n" +
+	"\x13BACKOFF_EXPONENTIAL\x10\x01*D\n" +
+	"\x0fOutputLimitMode\x12\x11\n" +
+	"\rLIMIT_DEFAULT\x10\x00\x12\x0e\n" +
+	"\n" +
+	"LIMIT_KILL\x10\x01\x12\x0e\n" +
+	"\n" +
+	"LIMIT_RING\x10\x02*T\n" +
 	"\x05State\x12\v\n" +
 	"\aUNKNOWN\x10\x00\x12\f\n" +
 	"\bCOMPLETE\x10\x01\x12\v\n" +
 	"\aSTOPPED\x10\x02\x12\t\n" +
 	"\x05ERROR\x10\x03\x12\v\n" +
 	"\aRUNNING\x10\x04\x12\v\n" +
-	"\aPENDING\x10\x052\xcc\x01\n" +
+	"\aPENDING\x10\x052\x82\x06\n" +
 	"\x05Agent\x12.\n" +
 	"\x05Start\x12\x11.cmd.StartRequest\x1a\x12.cmd.StartResponse\x123\n" +
 	"\x06Output\x12\x12.cmd.OutputRequest\x1a\x13.cmd.OutputResponse0\x01\x121\n" +
 	"\x06Status\x12\x12.cmd.StatusRequest\x1a\x13.cmd.StatusResponse\x12+\n" +
-	"\x04Stop\x12\x10.cmd.StopRequest\x1a\x11.cmd.StopResponseB,Z*github.com/stewyb314/remote-control/protosb\x06proto3"
+	"\x04Stop\x12\x10.cmd.StopRequest\x1a\x11.cmd.StopResponse\x127\n" +
+	"\bSchedule\x12\x14.cmd.ScheduleRequest\x1a\x15.cmd.ScheduleResponse\x12F\n" +
+	"\rListSchedules\x12\x19.cmd.ListSchedulesRequest\x1a\x1a.cmd.ListSchedulesResponse\x12I\n" +
+	"\x0eDeleteSchedule\x12\x1a.cmd.DeleteScheduleRequest\x1a\x1b.cmd.DeleteScheduleResponse\x12<\n" +
+	"\rStartWorkflow\x12\x14.cmd.WorkflowRequest\x1a\x15.cmd.WorkflowResponse\x12I\n" +
+	"\x0eWorkflowStatus\x12\x1a.cmd.WorkflowStatusRequest\x1a\x1b.cmd.WorkflowStatusResponse\x12C\n" +
+	"\fStopWorkflow\x12\x18.cmd.StopWorkflowRequest\x1a\x19.cmd.StopWorkflowResponse\x127\n" +
+	"\bListJobs\x12\x14.cmd.ListJobsRequest\x1a\x15.cmd.ListJobsResponse\x12.\n" +
+	"\x05Drain\x12\x11.cmd.DrainRequest\x1a\x12.cmd.DrainResponse\x121\n" +
+	"\x06Health\x12\x12.cmd.HealthRequest\x1a\x13.cmd.HealthResponseB,Z*github.com/stewyb314/remote-control/protosb\x06proto3"
 
 var (
 	file_protos_protobuf_proto_rawDescOnce sync.Once
@@ -542,34 +2366,92 @@ func file_protos_protobuf_proto_rawDescGZIP() []byte {
 	return file_protos_protobuf_proto_rawDescData
 }
 
-var file_protos_protobuf_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_protos_protobuf_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_protos_protobuf_proto_enumTypes = make([]protoimpl.EnumInfo, 3)
+var file_protos_protobuf_proto_msgTypes = make([]protoimpl.MessageInfo, 32)
 var file_protos_protobuf_proto_goTypes = []any{
-	(State)(0),             // 0: cmd.State
-	(*StartRequest)(nil),   // 1: cmd.StartRequest
-	(*StartResponse)(nil),  // 2: cmd.StartResponse
-	(*OutputRequest)(nil),  // 3: cmd.OutputRequest
-	(*OutputResponse)(nil), // 4: cmd.OutputResponse
-	(*StatusRequest)(nil),  // 5: cmd.StatusRequest
-	(*StatusResponse)(nil), // 6: cmd.StatusResponse
-	(*StopRequest)(nil),    // 7: cmd.StopRequest
-	(*StopResponse)(nil),   // 8: cmd.StopResponse
+	(BackoffPolicy)(0),             // 0: cmd.BackoffPolicy
+	(OutputLimitMode)(0),           // 1: cmd.OutputLimitMode
+	(State)(0),                     // 2: cmd.State
+	(*StartRequest)(nil),           // 3: cmd.StartRequest
+	(*RetryPolicy)(nil),            // 4: cmd.RetryPolicy
+	(*StartResponse)(nil),          // 5: cmd.StartResponse
+	(*OutputRequest)(nil),          // 6: cmd.OutputRequest
+	(*OutputResponse)(nil),         // 7: cmd.OutputResponse
+	(*StatusRequest)(nil),          // 8: cmd.StatusRequest
+	(*StatusResponse)(nil),         // 9: cmd.StatusResponse
+	(*StopRequest)(nil),            // 10: cmd.StopRequest
+	(*StopResponse)(nil),           // 11: cmd.StopResponse
+	(*ScheduleRequest)(nil),        // 12: cmd.ScheduleRequest
+	(*ScheduleResponse)(nil),       // 13: cmd.ScheduleResponse
+	(*ScheduleInfo)(nil),           // 14: cmd.ScheduleInfo
+	(*ListSchedulesRequest)(nil),   // 15: cmd.ListSchedulesRequest
+	(*ListSchedulesResponse)(nil),  // 16: cmd.ListSchedulesResponse
+	(*ListJobsRequest)(nil),        // 17: cmd.ListJobsRequest
+	(*JobInfo)(nil),                // 18: cmd.JobInfo
+	(*ListJobsResponse)(nil),       // 19: cmd.ListJobsResponse
+	(*DrainRequest)(nil),           // 20: cmd.DrainRequest
+	(*DrainResponse)(nil),          // 21: cmd.DrainResponse
+	(*HealthRequest)(nil),          // 22: cmd.HealthRequest
+	(*BackendStatus)(nil),          // 23: cmd.BackendStatus
+	(*HealthResponse)(nil),         // 24: cmd.HealthResponse
+	(*DeleteScheduleRequest)(nil),  // 25: cmd.DeleteScheduleRequest
+	(*DeleteScheduleResponse)(nil), // 26: cmd.DeleteScheduleResponse
+	(*WorkflowStep)(nil),           // 27: cmd.WorkflowStep
+	(*WorkflowRequest)(nil),        // 28: cmd.WorkflowRequest
+	(*WorkflowResponse)(nil),       // 29: cmd.WorkflowResponse
+	(*WorkflowStatusRequest)(nil),  // 30: cmd.WorkflowStatusRequest
+	(*WorkflowStepStatus)(nil),     // 31: cmd.WorkflowStepStatus
+	(*WorkflowStatusResponse)(nil), // 32: cmd.WorkflowStatusResponse
+	(*StopWorkflowRequest)(nil),    // 33: cmd.StopWorkflowRequest
+	(*StopWorkflowResponse)(nil),   // 34: cmd.StopWorkflowResponse
 }
 var file_protos_protobuf_proto_depIdxs = []int32{
-	0, // 0: cmd.StatusResponse.state:type_name -> cmd.State
-	1, // 1: cmd.Agent.Start:input_type -> cmd.StartRequest
-	3, // 2: cmd.Agent.Output:input_type -> cmd.OutputRequest
-	5, // 3: cmd.Agent.Status:input_type -> cmd.StatusRequest
-	7, // 4: cmd.Agent.Stop:input_type -> cmd.StopRequest
-	2, // 5: cmd.Agent.Start:output_type -> cmd.StartResponse
-	4, // 6: cmd.Agent.Output:output_type -> cmd.OutputResponse
-	6, // 7: cmd.Agent.Status:output_type -> cmd.StatusResponse
-	8, // 8: cmd.Agent.Stop:output_type -> cmd.StopResponse
-	5, // [5:9] is the sub-list for method output_type
-	1, // [1:5] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+	1,  // 0: cmd.StartRequest.output_limit_mode:type_name -> cmd.OutputLimitMode
+	4,  // 1: cmd.StartRequest.retry:type_name -> cmd.RetryPolicy
+	0,  // 2: cmd.RetryPolicy.backoff_policy:type_name -> cmd.BackoffPolicy
+	2,  // 3: cmd.StatusResponse.state:type_name -> cmd.State
+	3,  // 4: cmd.ScheduleRequest.start:type_name -> cmd.StartRequest
+	14, // 5: cmd.ListSchedulesResponse.schedules:type_name -> cmd.ScheduleInfo
+	2,  // 6: cmd.ListJobsRequest.states:type_name -> cmd.State
+	2,  // 7: cmd.JobInfo.state:type_name -> cmd.State
+	18, // 8: cmd.ListJobsResponse.jobs:type_name -> cmd.JobInfo
+	23, // 9: cmd.HealthResponse.backends:type_name -> cmd.BackendStatus
+	3,  // 10: cmd.WorkflowStep.start:type_name -> cmd.StartRequest
+	27, // 11: cmd.WorkflowRequest.steps:type_name -> cmd.WorkflowStep
+	2,  // 12: cmd.WorkflowStepStatus.state:type_name -> cmd.State
+	2,  // 13: cmd.WorkflowStatusResponse.state:type_name -> cmd.State
+	31, // 14: cmd.WorkflowStatusResponse.steps:type_name -> cmd.WorkflowStepStatus
+	3,  // 15: cmd.Agent.Start:input_type -> cmd.StartRequest
+	6,  // 16: cmd.Agent.Output:input_type -> cmd.OutputRequest
+	8,  // 17: cmd.Agent.Status:input_type -> cmd.StatusRequest
+	10, // 18: cmd.Agent.Stop:input_type -> cmd.StopRequest
+	12, // 19: cmd.Agent.Schedule:input_type -> cmd.ScheduleRequest
+	15, // 20: cmd.Agent.ListSchedules:input_type -> cmd.ListSchedulesRequest
+	25, // 21: cmd.Agent.DeleteSchedule:input_type -> cmd.DeleteScheduleRequest
+	28, // 22: cmd.Agent.StartWorkflow:input_type -> cmd.WorkflowRequest
+	30, // 23: cmd.Agent.WorkflowStatus:input_type -> cmd.WorkflowStatusRequest
+	33, // 24: cmd.Agent.StopWorkflow:input_type -> cmd.StopWorkflowRequest
+	17, // 25: cmd.Agent.ListJobs:input_type -> cmd.ListJobsRequest
+	20, // 26: cmd.Agent.Drain:input_type -> cmd.DrainRequest
+	22, // 27: cmd.Agent.Health:input_type -> cmd.HealthRequest
+	5,  // 28: cmd.Agent.Start:output_type -> cmd.StartResponse
+	7,  // 29: cmd.Agent.Output:output_type -> cmd.OutputResponse
+	9,  // 30: cmd.Agent.Status:output_type -> cmd.StatusResponse
+	11, // 31: cmd.Agent.Stop:output_type -> cmd.StopResponse
+	13, // 32: cmd.Agent.Schedule:output_type -> cmd.ScheduleResponse
+	16, // 33: cmd.Agent.ListSchedules:output_type -> cmd.ListSchedulesResponse
+	26, // 34: cmd.Agent.DeleteSchedule:output_type -> cmd.DeleteScheduleResponse
+	29, // 35: cmd.Agent.StartWorkflow:output_type -> cmd.WorkflowResponse
+	32, // 36: cmd.Agent.WorkflowStatus:output_type -> cmd.WorkflowStatusResponse
+	34, // 37: cmd.Agent.StopWorkflow:output_type -> cmd.StopWorkflowResponse
+	19, // 38: cmd.Agent.ListJobs:output_type -> cmd.ListJobsResponse
+	21, // 39: cmd.Agent.Drain:output_type -> cmd.DrainResponse
+	24, // 40: cmd.Agent.Health:output_type -> cmd.HealthResponse
+	28, // [28:41] is the sub-list for method output_type
+	15, // [15:28] is the sub-list for method input_type
+	15, // [15:15] is the sub-list for extension type_name
+	15, // [15:15] is the sub-list for extension extendee
+	0,  // [0:15] is the sub-list for field type_name
 }
 
 func init() { file_protos_protobuf_proto_init() }
@@ -582,8 +2464,8 @@ func file_protos_protobuf_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_protos_protobuf_proto_rawDesc), len(file_protos_protobuf_proto_rawDesc)),
-			NumEnums:      1,
-			NumMessages:   8,
+			NumEnums:      3,
+			NumMessages:   32,
 			NumExtensions: 0,
 			NumServices:   1,
 		},